@@ -0,0 +1,250 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// bytes of string content shown on one line of an annotated listing
+const annotateChunk = 16
+
+// names of well-known tags shown in annotated listings
+var tagNames = map[uint64]string{
+	0:                      "standard date/time",
+	1:                      "epoch date/time",
+	2:                      "unsigned bignum",
+	3:                      "negative bignum",
+	4:                      "decimal fraction",
+	5:                      "bigfloat",
+	16:                     "COSE_Encrypt0",
+	17:                     "COSE_Mac0",
+	18:                     "COSE_Sign1",
+	21:                     "expected base64url",
+	22:                     "expected base64",
+	23:                     "expected base16",
+	TagEmbeddedCBOR:        "embedded CBOR",
+	32:                     "URI",
+	TagMultiDimRowMajor:    "multi-dimensional array",
+	61:                     "CWT",
+	TagSet:                 "set",
+	TagMultiDimColumnMajor: "multi-dimensional array, column-major",
+	TagSelfDescribed:       "self-described CBOR",
+	TagMsgPackExt:          "MessagePack extension",
+}
+
+// Annotate returns a listing of the data items in buf in the style of
+// cbor.me. Each line holds the offset, the bytes of a head or of string
+// content and a comment describing them; the items of arrays, maps and
+// tags are indented under their head:
+//
+//	000000  a2                 # map(2)
+//	000001    66 6e6573746564  # text(6) "nested"
+//	000008    f5               # true
+//	000009    01               # unsigned(1)
+//	00000a    38 80            # negative(-129)
+//
+// If buf is not well-formed, the listing up to the error is returned with
+// the error.
+func Annotate(buf []byte) (string, error) {
+	d := NewDecoder(buf)
+	a := annotator{d: &d}
+	var err error
+	for err == nil && !d.Done() {
+		err = a.item(0)
+	}
+	return a.format(), err
+}
+
+type annotateLine struct {
+	offset  uint32
+	depth   int
+	hex     string
+	comment string
+}
+
+type annotator struct {
+	d     *Decoder
+	lines []annotateLine
+}
+
+func (a *annotator) add(offset uint32, depth int, hexText, comment string) {
+	a.lines = append(a.lines, annotateLine{offset: offset, depth: depth, hex: hexText, comment: comment})
+}
+
+func (a *annotator) format() string {
+	width := 0
+	for _, l := range a.lines {
+		if n := 2*l.depth + len(l.hex); n > width {
+			width = n
+		}
+	}
+	var sb strings.Builder
+	for _, l := range a.lines {
+		offset := strconv.FormatUint(uint64(l.offset), 16)
+		sb.WriteString(strings.Repeat("0", 6-len(offset)))
+		sb.WriteString(offset)
+		sb.WriteString("  ")
+		sb.WriteString(strings.Repeat(" ", 2*l.depth))
+		sb.WriteString(l.hex)
+		sb.WriteString(strings.Repeat(" ", width-2*l.depth-len(l.hex)))
+		sb.WriteString("  # ")
+		sb.WriteString(l.comment)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func (a *annotator) item(depth int) error {
+	start := a.d.reader.byteOffset
+	head, err := a.d.PeekType()
+	if err != nil {
+		return err
+	}
+	headBytes := a.d.reader.buffer[start : start+uint32(head.HeadLen)]
+	if err := a.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return err
+	}
+	headHex := hex.EncodeToString(headBytes[:1])
+	if len(headBytes) > 1 {
+		headHex += " " + hex.EncodeToString(headBytes[1:])
+	}
+	arg := strconv.FormatUint(head.Arg, 10)
+	switch head.Major {
+	case TypeMajorUnsigned:
+		a.add(start, depth, headHex, "unsigned("+arg+")")
+	case TypeMajorSigned:
+		n := "-18446744073709551616"
+		if head.Arg < math.MaxUint64 {
+			n = "-" + strconv.FormatUint(head.Arg+1, 10)
+		}
+		a.add(start, depth, headHex, "negative("+n+")")
+	case TypeMajorBytes, TypeMajorText:
+		name := "bytes"
+		if head.Major == TypeMajorText {
+			name = "text"
+		}
+		if head.Indefinite {
+			a.add(start, depth, headHex, name+"(*)")
+			return a.items(depth+1, 0, true)
+		}
+		return a.str(start, depth, headHex, name, head)
+	case TypeMajorArray:
+		if head.Indefinite {
+			a.add(start, depth, headHex, "array(*)")
+			return a.items(depth+1, 0, true)
+		}
+		a.add(start, depth, headHex, "array("+arg+")")
+		return a.items(depth+1, head.Arg, false)
+	case TypeMajorMap:
+		if head.Indefinite {
+			a.add(start, depth, headHex, "map(*)")
+			return a.items(depth+1, 0, true)
+		}
+		a.add(start, depth, headHex, "map("+arg+")")
+		return a.items(depth+1, 2*head.Arg, false)
+	case TypeMajorTagged:
+		comment := "tag(" + arg + ")"
+		if name, ok := tagNames[head.Arg]; ok {
+			comment += " " + name
+		} else if isTypedArrayTag(head.Arg) {
+			comment += " typed array"
+		}
+		a.add(start, depth, headHex, comment)
+		if depth >= DefaultMaxDepth {
+			return ErrTooDeep
+		}
+		return a.item(depth + 1)
+	default:
+		a.add(start, depth, headHex, simpleComment(head))
+		if head.Simple == SimpleBreak {
+			return ReadError{"unexpected break"}
+		}
+	}
+	return nil
+}
+
+// items annotates n items, or items up to a break if indef is set.
+func (a *annotator) items(depth int, n uint64, indef bool) error {
+	if depth > DefaultMaxDepth {
+		return ErrTooDeep
+	}
+	for i := uint64(0); indef || i < n; i++ {
+		if indef {
+			start := a.d.reader.byteOffset
+			if end, err := a.d.atBreak(); err != nil {
+				return err
+			} else if end {
+				a.add(start, depth-1, "ff", "break")
+				return nil
+			}
+		}
+		if err := a.item(depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// str annotates a definite length string. Short strings share the line of
+// their head; longer ones are listed in chunks below it.
+func (a *annotator) str(start uint32, depth int, headHex, name string, head ItemType) error {
+	if head.Arg >= 0xffffffff {
+		return ReadError{"string too long"}
+	}
+	content, err := a.d.reader.GetBytes(uint32(head.Arg))
+	if err != nil {
+		return err
+	}
+	comment := name + "(" + strconv.FormatUint(head.Arg, 10) + ")"
+	quote := func(b []byte) string {
+		if name == "text" {
+			return strconv.Quote(string(b))
+		}
+		return "h'" + hex.EncodeToString(b) + "'"
+	}
+	if len(content) <= annotateChunk {
+		if len(content) > 0 {
+			headHex += " " + hex.EncodeToString(content)
+		}
+		a.add(start, depth, headHex, comment+" "+quote(content))
+		return nil
+	}
+	a.add(start, depth, headHex, comment)
+	offset := start + uint32(head.HeadLen)
+	for len(content) > 0 {
+		n := annotateChunk
+		if n > len(content) {
+			n = len(content)
+		}
+		a.add(offset, depth+1, hex.EncodeToString(content[:n]), quote(content[:n]))
+		content = content[n:]
+		offset += uint32(n)
+	}
+	return nil
+}
+
+func simpleComment(head ItemType) string {
+	switch head.Simple {
+	case SimpleFloat16:
+		return "float16(" + strconv.FormatFloat(float64(float16ToFloat32(uint16(head.Arg))), 'g', -1, 32) + ")"
+	case SimpleFloat32:
+		return "float32(" + strconv.FormatFloat(float64(math.Float32frombits(uint32(head.Arg))), 'g', -1, 32) + ")"
+	case SimpleFloat64:
+		return "float64(" + strconv.FormatFloat(math.Float64frombits(head.Arg), 'g', -1, 64) + ")"
+	case SimpleBreak:
+		return "break"
+	}
+	switch {
+	case head.IsNull():
+		return "null"
+	case head.IsUndefined():
+		return "undefined"
+	case head.Arg == TypeBoolFalse&0x1f:
+		return "false"
+	case head.Arg == TypeBoolTrue&0x1f:
+		return "true"
+	}
+	return "simple(" + strconv.FormatUint(head.Arg, 10) + ")"
+}
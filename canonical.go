@@ -0,0 +1,146 @@
+package cbor
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+// Canonical re-encodes the data item in buf with the core deterministic
+// encoding of RFC 8949 §4.2.1: heads in their shortest form, definite
+// lengths only, floats in the shortest precision that keeps their value and
+// map entries sorted by the bytewise order of their encoded keys. Maps with
+// duplicate keys are rejected.
+func Canonical(buf []byte) ([]byte, error) {
+	d := NewDecoder(buf)
+	out, err := canonicalItem(&d, make([]byte, 0, len(buf)), 0)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Done() {
+		return nil, ErrTrailingData
+	}
+	return out, nil
+}
+
+type canonicalEntry struct {
+	key, value []byte
+}
+
+func canonicalItem(d *Decoder, out []byte, depth nesting) ([]byte, error) {
+	head, err := d.PeekType()
+	if err != nil {
+		return nil, err
+	}
+	if head.Major == TypeMajorBytes || head.Major == TypeMajorText {
+		content, err := d.readChunked(head.Major)
+		if err != nil {
+			return nil, err
+		}
+		out = appendHead(out, head.Major, uint64(len(content)))
+		return append(out, content...), nil
+	}
+	if err := d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return nil, err
+	}
+	if head.Major >= TypeMajorArray && head.Major <= TypeMajorTagged {
+		if err := depth.enter(); err != nil {
+			return nil, err
+		}
+	}
+	switch head.Major {
+	case TypeMajorUnsigned, TypeMajorSigned:
+		return appendHead(out, head.Major, head.Arg), nil
+	case TypeMajorArray:
+		var items []byte
+		n := uint64(0)
+		for ; head.Indefinite || n < head.Arg; n++ {
+			if head.Indefinite {
+				if end, err := d.atBreak(); err != nil {
+					return nil, err
+				} else if end {
+					break
+				}
+			}
+			if items, err = canonicalItem(d, items, depth); err != nil {
+				return nil, err
+			}
+		}
+		out = appendHead(out, TypeMajorArray, n)
+		return append(out, items...), nil
+	case TypeMajorMap:
+		var entries []canonicalEntry
+		for i := uint64(0); head.Indefinite || i < head.Arg; i++ {
+			if head.Indefinite {
+				if end, err := d.atBreak(); err != nil {
+					return nil, err
+				} else if end {
+					break
+				}
+			}
+			var e canonicalEntry
+			if e.key, err = canonicalItem(d, nil, depth); err != nil {
+				return nil, err
+			}
+			if e.value, err = canonicalItem(d, nil, depth); err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		out = appendHead(out, TypeMajorMap, uint64(len(entries)))
+		for i, e := range entries {
+			if i > 0 && bytes.Equal(entries[i-1].key, e.key) {
+				return nil, ReadError{"duplicate map key"}
+			}
+			out = append(out, e.key...)
+			out = append(out, e.value...)
+		}
+		return out, nil
+	case TypeMajorTagged:
+		return canonicalItem(d, appendHead(out, TypeMajorTagged, head.Arg), depth)
+	}
+	var f float64
+	switch head.Simple {
+	case SimpleFloat16:
+		f = float64(float16ToFloat32(uint16(head.Arg)))
+	case SimpleFloat32:
+		f = float64(math.Float32frombits(uint32(head.Arg)))
+	case SimpleFloat64:
+		f = math.Float64frombits(head.Arg)
+	case SimpleBreak:
+		return nil, ReadError{"unexpected break"}
+	default:
+		if head.Arg < 24 {
+			return append(out, TypeMajorSimple|uint8(head.Arg)), nil
+		}
+		return append(out, TypeSimple8, uint8(head.Arg)), nil
+	}
+	prefix, bits := shortestFloat(f)
+	out = append(out, prefix)
+	for i := 1<<(prefix-TypeF16+1) - 1; i >= 0; i-- {
+		out = append(out, uint8(bits>>(8*i)))
+	}
+	return out, nil
+}
+
+// appendHead appends the shortest head of the given major type and argument.
+func appendHead(out []byte, major uint8, arg uint64) []byte {
+	switch {
+	case arg <= TypeU8ShortMax:
+		return append(out, major|uint8(arg))
+	case arg <= 0xff:
+		return append(out, major|24, uint8(arg))
+	case arg <= 0xffff:
+		return append(out, major|25, uint8(arg>>8), uint8(arg))
+	case arg <= 0xffffffff:
+		return append(out, major|26, uint8(arg>>24), uint8(arg>>16), uint8(arg>>8), uint8(arg))
+	}
+	out = append(out, major|27)
+	for i := 7; i >= 0; i-- {
+		out = append(out, uint8(arg>>(8*i)))
+	}
+	return out
+}
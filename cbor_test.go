@@ -1,8 +1,11 @@
 package cbor_test
 
 import (
+	"bytes"
+	"encoding/hex"
 	cbor "github.com/wasmcloud/tinygo-cbor"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -155,10 +158,10 @@ func (o *Required) Decode(decoder *cbor.Decoder) error {
 	return nil
 }
 
-func (o *Required) Encode(encoder cbor.Writer) {
+func (o *Required) Encode(encoder cbor.Writer) error {
 	if o == nil {
 		encoder.WriteNil()
-		return
+		return encoder.CheckError()
 	}
 	encoder.WriteMapSize(16)
 
@@ -229,14 +232,15 @@ func (o *Required) Encode(encoder cbor.Writer) {
 			encoder.WriteInt64(value)
 		}
 	}
+	return encoder.CheckError()
 }
 
 func (o *Required) ToBuffer() []byte {
 	var sizer cbor.Sizer
-	o.Encode(&sizer)
+	_ = o.Encode(&sizer)
 	buffer := make([]byte, sizer.Len())
 	encoder := cbor.NewEncoder(buffer)
-	o.Encode(&encoder)
+	_ = o.Encode(&encoder)
 	return buffer
 }
 
@@ -269,6 +273,80 @@ func TestEcho(t *testing.T) {
 	assert.Equal(t, expected, actual, "mismatch with required fields")
 }
 
+func TestToBytes(t *testing.T) {
+	expected := Required{
+		U64Value:    math.MaxUint64,
+		S64Value:    math.MinInt64,
+		StringValue: "test",
+		BytesValue:  []byte{},
+		ArrayValue:  []int64{1, 2, 3, 4},
+		MapValue:    map[string]int64{"key": 1234},
+	}
+	var codec cbor.Codec = &expected
+
+	data, err := cbor.ToBytes(codec)
+	require.NoError(t, err)
+	assert.Equal(t, expected.ToBuffer(), data)
+
+	var actual Required
+	require.NoError(t, cbor.FromBytes(data, &actual))
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, cbor.ErrTrailingData, cbor.FromBytes(append(data, 0x00), &actual))
+	assert.Equal(t, cbor.ErrTrailingData, cbor.FromBytesStrict(append(data, 0x00), &actual))
+
+	prefix := []byte{0x01, 0x02}
+	appended, err := cbor.AppendBytes(prefix, &expected)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0x01, 0x02}, data...), appended)
+}
+
+type tooLong struct{}
+
+func (tooLong) Encode(encoder cbor.Writer) error {
+	// larger than the Sizer reports on the second pass
+	if _, ok := encoder.(*cbor.Sizer); ok {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteString("too long")
+	}
+	return nil
+}
+
+func TestToBytesChecksEncoderError(t *testing.T) {
+	_, err := cbor.ToBytes(tooLong{})
+	assert.ErrorIs(t, err, cbor.ErrRange)
+
+	prefix := make([]byte, 2, 16)
+	prefix[0], prefix[1] = 0x01, 0x02
+	out, err := cbor.AppendBytes(prefix, tooLong{})
+	assert.ErrorIs(t, err, cbor.ErrRange)
+	assert.Equal(t, []byte{0x01, 0x02}, out)
+	out, err = cbor.AppendBytes(prefix[:2:2], tooLong{})
+	assert.ErrorIs(t, err, cbor.ErrRange)
+	assert.Equal(t, []byte{0x01, 0x02}, out)
+}
+
+func TestShortBuffer(t *testing.T) {
+	value := Required{StringValue: "test", ArrayValue: []int64{1, 2, 3}}
+	var sizer cbor.Sizer
+	require.NoError(t, value.Encode(&sizer))
+
+	encoder := cbor.NewEncoder(make([]byte, 8))
+	err := value.Encode(&encoder)
+	assert.ErrorIs(t, err, cbor.ErrRange)
+	var short cbor.ErrShortBuffer
+	require.ErrorAs(t, err, &short)
+	assert.Equal(t, sizer.Len(), short.Size)
+	assert.Equal(t, sizer.Len(), encoder.Len())
+	assert.Equal(t, sizer.Len()-8, encoder.Needed())
+
+	buffer := make([]byte, short.Size)
+	encoder.Reset(buffer)
+	require.NoError(t, value.Encode(&encoder))
+	assert.Equal(t, uint32(0), encoder.Needed())
+	assert.Equal(t, value.ToBuffer(), buffer)
+}
+
 func TestUint8Range(t *testing.T) {
 	values := []uint8{}
 	for i := int8(0); i <= 7; i++ {
@@ -354,6 +432,66 @@ func TestUint64Range(t *testing.T) {
 	}
 }
 
+func TestHeadSizes(t *testing.T) {
+	for _, tc := range []struct {
+		arg  uint64
+		size int
+	}{
+		{0, 1}, {23, 1}, {24, 2}, {255, 2}, {256, 3}, {65535, 3}, {65536, 5},
+		{math.MaxUint32, 5}, {math.MaxUint32 + 1, 9}, {math.MaxUint64, 9},
+	} {
+		writes := map[string]func(w cbor.Writer){
+			"uint":  func(w cbor.Writer) { w.WriteUint64(tc.arg) },
+			"tag":   func(w cbor.Writer) { w.WriteTag(tc.arg) },
+			"array": func(w cbor.Writer) { w.WriteArraySize(uint32(tc.arg)) },
+			"map":   func(w cbor.Writer) { w.WriteMapSize(uint32(tc.arg)) },
+		}
+		if tc.arg <= math.MaxInt64 {
+			writes["negative"] = func(w cbor.Writer) { w.WriteInt64(-1 - int64(tc.arg)) }
+		}
+		for name, write := range writes {
+			if tc.arg > math.MaxUint32 && (name == "array" || name == "map") {
+				continue
+			}
+			var sizer cbor.Sizer
+			write(&sizer)
+			assert.Equal(t, uint32(tc.size), sizer.Len(), "%s %d", name, tc.arg)
+			buffer := make([]byte, 9)
+			encoder := cbor.NewEncoder(buffer)
+			write(&encoder)
+			require.NoError(t, encoder.CheckError())
+			decoder := cbor.NewDecoder(buffer)
+			head, err := decoder.PeekType()
+			require.NoError(t, err)
+			assert.Equal(t, tc.arg, head.Arg, "%s %d", name, tc.arg)
+			assert.Equal(t, uint8(tc.size), head.HeadLen, "%s %d", name, tc.arg)
+		}
+	}
+
+	for _, n := range []int{23, 24, 255, 256, 65535, 65536} {
+		content := strings.Repeat("x", n)
+		var sizer cbor.Sizer
+		sizer.WriteString(content)
+		sizer.WriteByteArray([]byte(content))
+		buffer := make([]byte, sizer.Len())
+		encoder := cbor.NewEncoder(buffer)
+		encoder.WriteString(content)
+		encoder.WriteByteArray([]byte(content))
+		require.NoError(t, encoder.CheckError(), n)
+		assert.Equal(t, uint32(len(buffer)), encoder.Len(), n)
+	}
+
+	// zero is one byte, not a nine-byte negative integer
+	var sizer cbor.Sizer
+	sizer.WriteInt64(0)
+	assert.Equal(t, uint32(1), sizer.Len())
+	buffer := make([]byte, 1)
+	encoder := cbor.NewEncoder(buffer)
+	encoder.WriteInt64(0)
+	require.NoError(t, encoder.CheckError())
+	assert.Equal(t, []byte{0x00}, buffer)
+}
+
 func TestInt8Range(t *testing.T) {
 	values := []int8{}
 	values = append(values, math.MinInt8)
@@ -463,3 +601,1194 @@ func TestInt64Range(t *testing.T) {
 		assert.Equal(t, expected, actual, "mismatch int64 value")
 	}
 }
+
+func TestSelfDescribe(t *testing.T) {
+	sizer := cbor.NewSizer(cbor.SelfDescribe())
+	sizer.WriteString("test")
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer, cbor.SelfDescribe())
+	encoder.WriteString("test")
+	require.NoError(t, encoder.CheckError())
+	assert.Equal(t, []byte{0xd9, 0xd9, 0xf7, 0x64, 't', 'e', 's', 't'}, buffer)
+	assert.True(t, cbor.IsSelfDescribed(buffer))
+	assert.Equal(t, buffer[3:], cbor.StripSelfDescribed(buffer))
+
+	for _, data := range [][]byte{buffer, buffer[3:]} {
+		decoder := cbor.NewDecoder(data, cbor.StripSelfDescribe())
+		actual, err := decoder.ReadString()
+		require.NoError(t, err)
+		assert.Equal(t, "test", actual)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	inner := func(w cbor.Writer) {
+		w.WriteArraySize(2)
+		w.WriteString("foo")
+		w.WriteInt64(-300)
+	}
+	var sizer cbor.Sizer
+	sizer.WriteEmbedded(inner)
+	sizer.WriteBool(true)
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	encoder.WriteEmbedded(inner)
+	encoder.WriteBool(true)
+	require.NoError(t, encoder.CheckError())
+	assert.Equal(t, []byte{0xd8, 0x18, 0x48, 0x82, 0x63, 'f', 'o', 'o', 0x39, 0x01, 0x2b, 0xf5}, buffer)
+
+	decoder := cbor.NewDecoder(buffer)
+	embedded, err := decoder.ReadEmbedded()
+	require.NoError(t, err)
+	size, _, err := embedded.ReadArraySize()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), size)
+	s, err := embedded.ReadString()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", s)
+	n, err := embedded.ReadInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-300), n)
+	b, err := decoder.ReadBool()
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	decoder = cbor.NewDecoder(buffer)
+	require.NoError(t, decoder.Skip())
+	b, err = decoder.ReadBool()
+	require.NoError(t, err)
+	assert.True(t, b)
+}
+
+func TestTypedArray(t *testing.T) {
+	floats := []float32{1.5, -2, math.MaxFloat32, 0}
+	ints := []int16{math.MinInt16, -1, 0, 1, math.MaxInt16}
+	for _, littleEndian := range []bool{true, false} {
+		var sizer cbor.Sizer
+		sizer.WriteTypedArray(cbor.Float32Array(floats, littleEndian))
+		sizer.WriteTypedArray(cbor.Int16Array(ints, littleEndian))
+		buffer := make([]byte, sizer.Len())
+		encoder := cbor.NewEncoder(buffer)
+		encoder.WriteTypedArray(cbor.Float32Array(floats, littleEndian))
+		encoder.WriteTypedArray(cbor.Int16Array(ints, littleEndian))
+		require.NoError(t, encoder.CheckError())
+
+		decoder := cbor.NewDecoder(buffer)
+		a, err := decoder.ReadTypedArray()
+		require.NoError(t, err)
+		assert.Equal(t, littleEndian, a.IsLittleEndian())
+		assert.True(t, a.IsFloat())
+		assert.Equal(t, len(floats), a.Len())
+		actualFloats, err := a.Float32s()
+		require.NoError(t, err)
+		assert.Equal(t, floats, actualFloats)
+		_, err = a.Float64s()
+		assert.Error(t, err)
+
+		a, err = decoder.ReadTypedArray()
+		require.NoError(t, err)
+		assert.True(t, a.IsSigned())
+		actualInts, err := a.Int16s()
+		require.NoError(t, err)
+		assert.Equal(t, ints, actualInts)
+	}
+
+	buffer := []byte{0xd8, 0x41, 0x44, 0x01, 0x02, 0x03, 0x04}
+	decoder := cbor.NewDecoder(buffer)
+	a, err := decoder.ReadTypedArray()
+	require.NoError(t, err)
+	actual, err := a.Uint16s()
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0x0102, 0x0304}, actual)
+
+	// float16 big endian (tag 80) and little endian (tag 84): 1.0, -2.0, 65504
+	for _, buffer := range [][]byte{
+		{0xd8, 0x50, 0x46, 0x3c, 0x00, 0xc0, 0x00, 0x7b, 0xff},
+		{0xd8, 0x54, 0x46, 0x00, 0x3c, 0x00, 0xc0, 0xff, 0x7b},
+	} {
+		decoder = cbor.NewDecoder(buffer)
+		a, err = decoder.ReadTypedArray()
+		require.NoError(t, err)
+		assert.Equal(t, 2, a.ElemSize())
+		halves, err := a.Float16s()
+		require.NoError(t, err)
+		assert.Equal(t, []float32{1, -2, 65504}, halves)
+		_, err = a.Uint16s()
+		assert.Error(t, err)
+	}
+	_, err = cbor.Float32Array(floats, true).Float16s()
+	assert.Error(t, err)
+
+	// float128 (tag 83) is read as bytes only
+	decoder = cbor.NewDecoder(append([]byte{0xd8, 0x53, 0x50}, make([]byte, 16)...))
+	a, err = decoder.ReadTypedArray()
+	require.NoError(t, err)
+	assert.Equal(t, 1, a.Len())
+	for _, convert := range []func() error{
+		func() error { _, err := a.Float16s(); return err },
+		func() error { _, err := a.Float32s(); return err },
+		func() error { _, err := a.Float64s(); return err },
+	} {
+		assert.ErrorIs(t, convert(), cbor.ErrFloat128)
+	}
+}
+
+func TestSet(t *testing.T) {
+	encode := func(values ...string) []byte {
+		var sizer cbor.Sizer
+		cbor.WriteSetSize(&sizer, uint32(len(values)))
+		for _, v := range values {
+			sizer.WriteString(v)
+		}
+		buffer := make([]byte, sizer.Len())
+		encoder := cbor.NewEncoder(buffer)
+		cbor.WriteSetSize(&encoder, uint32(len(values)))
+		for _, v := range values {
+			encoder.WriteString(v)
+		}
+		require.NoError(t, encoder.CheckError())
+		return buffer
+	}
+
+	var actual []string
+	decoder := cbor.NewDecoder(encode("read", "write"))
+	err := decoder.ReadSet(true, func(d *cbor.Decoder) error {
+		s, err := d.ReadString()
+		actual = append(actual, s)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read", "write"}, actual)
+
+	readString := func(d *cbor.Decoder) error {
+		_, err := d.ReadString()
+		return err
+	}
+	decoder = cbor.NewDecoder(encode("read", "read"))
+	assert.Error(t, decoder.ReadSet(true, readString))
+	decoder = cbor.NewDecoder(encode("read", "read"))
+	assert.NoError(t, decoder.ReadSet(false, readString))
+}
+
+func TestMultiDimArray(t *testing.T) {
+	dims := []uint32{2, 3}
+	var sizer cbor.Sizer
+	require.NoError(t, cbor.WriteMultiDimArraySize(&sizer, dims, false))
+	for i := 0; i < 6; i++ {
+		sizer.WriteInt64(int64(i))
+	}
+	require.NoError(t, cbor.WriteMultiDimTypedArray(&sizer, dims, true, cbor.Uint16Array([]uint16{1, 2, 3, 4, 5, 6}, false)))
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	require.NoError(t, cbor.WriteMultiDimArraySize(&encoder, dims, false))
+	for i := 0; i < 6; i++ {
+		encoder.WriteInt64(int64(i))
+	}
+	require.NoError(t, cbor.WriteMultiDimTypedArray(&encoder, dims, true, cbor.Uint16Array([]uint16{1, 2, 3, 4, 5, 6}, false)))
+	require.NoError(t, encoder.CheckError())
+
+	decoder := cbor.NewDecoder(buffer)
+	actualDims, columnMajor, err := decoder.ReadMultiDimArraySize()
+	require.NoError(t, err)
+	assert.Equal(t, dims, actualDims)
+	assert.False(t, columnMajor)
+	for i := 0; i < 6; i++ {
+		n, err := decoder.ReadInt64()
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), n)
+	}
+	actualDims, columnMajor, a, err := decoder.ReadMultiDimTypedArray()
+	require.NoError(t, err)
+	assert.Equal(t, dims, actualDims)
+	assert.True(t, columnMajor)
+	assert.Equal(t, 6, a.Len())
+
+	// [[2, 2], [1, 2, 3]]
+	decoder = cbor.NewDecoder([]byte{0xd8, 0x28, 0x82, 0x82, 0x02, 0x02, 0x83, 0x01, 0x02, 0x03})
+	_, _, err = decoder.ReadMultiDimArraySize()
+	assert.Error(t, err)
+	// 2^16 * 2^16 elements do not fit an array length
+	sizer = cbor.Sizer{}
+	assert.ErrorIs(t, cbor.WriteMultiDimArraySize(&sizer, []uint32{1 << 16, 1 << 16}, false), cbor.ErrRange)
+	assert.Equal(t, uint32(0), sizer.Len())
+	// the typed array must hold exactly 2 * 3 elements
+	for _, a := range []cbor.TypedArray{
+		cbor.Uint16Array([]uint16{1, 2, 3, 4, 5}, false),
+		cbor.Uint16Array([]uint16{1, 2, 3, 4, 5, 6, 7}, false),
+		cbor.Uint32Array([]uint32{1, 2, 3}, false),
+	} {
+		assert.ErrorIs(t, cbor.WriteMultiDimTypedArray(&sizer, dims, false, a), cbor.ErrRange)
+		assert.Equal(t, uint32(0), sizer.Len())
+	}
+	assert.NoError(t, cbor.WriteMultiDimTypedArray(&sizer, dims, false, cbor.Uint8Array([]uint8{1, 2, 3, 4, 5, 6})))
+	require.NoError(t, cbor.WriteMultiDimArraySize(&sizer, []uint32{1 << 16, 1<<16 - 1}, false))
+}
+
+func TestSimple(t *testing.T) {
+	var sizer cbor.Sizer
+	sizer.WriteArraySize(4)
+	sizer.WriteUndefined()
+	sizer.WriteSimple(16)
+	sizer.WriteSimple(255)
+	sizer.WriteFloat64(1.5)
+	sizer.WriteBool(true)
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	encoder.WriteArraySize(4)
+	encoder.WriteUndefined()
+	encoder.WriteSimple(16)
+	encoder.WriteSimple(255)
+	encoder.WriteFloat64(1.5)
+	encoder.WriteBool(true)
+	require.NoError(t, encoder.CheckError())
+
+	decoder := cbor.NewDecoder(buffer)
+	_, _, err := decoder.ReadArraySize()
+	require.NoError(t, err)
+	isUndefined, err := decoder.IsNextUndefined()
+	require.NoError(t, err)
+	assert.True(t, isUndefined)
+	v, err := decoder.ReadSimple()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(16), v)
+	v, err = decoder.ReadSimple()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(255), v)
+
+	decoder = cbor.NewDecoder(buffer)
+	require.NoError(t, decoder.Skip())
+	b, err := decoder.ReadBool()
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	// the two-byte encoding of 0 to 31 is rejected when read or skipped
+	for _, data := range [][]byte{{0xf8, 0x10}, {0xf8, 0x1f}} {
+		decoder = cbor.NewDecoder(data)
+		_, err = decoder.ReadSimple()
+		assert.ErrorIs(t, err, cbor.ErrInvalidSimple)
+		decoder = cbor.NewDecoder(data)
+		assert.ErrorIs(t, decoder.Skip(), cbor.ErrInvalidSimple)
+	}
+
+	encoder = cbor.NewEncoder(make([]byte, 2))
+	encoder.WriteSimple(24)
+	assert.ErrorIs(t, encoder.CheckError(), cbor.ErrInvalidSimple)
+
+	// the Sizer rejects the reserved values 24 to 31 as the Encoder does
+	for _, value := range []uint8{24, 31} {
+		sizer = cbor.Sizer{}
+		sizer.WriteSimple(value)
+		assert.ErrorIs(t, sizer.CheckError(), cbor.ErrInvalidSimple, value)
+		assert.Equal(t, uint32(0), sizer.Len())
+		sizer.Reset()
+		assert.NoError(t, sizer.CheckError())
+	}
+	sizer = cbor.Sizer{}
+	sizer.WriteEmbedded(func(w cbor.Writer) { w.WriteSimple(30) })
+	assert.ErrorIs(t, sizer.CheckError(), cbor.ErrInvalidSimple)
+	_, err = cbor.ToBytes(invalidSimple{})
+	assert.ErrorIs(t, err, cbor.ErrInvalidSimple)
+}
+
+type invalidSimple struct{}
+
+func (invalidSimple) Encode(w cbor.Writer) error {
+	w.WriteSimple(25)
+	return nil
+}
+
+func TestFieldTable(t *testing.T) {
+	table := cbor.NewFieldTable(cbor.IntKey(1), cbor.TextKey("name"), cbor.IntKey(-300))
+	write := func(w cbor.Writer) {
+		w.WriteMapSize(5)
+		table.WriteKey(w, 2)
+		w.WriteBool(true)
+		w.WriteString("unknown")
+		w.WriteArraySize(1)
+		w.WriteNil()
+		table.WriteKey(w, 1)
+		w.WriteString("x")
+		w.WriteBool(false)
+		w.WriteNil()
+		w.WriteUint64(math.MaxUint64)
+		w.WriteNil()
+	}
+	var sizer cbor.Sizer
+	write(&sizer)
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	write(&encoder)
+	require.NoError(t, encoder.CheckError())
+
+	decoder := cbor.NewDecoder(buffer)
+	size, _, err := decoder.ReadMapSize()
+	require.NoError(t, err)
+	var fields []int
+	for ; size > 0; size-- {
+		field, err := table.ReadKey(&decoder)
+		require.NoError(t, err)
+		fields = append(fields, field)
+		require.NoError(t, decoder.Skip())
+	}
+	assert.Equal(t, []int{2, -1, 1, -1, -1}, fields)
+
+	// unknown keys and values of indefinite length:
+	// {[_ 1]: 1, "unknown": [[_ 1], (_ "x")], 1: 2}
+	decoder = cbor.NewDecoder([]byte{0xa3, 0x9f, 0x01, 0xff, 0x01,
+		0x67, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x82, 0x9f, 0x01, 0xff, 0x7f, 0x61, 'x', 0xff,
+		0x01, 0x02})
+	size, _, err = decoder.ReadMapSize()
+	require.NoError(t, err)
+	fields = nil
+	for ; size > 0; size-- {
+		field, err := table.ReadKey(&decoder)
+		require.NoError(t, err)
+		fields = append(fields, field)
+		require.NoError(t, decoder.Skip())
+	}
+	assert.Equal(t, []int{-1, -1, 0}, fields)
+	assert.True(t, decoder.Done())
+}
+
+func TestArrayFields(t *testing.T) {
+	read := func(data []byte) (a, b string, err error) {
+		decoder := cbor.NewDecoder(data)
+		fields, err := decoder.ReadArrayFields()
+		if err != nil {
+			return "", "", err
+		}
+		if ok, err := fields.Next(); err != nil {
+			return "", "", err
+		} else if ok {
+			if a, err = decoder.ReadString(); err != nil {
+				return "", "", err
+			}
+		}
+		if ok, err := fields.Next(); err != nil {
+			return "", "", err
+		} else if ok {
+			if b, err = decoder.ReadString(); err != nil {
+				return "", "", err
+			}
+		}
+		if err = fields.Finish(); err != nil {
+			return "", "", err
+		}
+		// the array must be fully consumed
+		_, err = decoder.ReadBool()
+		return a, b, err
+	}
+
+	for _, tc := range []struct {
+		data []byte
+		a, b string
+	}{
+		{[]byte{0x82, 0x61, 'a', 0x61, 'b', 0xf5}, "a", "b"},
+		{[]byte{0x81, 0x61, 'a', 0xf5}, "a", ""},
+		{[]byte{0x80, 0xf5}, "", ""},
+		{[]byte{0x83, 0x61, 'a', 0x61, 'b', 0x81, 0x01, 0xf5}, "a", "b"},
+		{[]byte{0x9f, 0x61, 'a', 0xff, 0xf5}, "a", ""},
+		{[]byte{0x9f, 0x61, 'a', 0x61, 'b', 0x01, 0x02, 0xff, 0xf5}, "a", "b"},
+		{[]byte{0x84, 0x61, 'a', 0x61, 'b', 0x82, 0x9f, 0x01, 0xff, 0x01, 0x7f, 0x61, 'x', 0xff, 0xf5}, "a", "b"},
+	} {
+		a, b, err := read(tc.data)
+		require.NoError(t, err)
+		assert.Equal(t, tc.a, a)
+		assert.Equal(t, tc.b, b)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	decoder := cbor.NewDecoder([]byte{0x01, 0x61, 'a'})
+	assert.Equal(t, uint32(3), decoder.Remaining())
+	assert.False(t, decoder.Done())
+	_, err := decoder.ReadUint8()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), decoder.Remaining())
+	_, err = decoder.ReadString()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), decoder.Remaining())
+	assert.True(t, decoder.Done())
+}
+
+func TestPeekType(t *testing.T) {
+	for _, tc := range []struct {
+		data     []byte
+		expected cbor.ItemType
+	}{
+		{[]byte{0x17}, cbor.ItemType{Major: cbor.TypeMajorUnsigned, Arg: 23, HeadLen: 1}},
+		{[]byte{0x39, 0x01, 0x00}, cbor.ItemType{Major: cbor.TypeMajorSigned, Arg: 256, HeadLen: 3}},
+		{[]byte{0x5f}, cbor.ItemType{Major: cbor.TypeMajorBytes, Indefinite: true, HeadLen: 1}},
+		{[]byte{0x78, 0x20}, cbor.ItemType{Major: cbor.TypeMajorText, Arg: 32, HeadLen: 2}},
+		{[]byte{0xbb, 0, 0, 0, 1, 0, 0, 0, 0}, cbor.ItemType{Major: cbor.TypeMajorMap, Arg: 1 << 32, HeadLen: 9}},
+		{[]byte{0xd9, 0xd9, 0xf7}, cbor.ItemType{Major: cbor.TypeMajorTagged, Arg: cbor.TagSelfDescribed, HeadLen: 3}},
+		{[]byte{0xf6}, cbor.ItemType{Major: cbor.TypeMajorSimple, Simple: cbor.SimpleValue, Arg: 22, HeadLen: 1}},
+		{[]byte{0xf9, 0x3c, 0x00}, cbor.ItemType{Major: cbor.TypeMajorSimple, Simple: cbor.SimpleFloat16, Arg: 0x3c00, HeadLen: 3}},
+		{[]byte{0xff}, cbor.ItemType{Major: cbor.TypeMajorSimple, Simple: cbor.SimpleBreak, HeadLen: 1}},
+	} {
+		decoder := cbor.NewDecoder(tc.data)
+		actual, err := decoder.PeekType()
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, actual)
+		assert.Equal(t, uint32(0), decoder.Pos(), "PeekType must not consume input")
+	}
+
+	decoder := cbor.NewDecoder([]byte{0xf6})
+	head, err := decoder.PeekType()
+	require.NoError(t, err)
+	assert.True(t, head.IsNull())
+
+	for _, data := range [][]byte{{0x1c}, {0x1f}, {0xf8, 0x10}, {0x19, 0x01}, {}} {
+		decoder := cbor.NewDecoder(data)
+		_, err := decoder.PeekType()
+		assert.Error(t, err)
+	}
+}
+
+func TestReadOwnership(t *testing.T) {
+	buffer := []byte{0x63, 'a', 'b', 'c', 0x43, 0x01, 0x02, 0x03, 0x43, 0x01, 0x02, 0x03}
+	decoder := cbor.NewDecoder(buffer)
+	s, err := decoder.ReadStringUnsafe()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", s)
+	alias, err := decoder.ReadBytesNoCopy()
+	require.NoError(t, err)
+	owned, err := decoder.ReadByteArrayCopy()
+	require.NoError(t, err)
+
+	buffer[1] = 'x'
+	buffer[5] = 0xff
+	buffer[9] = 0xff
+	assert.Equal(t, "xbc", s, "unsafe string shares the buffer")
+	assert.Equal(t, []byte{0xff, 0x02, 0x03}, alias, "no-copy bytes share the buffer")
+	assert.Equal(t, []byte{0x01, 0x02, 0x03}, owned, "copied bytes are owned")
+}
+
+func TestReset(t *testing.T) {
+	encoder := cbor.NewEncoder(make([]byte, 1), cbor.SelfDescribe())
+	encoder.WriteString("too long")
+	assert.Error(t, encoder.CheckError())
+
+	buffer := make([]byte, 5)
+	encoder.Reset(buffer)
+	require.NoError(t, encoder.CheckError())
+	encoder.WriteString("a")
+	require.NoError(t, encoder.CheckError())
+	assert.Equal(t, []byte{0xd9, 0xd9, 0xf7, 0x61, 'a'}, buffer)
+
+	sizer := cbor.NewSizer(cbor.SelfDescribe())
+	sizer.WriteString("a")
+	sizer.Reset()
+	sizer.WriteString("a")
+	assert.Equal(t, uint32(5), sizer.Len())
+
+	var decoder cbor.Decoder
+	for _, data := range [][]byte{{0x01}, {0x02}} {
+		decoder.Reset(data)
+		n, err := decoder.ReadUint8()
+		require.NoError(t, err)
+		assert.Equal(t, data[0], n)
+		_, err = decoder.ReadUint8()
+		assert.Error(t, err)
+	}
+
+	decoder = cbor.NewDecoder(nil, cbor.StripSelfDescribe())
+	decoder.Reset(buffer)
+	s, err := decoder.ReadString()
+	require.NoError(t, err)
+	assert.Equal(t, "a", s)
+}
+
+func BenchmarkEncoderReuse(b *testing.B) {
+	value := Required{StringValue: "test", ArrayValue: []int64{1, 2, 3}}
+	var sizer cbor.Sizer
+	_ = value.Encode(&sizer)
+	buffer := make([]byte, sizer.Len())
+	var encoder cbor.Encoder
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encoder.Reset(buffer)
+		_ = value.Encode(&encoder)
+	}
+}
+
+// encodeWith sizes and encodes the items written by write.
+func encodeWith(t *testing.T, write func(w cbor.Writer)) []byte {
+	t.Helper()
+	var sizer cbor.Sizer
+	write(&sizer)
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	write(&encoder)
+	require.NoError(t, encoder.CheckError())
+	return buffer
+}
+
+func TestSkip(t *testing.T) {
+	for _, tc := range []struct {
+		hex string
+		err bool
+	}{
+		{hex: "01"},
+		{hex: "3903e7"},
+		{hex: "fb3ff8000000000000"},
+		{hex: "f820"},
+		{hex: "c1 1a5610d9f0"},
+		{hex: "db0000000100000000 d9ffff 01"},
+		{hex: "d9d9f7 d818 42 0102"},
+		{hex: "83 01 82 02 03 a1 04 05"},
+		// indefinite length items nested in definite ones
+		{hex: "82 82 9f 01 ff 01 01"},
+		{hex: "a2 61 61 bf 01 9f ff ff 61 62 01"},
+		{hex: "82 9f 9f 9f ff ff ff 01"},
+		// chunked strings
+		{hex: "82 7f 61 61 62 62 63 ff 01"},
+		{hex: "a1 5f 41 01 40 ff 5f ff"},
+		// indefinite length items holding definite ones
+		{hex: "9f 82 01 02 a1 03 04 ff"},
+		{hex: "ff", err: true},
+		{hex: "82 01 ff", err: true},
+		{hex: "7f 41 01 ff", err: true},
+		{hex: "7f 7f ff ff", err: true},
+		{hex: "9f 01", err: true},
+		{hex: "83 01 02", err: true},
+		{hex: "9bffffffffffffffff 01", err: true},
+		{hex: "bbffffffffffffffff 01", err: true},
+		{hex: "5a00000002 01", err: true},
+		{hex: "c1", err: true},
+		{hex: "f810", err: true},
+		{hex: "82 01 f81f", err: true},
+	} {
+		data, err := hex.DecodeString(strings.ReplaceAll(tc.hex, " ", ""))
+		require.NoError(t, err)
+		decoder := cbor.NewDecoder(data)
+		err = decoder.Skip()
+		if tc.err {
+			assert.Error(t, err, tc.hex)
+			continue
+		}
+		require.NoError(t, err, tc.hex)
+		assert.True(t, decoder.Done(), tc.hex)
+	}
+
+	// nesting takes no stack
+	deep := append(bytes.Repeat([]byte{0x81}, 1000000), 0x01)
+	decoder := cbor.NewDecoder(deep)
+	require.NoError(t, decoder.Skip())
+	assert.True(t, decoder.Done())
+}
+
+func TestLookup(t *testing.T) {
+	msg := encodeWith(t, func(w cbor.Writer) {
+		w.WriteMapSize(3)
+		w.WriteString("body")
+		w.WriteTag(cbor.TagSet)
+		w.WriteArraySize(3)
+		w.WriteUint8(1)
+		w.WriteString("two")
+		w.WriteUint8(3)
+		w.WriteInt8(-1)
+		w.WriteBool(true)
+		w.WriteString("headers")
+		w.WriteMapSize(2)
+		w.WriteString("accept")
+		w.WriteString("*/*")
+		w.WriteString("content-type")
+		w.WriteString("text/plain")
+	})
+
+	raw, err := cbor.Lookup(msg, cbor.PathKey("headers"), cbor.PathKey("content-type"))
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0x6a}, "text/plain"...), raw)
+
+	raw, err = cbor.Lookup(msg, cbor.PathIntKey(-1))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{cbor.TypeBoolTrue}, raw)
+
+	decoder := cbor.NewDecoder(msg)
+	require.NoError(t, decoder.Lookup(cbor.PathKey("body"), cbor.PathIndex(1)))
+	s, err := decoder.ReadString()
+	require.NoError(t, err)
+	assert.Equal(t, "two", s)
+
+	raw, err = cbor.Lookup(msg)
+	require.NoError(t, err)
+	assert.Equal(t, msg, raw)
+
+	_, err = cbor.Lookup(msg, cbor.PathKey("body"), cbor.PathIndex(3))
+	assert.ErrorIs(t, err, cbor.ErrNotFound)
+	_, err = cbor.Lookup(msg, cbor.PathKey("missing"))
+	assert.ErrorIs(t, err, cbor.ErrNotFound)
+	_, err = cbor.Lookup(msg, cbor.PathIndex(0))
+	assert.Error(t, err)
+
+	// indefinite length map
+	raw, err = cbor.Lookup([]byte{0xbf, 0x01, 0x02, 0x03, 0x04, 0xff}, cbor.PathIntKey(3))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x04}, raw)
+	_, err = cbor.Lookup([]byte{0xbf, 0x01, 0x02, 0xff}, cbor.PathIntKey(3))
+	assert.ErrorIs(t, err, cbor.ErrNotFound)
+
+	// skipping indefinite length items nested in definite ones:
+	// {"a": [[_ 1], 1], "b": 1} and {"a": (_ "x"), "b": 1}
+	for _, data := range [][]byte{
+		{0xa2, 0x61, 'a', 0x82, 0x9f, 0x01, 0xff, 0x01, 0x61, 'b', 0x01},
+		{0xa2, 0x61, 'a', 0x7f, 0x61, 'x', 0xff, 0x61, 'b', 0x01},
+	} {
+		raw, err = cbor.Lookup(data, cbor.PathKey("b"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x01}, raw)
+	}
+	raw, err = cbor.Lookup([]byte{0x82, 0x82, 0xbf, 0xff, 0x01, 0x02}, cbor.PathIndex(1))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, raw)
+}
+
+func TestPatch(t *testing.T) {
+	msg := encodeWith(t, func(w cbor.Writer) {
+		w.WriteMapSize(2)
+		w.WriteString("headers")
+		w.WriteMapSize(1)
+		w.WriteString("accept")
+		w.WriteString("*/*")
+		w.WriteString("body")
+		w.WriteArraySize(2)
+		w.WriteUint8(1)
+		w.WriteUint8(2)
+	})
+	headers := []cbor.PathElem{cbor.PathKey("headers"), cbor.PathKey("trace-id")}
+
+	calls := 0
+	patched, err := cbor.SetAt(msg, headers, func(w cbor.Writer) {
+		calls++
+		w.WriteString("abc")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "value sizes, then encodes")
+	assert.Equal(t, encodeWith(t, func(w cbor.Writer) {
+		w.WriteMapSize(2)
+		w.WriteString("headers")
+		w.WriteMapSize(2)
+		w.WriteString("accept")
+		w.WriteString("*/*")
+		w.WriteString("trace-id")
+		w.WriteString("abc")
+		w.WriteString("body")
+		w.WriteArraySize(2)
+		w.WriteUint8(1)
+		w.WriteUint8(2)
+	}), patched)
+
+	replaced, err := cbor.SetAt(patched, headers, func(w cbor.Writer) { w.WriteString("xyz") })
+	require.NoError(t, err)
+	raw, err := cbor.Lookup(replaced, headers...)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x63, 'x', 'y', 'z'}, raw)
+	assert.Equal(t, len(patched), len(replaced))
+
+	deleted, err := cbor.DeleteAt(patched, headers...)
+	require.NoError(t, err)
+	assert.Equal(t, msg, deleted)
+
+	appended, err := cbor.SetAt(msg, []cbor.PathElem{cbor.PathKey("body"), cbor.PathIndex(2)}, func(w cbor.Writer) { w.WriteUint8(3) })
+	require.NoError(t, err)
+	raw, err = cbor.Lookup(appended, cbor.PathKey("body"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x83, 0x01, 0x02, 0x03}, raw)
+
+	shortened, err := cbor.DeleteAt(msg, cbor.PathKey("body"), cbor.PathIndex(0))
+	require.NoError(t, err)
+	raw, err = cbor.Lookup(shortened, cbor.PathKey("body"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x81, 0x02}, raw)
+
+	_, err = cbor.DeleteAt(msg, cbor.PathKey("missing"))
+	assert.ErrorIs(t, err, cbor.ErrNotFound)
+	_, err = cbor.SetAt(msg, []cbor.PathElem{cbor.PathKey("body"), cbor.PathIndex(5)}, func(w cbor.Writer) { w.WriteNil() })
+	assert.ErrorIs(t, err, cbor.ErrNotFound)
+
+	// indefinite length maps keep their head
+	indef := []byte{0xbf, 0x01, 0x02, 0xff}
+	patched, err = cbor.SetAt(indef, []cbor.PathElem{cbor.PathIntKey(3)}, func(w cbor.Writer) { w.WriteUint8(4) })
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xbf, 0x01, 0x02, 0x03, 0x04, 0xff}, patched)
+	deleted, err = cbor.DeleteAt(patched, cbor.PathIntKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xbf, 0x03, 0x04, 0xff}, deleted)
+
+	// entries before the target hold indefinite length items:
+	// {"a": [[_ 1], (_ "x")], "b": 1}
+	nested := []byte{0xa2, 0x61, 'a', 0x82, 0x9f, 0x01, 0xff, 0x7f, 0x61, 'x', 0xff, 0x61, 'b', 0x01}
+	deleted, err = cbor.DeleteAt(nested, cbor.PathKey("b"))
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0xa1}, nested[1:11]...), deleted)
+	patched, err = cbor.SetAt(nested, []cbor.PathElem{cbor.PathKey("b")}, func(w cbor.Writer) { w.WriteUint8(2) })
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, nested[:13]...), 0x02), patched)
+}
+
+func TestToJSON(t *testing.T) {
+	for _, tc := range []struct {
+		hex  string
+		json string
+	}{
+		{"00", "0"},
+		{"1bffffffffffffffff", "18446744073709551615"},
+		{"3bffffffffffffffff", "-18446744073709551616"},
+		{"29", "-10"},
+		{"f93c00", "1"},
+		{"f97bff", "65504"},
+		{"fa47c35000", "100000"},
+		{"fb3ff199999999999a", "1.1"},
+		{"f97c00", "null"},
+		{"f4", "false"},
+		{"f5", "true"},
+		{"f6", "null"},
+		{"f7", "null"},
+		{"f0", "null"},
+		{"4401020304", `"AQIDBA"`},
+		{"d74401020304", `"01020304"`},
+		{"d6434dfbff", `"Tfv/"`},
+		{"c249010000000000000000", `"AQAAAAAAAAAA"`},
+		{"c349010000000000000000", `"~AQAAAAAAAAAA"`},
+		{"c074323031332d30332d32315432303a30343a30305a", `"2013-03-21T20:04:00Z"`},
+		{"62225c", `"\"\\"`},
+		{"6201ff", `"\u0001�"`},
+		{"7f657374726561646d696e67ff", `"streaming"`},
+		{"5f42010243030405ff", `"AQIDBAU"`},
+		{"83010203", "[1,2,3]"},
+		{"9f018202039f0405ffff", "[1,[2,3],[4,5]]"},
+		{"a201020304", `{"1":2,"3":4}`},
+		{"a2616101f502", `{"a":1,"true":2}`},
+		{"a182010203", `{"[1,2]":3}`},
+		{"a1420102f6", `{"AQI":null}`},
+		{"bf6346756ef563416d7421ff", `{"Fun":true,"Amt":-2}`},
+	} {
+		data, err := hex.DecodeString(tc.hex)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, cbor.ToJSON(data, &out, cbor.ToJSONOptions{}), tc.hex)
+		assert.Equal(t, tc.json, out.String(), tc.hex)
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, cbor.ToJSON([]byte{0x83, 0xf9, 0x7e, 0x00, 0xf9, 0x7c, 0x00, 0xf9, 0xfc, 0x00}, &out,
+		cbor.ToJSONOptions{NonFinite: cbor.NonFiniteString}))
+	assert.Equal(t, `["NaN","Infinity","-Infinity"]`, out.String())
+	err := cbor.ToJSON([]byte{0xf9, 0x7e, 0x00}, &out, cbor.ToJSONOptions{NonFinite: cbor.NonFiniteError})
+	assert.ErrorIs(t, err, cbor.ErrNonFinite)
+	err = cbor.ToJSON([]byte{0x01, 0x02}, &out, cbor.ToJSONOptions{})
+	assert.ErrorIs(t, err, cbor.ErrTrailingData)
+}
+
+func TestWriteFloat(t *testing.T) {
+	for _, tc := range []struct {
+		value float64
+		hex   string
+	}{
+		{0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1, "f93c00"},
+		{1.5, "f93e00"},
+		{65504, "f97bff"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{100000, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{1.1, "fb3ff199999999999a"},
+		{math.Inf(1), "f97c00"},
+		{math.Inf(-1), "f9fc00"},
+		{math.NaN(), "f97e00"},
+	} {
+		data := encodeWith(t, func(w cbor.Writer) { w.WriteFloat(tc.value) })
+		assert.Equal(t, tc.hex, hex.EncodeToString(data), "%v", tc.value)
+		decoder := cbor.NewDecoder(data)
+		f, err := decoder.ReadFloat64()
+		require.NoError(t, err)
+		if math.IsNaN(tc.value) {
+			assert.True(t, math.IsNaN(f))
+		} else {
+			assert.Equal(t, tc.value, f)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		hex  string
+	}{
+		{"0", "00"},
+		{"-1", "20"},
+		{"1000000", "1a000f4240"},
+		{"18446744073709551615", "1bffffffffffffffff"},
+		{"-9223372036854775808", "3b7fffffffffffffff"},
+		{"1.5", "f93e00"},
+		{"1e3", "f963d0"},
+		{"1.1", "fb3ff199999999999a"},
+		{"18446744073709551616", "fa5f800000"},
+		{`"aü"`, "6361c3bc"},
+		{"[true,false,null,[]]", "84f5f4f680"},
+		{`{"a":1,"b":[2,3],"c":{}}`, "a3616101616282020361 63a0"},
+	} {
+		data, err := cbor.FromJSONBytes([]byte(tc.json), cbor.FromJSONOptions{})
+		require.NoError(t, err, tc.json)
+		assert.Equal(t, strings.ReplaceAll(tc.hex, " ", ""), hex.EncodeToString(data), tc.json)
+	}
+
+	data, err := cbor.FromJSONBytes([]byte("[18446744073709551616,-18446744073709551617]"), cbor.FromJSONOptions{BigNums: true})
+	require.NoError(t, err)
+	assert.Equal(t, "82c249010000000000000000c349010000000000000000", hex.EncodeToString(data))
+
+	var out bytes.Buffer
+	require.NoError(t, cbor.ToJSON(data, &out, cbor.ToJSONOptions{}))
+	assert.Equal(t, `["AQAAAAAAAAAA","~AQAAAAAAAAAA"]`, out.String())
+
+	var sizer cbor.Sizer
+	require.NoError(t, cbor.FromJSON(strings.NewReader(`{"k":[1,2.5]}`), &sizer, cbor.FromJSONOptions{}))
+	assert.Equal(t, uint32(8), sizer.Len())
+
+	_, err = cbor.FromJSONBytes([]byte("1 2"), cbor.FromJSONOptions{})
+	assert.ErrorIs(t, err, cbor.ErrTrailingData)
+	_, err = cbor.FromJSONBytes([]byte("[1,"), cbor.FromJSONOptions{})
+	assert.Error(t, err)
+}
+
+func TestMsgPack(t *testing.T) {
+	// back is what ToMsgPack writes for cbor
+	for _, tc := range []struct {
+		msgpack string
+		cbor    string
+		back    string
+	}{
+		{"00", "00", "00"},
+		{"7f", "187f", "7f"},
+		{"ff", "20", "ff"},
+		{"d0df", "3820", "d0df"},
+		{"cd0100", "190100", "cd0100"},
+		{"d3ffffffffffffff00", "38ff", "d1ff00"}, // int64 -256 fits in int16
+		{"cc05", "05", "05"},                     // uint8 5 fits in a fixint
+		{"cfffffffffffffffff", "1bffffffffffffffff", "cfffffffffffffffff"},
+		{"c0", "f6", "c0"},
+		{"c2", "f4", "c2"},
+		{"c3", "f5", "c3"},
+		{"ca3fc00000", "fa3fc00000", "ca3fc00000"},
+		{"cb3ff199999999999a", "fb3ff199999999999a", "cb3ff199999999999a"},
+		{"a3616263", "63616263", "a3616263"},
+		{"c4020102", "420102", "c4020102"},
+		{"93010203", "83010203", "93010203"},
+		{"82a16101a16292c0c3", "a2616101616282f6f5", "82a16101a16292c0c3"},
+		{"d6ff5f5e1000", "c11a5f5e1000", "d6ff5f5e1000"},
+		{"d40701", "da6d73677082074101", "d40701"},
+		{"c70305010203", "da6d7367708205 43010203", "c70305010203"},
+	} {
+		msgpack, err := hex.DecodeString(tc.msgpack)
+		require.NoError(t, err)
+		data, err := cbor.FromMsgPackBytes(msgpack)
+		require.NoError(t, err, tc.msgpack)
+		assert.Equal(t, strings.ReplaceAll(tc.cbor, " ", ""), hex.EncodeToString(data), tc.msgpack)
+
+		back, err := cbor.ToMsgPack(data)
+		require.NoError(t, err, tc.msgpack)
+		assert.Equal(t, tc.back, hex.EncodeToString(back), tc.msgpack)
+	}
+
+	// timestamp with nanoseconds is kept as an extension
+	ts := []byte{0xd7, 0xff, 0x00, 0x00, 0x00, 0x04, 0x5f, 0x5e, 0x10, 0x00}
+	data, err := cbor.FromMsgPackBytes(ts)
+	require.NoError(t, err)
+	back, err := cbor.ToMsgPack(data)
+	require.NoError(t, err)
+	assert.Equal(t, ts, back)
+
+	// CBOR only items
+	for _, tc := range []struct {
+		cbor    string
+		msgpack string
+	}{
+		{"9f0102ff", "920102"},
+		{"9f9f01ffbf61619fffff02ff", "93910181a1619002"}, // [_ [_ 1], {_ "a": [_]}, 2]
+		{"829f9f01ffff9f02ff", "929191019102"},           // [[_ [_ 1]], [_ 2]]
+		{"bf6161f5ff", "81a161c3"},
+		{"f93c00", "ca3f800000"},
+		{"f7", "c0"},
+		{"c1fb41d7d784000c0000", "d7ff2cb417805f5e1000"}, // 1600000000.1875
+		{"d9010301", "01"},
+	} {
+		data, err := hex.DecodeString(tc.cbor)
+		require.NoError(t, err)
+		msgpack, err := cbor.ToMsgPack(data)
+		require.NoError(t, err, tc.cbor)
+		assert.Equal(t, tc.msgpack, hex.EncodeToString(msgpack), tc.cbor)
+	}
+
+	_, err = cbor.ToMsgPack([]byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Error(t, err)
+	_, err = cbor.ToMsgPack([]byte{0x9f, 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.ErrorIs(t, err, cbor.ErrRange)
+	_, err = cbor.ToMsgPack([]byte{0x9f, 0x82, 0x01, 0xff})
+	assert.Error(t, err)
+	_, err = cbor.FromMsgPackBytes([]byte{0xc1})
+	assert.Error(t, err)
+	_, err = cbor.FromMsgPackBytes([]byte{0xa2, 0xc3, 0x28})
+	assert.EqualError(t, err, "invalid UTF-8 in MessagePack string")
+	_, err = cbor.FromMsgPackBytes([]byte{0xd9, 0x01, 0xff})
+	assert.Error(t, err)
+	_, err = cbor.FromMsgPackBytes([]byte{0x01, 0x02})
+	assert.ErrorIs(t, err, cbor.ErrTrailingData)
+}
+
+func TestAnnotate(t *testing.T) {
+	data, err := hex.DecodeString("a3666e6573746564f50138806161781861" +
+		"20736f6d6577686174206c6f6e67657220737472696e67" +
+		"9f4201025fff80ff" + "c11a5f5e1000")
+	require.NoError(t, err)
+	listing, err := cbor.Annotate(data)
+	require.NoError(t, err)
+	assert.Equal(t, `000000  a3                                    # map(3)
+000001    66 6e6573746564                     # text(6) "nested"
+000008    f5                                  # true
+000009    01                                  # unsigned(1)
+00000a    38 80                               # negative(-129)
+00000c    61 61                               # text(1) "a"
+00000e    78 18                               # text(24)
+000010      6120736f6d6577686174206c6f6e6765  # "a somewhat longe"
+000020      7220737472696e67                  # "r string"
+000028  9f                                    # array(*)
+000029    42 0102                             # bytes(2) h'0102'
+00002c    5f                                  # bytes(*)
+00002d    ff                                  # break
+00002e    80                                  # array(0)
+00002f  ff                                    # break
+000030  c1                                    # tag(1) epoch date/time
+000031    1a 5f5e1000                         # unsigned(1600000000)
+`, listing)
+
+	listing, err = cbor.Annotate([]byte{0x82, 0xf9, 0x3e, 0x00})
+	assert.Error(t, err)
+	assert.Equal(t, "000000  82         # array(2)\n000001    f9 3e00  # float16(1.5)\n", listing)
+}
+
+func TestDiag(t *testing.T) {
+	for _, tc := range []struct {
+		hex  string
+		diag string
+	}{
+		{"00", "0"},
+		{"3bffffffffffffffff", "-18446744073709551616"},
+		{"f93c00", "1.0"},
+		{"f97e00", "NaN"},
+		{"f9fc00", "-Infinity"},
+		{"fa47c35000", "100000.0"},
+		{"fb7e37e43c8800759c", "1.0e+300"},
+		{"fb3ff199999999999a", "1.1"},
+		{"f7", "undefined"},
+		{"f0", "simple(16)"},
+		{"4401020304", "h'01020304'"},
+		{"62225c", `"\"\\"`},
+		{"c074323031332d30332d32315432303a30343a30305a", `0("2013-03-21T20:04:00Z")`},
+		{"83010203", "[1, 2, 3]"},
+		{"a201020304", "{1: 2, 3: 4}"},
+		{"9f018202039f0405ffff", "[_ 1, [2, 3], [_ 4, 5]]"},
+		{"bf6346756ef563416d7421ff", `{_ "Fun": true, "Amt": -2}`},
+		{"5f42010243030405ff", "(_ h'0102', h'030405')"},
+		{"7f657374726561646d696e67ff", `(_ "strea", "ming")`},
+	} {
+		data, err := hex.DecodeString(tc.hex)
+		require.NoError(t, err)
+		diag, err := cbor.Diag(data)
+		require.NoError(t, err, tc.hex)
+		assert.Equal(t, tc.diag, diag, tc.hex)
+	}
+
+	_, err := cbor.Diag([]byte{0x5f, 0x61, 0x61, 0xff})
+	assert.Error(t, err)
+	_, err = cbor.Diag([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		hex    string
+		limits cbor.Limits
+		err    string
+	}{
+		{"a2616101616282f6f5", cbor.Limits{}, ""},
+		{"a2616101616282f6f5", cbor.Limits{MaxDepth: 2, MaxLength: 2, MaxItems: 7}, ""},
+		{"a2616101616282f6f5", cbor.Limits{MaxDepth: 1}, "nesting too deep at offset 6"},
+		{"a2616101616282f6f5", cbor.Limits{MaxLength: 1}, "length 2 over limit at offset 0"},
+		{"a2616101616282f6f5", cbor.Limits{MaxItems: 6}, "too many items at offset 8"},
+		{"62c328", cbor.Limits{}, "invalid UTF-8 in text string at offset 0"},
+		{"5f4101ff", cbor.Limits{}, ""},
+		{"5f6101ff", cbor.Limits{}, "invalid chunk in indefinite length string at offset 1"},
+		{"bf01ff", cbor.Limits{}, "map key without a value at offset 2"},
+		{"8201ff", cbor.Limits{}, "unexpected break at offset 2"},
+		{"1c", cbor.Limits{}, "reserved additional information at offset 0"},
+		{"f818", cbor.Limits{}, "invalid simple value at offset 0"},
+		{"6461", cbor.Limits{}, "string longer than the data at offset 0"},
+		{"0101", cbor.Limits{}, "trailing data after item at offset 1"},
+	} {
+		data, err := hex.DecodeString(tc.hex)
+		require.NoError(t, err)
+		err = cbor.Validate(data, tc.limits)
+		if tc.err == "" {
+			assert.NoError(t, err, tc.hex)
+		} else {
+			assert.EqualError(t, err, tc.err, tc.hex)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	nested := func(n int) []byte {
+		return append(bytes.Repeat([]byte{0x81}, n), 0x01)
+	}
+	tagged := func(n int) []byte {
+		return append(bytes.Repeat([]byte{0xc1}, n), 0x01)
+	}
+	msgpack := func(n int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, n), 0x01)
+	}
+	convert := map[string]func([]byte) error{
+		"Validate": func(b []byte) error { return cbor.Validate(b, cbor.Limits{}) },
+		"Diag": func(b []byte) error {
+			_, err := cbor.Diag(b)
+			return err
+		},
+		"Annotate": func(b []byte) error {
+			_, err := cbor.Annotate(b)
+			return err
+		},
+		"ToJSON": func(b []byte) error { return cbor.ToJSON(b, &bytes.Buffer{}, cbor.ToJSONOptions{}) },
+		"Canonical": func(b []byte) error {
+			_, err := cbor.Canonical(b)
+			return err
+		},
+		"ToMsgPack": func(b []byte) error {
+			_, err := cbor.ToMsgPack(b)
+			return err
+		},
+	}
+	for name, f := range convert {
+		for _, data := range [][]byte{nested(cbor.DefaultMaxDepth), tagged(cbor.DefaultMaxDepth)} {
+			assert.NoError(t, f(data), name)
+		}
+		// far deeper than the stack would allow
+		for _, data := range [][]byte{nested(cbor.DefaultMaxDepth + 1), tagged(cbor.DefaultMaxDepth + 1), nested(10000000)} {
+			err := f(data)
+			if assert.Error(t, err, name) && name != "Validate" {
+				assert.ErrorIs(t, err, cbor.ErrTooDeep, name)
+			}
+		}
+	}
+	_, err := cbor.FromMsgPackBytes(msgpack(cbor.DefaultMaxDepth))
+	assert.NoError(t, err)
+	_, err = cbor.FromMsgPackBytes(msgpack(10000000))
+	assert.ErrorIs(t, err, cbor.ErrTooDeep)
+
+	assert.EqualError(t, cbor.Validate(nested(3), cbor.Limits{MaxDepth: 2}), "nesting too deep at offset 2")
+}
+
+func TestCanonical(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out string
+	}{
+		{"1b0000000000000001", "01"},
+		{"fb3ff8000000000000", "f93e00"},
+		{"fb7ff8000000000001", "f97e00"},
+		{"fa47c35000", "fa47c35000"},
+		{"7f61616162ff", "626162"},
+		{"9f0102ff", "820102"},
+		{"d8189f01ff", "d8188101"},
+		// keys sorted by the bytewise order of their encoding
+		{"a461620161610218640320f5", "a418640320f5616102616201"},
+	} {
+		data, err := hex.DecodeString(tc.in)
+		require.NoError(t, err)
+		out, err := cbor.Canonical(data)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.out, hex.EncodeToString(out), tc.in)
+	}
+
+	_, err := cbor.Canonical([]byte{0xa2, 0x01, 0x02, 0x18, 0x01, 0x03})
+	assert.Error(t, err)
+}
+
+func TestDeterministic(t *testing.T) {
+	encode := func(write func(w cbor.Writer), opts ...cbor.EncoderOption) string {
+		sizer := cbor.NewSizer(opts...)
+		write(&sizer)
+		buffer := make([]byte, sizer.Len())
+		encoder := cbor.NewEncoder(buffer, opts...)
+		write(&encoder)
+		require.NoError(t, encoder.CheckError())
+		assert.Equal(t, sizer.Len(), encoder.Len(), "Sizer and Encoder disagree")
+		return hex.EncodeToString(buffer)
+	}
+	for _, tc := range []struct {
+		name            string
+		write           func(w cbor.Writer)
+		plain, shortest string
+	}{
+		{"float64 half", func(w cbor.Writer) { w.WriteFloat64(1.5) }, "fb3ff8000000000000", "f93e00"},
+		{"float64 single", func(w cbor.Writer) { w.WriteFloat64(100000) }, "fb40f86a0000000000", "fa47c35000"},
+		{"float64 double", func(w cbor.Writer) { w.WriteFloat64(0.1) }, "fb3fb999999999999a", "fb3fb999999999999a"},
+		{"float64 negative zero", func(w cbor.Writer) { w.WriteFloat64(math.Copysign(0, -1)) }, "fb8000000000000000", "f98000"},
+		{"float64 subnormal half", func(w cbor.Writer) { w.WriteFloat64(5.960464477539063e-08) }, "fb3e70000000000000", "f90001"},
+		{"float64 infinity", func(w cbor.Writer) { w.WriteFloat64(math.Inf(-1)) }, "fbfff0000000000000", "f9fc00"},
+		{"float32 half", func(w cbor.Writer) { w.WriteFloat32(1.5) }, "fa3fc00000", "f93e00"},
+		{"float32 single", func(w cbor.Writer) { w.WriteFloat32(100000) }, "fa47c35000", "fa47c35000"},
+		{"embedded", func(w cbor.Writer) { w.WriteEmbedded(func(w cbor.Writer) { w.WriteFloat64(0.5) }) }, "d81849fb3fe0000000000000", "d81843f93800"},
+		{"integers unchanged", func(w cbor.Writer) {
+			w.WriteArraySize(2)
+			w.WriteUint64(24)
+			w.WriteInt64(-25)
+		}, "8218183818", "8218183818"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.plain, encode(tc.write))
+			assert.Equal(t, tc.shortest, encode(tc.write, cbor.Deterministic()))
+		})
+	}
+}
+
+func TestReadChunked(t *testing.T) {
+	// [_ (_ "ab" "c"), h'01', (_ h'02' h'03')]
+	decoder := cbor.NewDecoder([]byte{0x9f, 0x7f, 0x62, 'a', 'b', 0x61, 'c', 0xff, 0x41, 0x01, 0x5f, 0x41, 0x02, 0x41, 0x03, 0xff, 0xff})
+	_, indef, err := decoder.ReadArraySize()
+	require.NoError(t, err)
+	assert.True(t, indef)
+
+	end, err := decoder.ReadBreak()
+	require.NoError(t, err)
+	assert.False(t, end)
+	s, err := decoder.ReadStringChunked()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", s)
+
+	b, err := decoder.ReadByteArrayChunked()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, b)
+	b, err = decoder.ReadByteArrayChunked()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x02, 0x03}, b)
+
+	end, err = decoder.ReadBreak()
+	require.NoError(t, err)
+	assert.True(t, end)
+	assert.True(t, decoder.Done())
+
+	decoder = cbor.NewDecoder([]byte{0x7f, 0x41, 0x01, 0xff})
+	_, err = decoder.ReadStringChunked()
+	assert.Error(t, err)
+
+	for _, data := range [][]byte{
+		{0x62, 0xc3, 0x28},
+		{0x7f, 0x61, 'a', 0x61, 0xff, 0xff},
+	} {
+		decoder = cbor.NewDecoder(data)
+		_, err = decoder.ReadStringChunked()
+		assert.EqualError(t, err, "invalid UTF-8 in text string")
+	}
+}
@@ -0,0 +1,272 @@
+package cddl
+
+import (
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unbounded is the maximum occurrence of entries marked * or +.
+const Unbounded = math.MaxUint64
+
+// Rule is a rule of a schema: a name for a type, as in
+//
+//	port = uint .size 2
+//
+// or for a group entry, as in
+//
+//	address = (host: tstr, port: port)
+type Rule struct {
+	Name string
+	// Entry is the right-hand side. A type rule has an entry that is a
+	// single type, without key and occurrence.
+	Entry *GroupEntry
+	// Line is the line of the rule in the source, starting at 1.
+	Line int
+}
+
+// IsType reports whether the rule defines a type rather than a group.
+func (r *Rule) IsType() bool {
+	e := r.Entry
+	return e.Type != nil && e.Key == nil && e.Min == 1 && e.Max == 1
+}
+
+// Group is a choice between sequences of entries, separated by // in the
+// source.
+type Group struct {
+	Choices [][]*GroupEntry
+}
+
+// GroupEntry is an entry of a group: a type, optionally keyed in maps,
+// or an inline group in parentheses.
+type GroupEntry struct {
+	// Min and Max bound the number of occurrences; both are 1 unless the
+	// entry starts with ?, *, + or n*m.
+	Min, Max uint64
+	// Key is the member key, or nil if there is none.
+	Key *Type1
+	// Cut is set for keys written with ^ => or as bareword: a matching
+	// key whose value does not match fails the map.
+	Cut bool
+	// Type is the type of the value; nil for an inline group.
+	Type *Type
+	// Group is the inline group in parentheses.
+	Group *Group
+}
+
+// Type is a choice between types, separated by / in the source.
+type Type struct {
+	Choices []*Type1
+}
+
+// Type1 is a type, a range or a type with a control operator.
+type Type1 struct {
+	Base *Type2
+	// Op is empty, ".." or "..." for ranges (Base is the lower bound and
+	// Arg the upper one), or a control operator such as ".size".
+	Op  string
+	Arg *Type2
+
+	// compiled argument of .regexp
+	re *regexp.Regexp
+}
+
+// Kind tells the forms of Type2 apart.
+type Kind uint8
+
+const (
+	KindValue  Kind = iota // literal value
+	KindName               // reference to a rule or to the prelude
+	KindParen              // (type)
+	KindMap                // {group}
+	KindArray              // [group]
+	KindUnwrap             // ~name
+	KindEnum               // &(group) or &name
+	KindTag                // #6.n(type)
+	KindMajor              // #major or #major.arg
+	KindAny                // #
+)
+
+// Type2 is a single type.
+type Type2 struct {
+	Kind Kind
+	// Value is the literal of KindValue.
+	Value Value
+	// Name is the rule of KindName, KindUnwrap and KindEnum without group.
+	Name string
+	// Type is the type of KindParen and of the content of KindTag.
+	Type *Type
+	// Group is the group of KindMap, KindArray and KindEnum.
+	Group *Group
+	// Major and Arg are the major type and argument of KindMajor, and the
+	// tag number of KindTag. HasArg is false for #major alone.
+	Major  uint8
+	Arg    uint64
+	HasArg bool
+}
+
+// ValueKind tells the kinds of literal values apart.
+type ValueKind uint8
+
+const (
+	ValueInt ValueKind = iota
+	ValueFloat
+	ValueText
+	ValueBytes
+)
+
+// Value is a literal value.
+type Value struct {
+	Kind ValueKind
+	// Neg and Uint hold an integer in the form of CBOR: Uint if Neg is
+	// false and -1-Uint if it is set.
+	Neg  bool
+	Uint uint64
+	// Float holds a float.
+	Float float64
+	// Text holds the content of a text or byte string.
+	Text string
+}
+
+// String returns the type in CDDL syntax.
+func (t *Type) String() string {
+	parts := make([]string, len(t.Choices))
+	for i, c := range t.Choices {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " / ")
+}
+
+// String returns the type in CDDL syntax.
+func (t *Type1) String() string {
+	switch t.Op {
+	case "":
+		return t.Base.String()
+	case "..", "...":
+		return t.Base.String() + t.Op + t.Arg.String()
+	}
+	return t.Base.String() + " " + t.Op + " " + t.Arg.String()
+}
+
+// String returns the type in CDDL syntax.
+func (t *Type2) String() string {
+	switch t.Kind {
+	case KindValue:
+		return t.Value.String()
+	case KindName:
+		return t.Name
+	case KindParen:
+		return "(" + t.Type.String() + ")"
+	case KindMap:
+		return "{" + t.Group.String() + "}"
+	case KindArray:
+		return "[" + t.Group.String() + "]"
+	case KindUnwrap:
+		return "~" + t.Name
+	case KindEnum:
+		if t.Group == nil {
+			return "&" + t.Name
+		}
+		return "&(" + t.Group.String() + ")"
+	case KindTag:
+		return "#6." + strconv.FormatUint(t.Arg, 10) + "(" + t.Type.String() + ")"
+	case KindMajor:
+		s := "#" + strconv.Itoa(int(t.Major))
+		if t.HasArg {
+			s += "." + strconv.FormatUint(t.Arg, 10)
+		}
+		return s
+	}
+	return "#"
+}
+
+// String returns the group in CDDL syntax.
+func (g *Group) String() string {
+	choices := make([]string, len(g.Choices))
+	for i, entries := range g.Choices {
+		parts := make([]string, len(entries))
+		for j, e := range entries {
+			parts[j] = e.String()
+		}
+		choices[i] = strings.Join(parts, ", ")
+	}
+	return strings.Join(choices, " // ")
+}
+
+// String returns the entry in CDDL syntax.
+func (e *GroupEntry) String() string {
+	var sb strings.Builder
+	switch {
+	case e.Min == 1 && e.Max == 1:
+	case e.Min == 0 && e.Max == 1:
+		sb.WriteString("? ")
+	case e.Min == 0 && e.Max == Unbounded:
+		sb.WriteString("* ")
+	case e.Min == 1 && e.Max == Unbounded:
+		sb.WriteString("+ ")
+	default:
+		if e.Min > 0 {
+			sb.WriteString(strconv.FormatUint(e.Min, 10))
+		}
+		sb.WriteByte('*')
+		if e.Max != Unbounded {
+			sb.WriteString(strconv.FormatUint(e.Max, 10))
+		}
+		sb.WriteByte(' ')
+	}
+	if e.Key != nil {
+		if name, ok := bareword(e.Key); ok && e.Cut {
+			sb.WriteString(name + ": ")
+		} else {
+			sb.WriteString(e.Key.String())
+			if e.Cut {
+				sb.WriteString(" ^")
+			}
+			sb.WriteString(" => ")
+		}
+	}
+	if e.Group != nil {
+		sb.WriteString("(" + e.Group.String() + ")")
+	} else {
+		sb.WriteString(e.Type.String())
+	}
+	return sb.String()
+}
+
+// bareword returns the text of a key that can be written as a bareword.
+func bareword(key *Type1) (string, bool) {
+	if key.Op != "" || key.Base.Kind != KindValue || key.Base.Value.Kind != ValueText {
+		return "", false
+	}
+	name := key.Base.Value.Text
+	l := lexer{src: name}
+	if name == "" || !isNameStart(name[0]) || l.name(0) != len(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// String returns the value in CDDL syntax.
+func (v Value) String() string {
+	switch v.Kind {
+	case ValueInt:
+		if v.Neg {
+			if v.Uint == math.MaxUint64 {
+				return "-18446744073709551616"
+			}
+			return "-" + strconv.FormatUint(v.Uint+1, 10)
+		}
+		return strconv.FormatUint(v.Uint, 10)
+	case ValueFloat:
+		s := strconv.FormatFloat(v.Float, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case ValueText:
+		return strconv.Quote(v.Text)
+	}
+	return "h'" + hex.EncodeToString([]byte(v.Text)) + "'"
+}
@@ -0,0 +1,318 @@
+// Package cddl parses schemas in the Concise Data Definition Language
+// (RFC 8610) and validates CBOR data against them.
+//
+//	schema, err := cddl.Parse(`
+//		person = {name: tstr .size (1..64), ? age: 0..150, * tstr => any}
+//	`)
+//	d := cbor.NewDecoder(data)
+//	err = schema.Validate(&d, "person")
+//
+// Groups, type and group choices, occurrence indicators, ranges, tags,
+// major types, unwrapping (~), enumerations (&) and the prelude are
+// supported, as are the control operators .size, .regexp, .lt, .le, .gt,
+// .ge, .eq, .ne, .default, .cbor, .and and .within. Generic rules are not.
+// Regular expressions use the syntax of package regexp and match the
+// whole string.
+package cddl
+
+import (
+	"regexp"
+	"strings"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+// Schema is a parsed CDDL source.
+type Schema struct {
+	// Rules are the rules of the source, in order. Rules extended with /=
+	// or //= appear once, with the extensions as further choices.
+	Rules []*Rule
+	// Limits bound the data that Validate reads, as for cbor.Validate. A
+	// zero MaxDepth means cbor.DefaultMaxDepth and a zero MaxItems
+	// DefaultMaxItems.
+	Limits cbor.Limits
+	// MaxSteps bounds the work of matching the data against the rules; a
+	// zero MaxSteps means DefaultMaxSteps.
+	MaxSteps uint64
+
+	rules map[string]*Rule
+}
+
+// the standard prelude (RFC 8610 Appendix D)
+const preludeSource = `
+any = #
+uint = #0
+nint = #1
+int = uint / nint
+bstr = #2
+bytes = bstr
+tstr = #3
+text = tstr
+tdate = #6.0(tstr)
+time = #6.1(number)
+number = int / float
+biguint = #6.2(bstr)
+bignint = #6.3(bstr)
+bigint = biguint / bignint
+integer = int / bigint
+unsigned = uint / biguint
+decfrac = #6.4([e10: int, m: integer])
+bigfloat = #6.5([e2: int, m: integer])
+eb64url = #6.21(any)
+eb64legacy = #6.22(any)
+eb16 = #6.23(any)
+encoded-cbor = #6.24(bstr)
+uri = #6.32(tstr)
+b64url = #6.33(tstr)
+b64legacy = #6.34(tstr)
+regexp = #6.35(tstr)
+mime-message = #6.36(tstr)
+cbor-any = #6.55799(any)
+float16 = #7.25
+float32 = #7.26
+float64 = #7.27
+float16-32 = float16 / float32
+float32-64 = float32 / float64
+float = float16-32 / float64
+false = #7.20
+true = #7.21
+bool = false / true
+nil = #7.22
+null = nil
+undefined = #7.23
+`
+
+var prelude *Schema
+
+func init() {
+	s, err := Parse(preludeSource)
+	if err != nil {
+		panic(err)
+	}
+	prelude = s
+}
+
+// Parse parses CDDL source. The first rule is the root of the schema.
+func Parse(src string) (*Schema, error) {
+	l := lexer{src: src, line: 1}
+	toks, err := l.tokens()
+	if err != nil {
+		return nil, err
+	}
+	p := parser{toks: toks}
+	rules, err := p.rules()
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, &ParseError{Line: 1, Column: 1, Message: "no rules"}
+	}
+	s := &Schema{rules: make(map[string]*Rule)}
+	for i := range rules {
+		if err := s.add(&rules[i], &p); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.link(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add adds a rule, or extends the rule of the same name for /= and //=.
+func (s *Schema) add(r *rule, p *parser) error {
+	prev := s.rules[r.Name]
+	switch r.assign {
+	case "=":
+		if prev != nil {
+			return p.errorf(r.tok, "rule "+r.Name+" is defined twice")
+		}
+		added := r.Rule
+		s.Rules = append(s.Rules, &added)
+		s.rules[r.Name] = &added
+	case "/=":
+		if prev == nil || !prev.IsType() || !r.IsType() {
+			return p.errorf(r.tok, "/= must extend a type rule with a type")
+		}
+		prev.Entry.Type.Choices = append(prev.Entry.Type.Choices, r.Entry.Type.Choices...)
+	default:
+		if prev == nil || prev.IsType() || r.IsType() {
+			return p.errorf(r.tok, "//= must extend a group rule with a group")
+		}
+		if !isPlainGroup(prev.Entry) {
+			prev.Entry = &GroupEntry{Min: 1, Max: 1, Group: &Group{Choices: [][]*GroupEntry{{prev.Entry}}}}
+		}
+		g := prev.Entry.Group
+		if isPlainGroup(r.Entry) {
+			g.Choices = append(g.Choices, r.Entry.Group.Choices...)
+		} else {
+			g.Choices = append(g.Choices, []*GroupEntry{r.Entry})
+		}
+	}
+	return nil
+}
+
+// isPlainGroup reports whether e is an inline group occurring once.
+func isPlainGroup(e *GroupEntry) bool {
+	return e.Group != nil && e.Min == 1 && e.Max == 1
+}
+
+// lookup returns the rule name, from the schema or the prelude.
+func (s *Schema) lookup(name string) *Rule {
+	if r, ok := s.rules[name]; ok {
+		return r
+	}
+	if prelude != nil {
+		return prelude.rules[name]
+	}
+	return nil
+}
+
+// value returns the literal value that t stands for, following type rules
+// that name a single value.
+func (s *Schema) value(t *Type2) (Value, bool) {
+	for i := 0; i < maxDepth; i++ {
+		switch t.Kind {
+		case KindValue:
+			return t.Value, true
+		case KindName:
+			r := s.lookup(t.Name)
+			if r == nil || !r.IsType() {
+				return Value{}, false
+			}
+			t1 := r.Entry.Type.Choices[0]
+			if len(r.Entry.Type.Choices) != 1 || t1.Op != "" {
+				return Value{}, false
+			}
+			t = t1.Base
+		case KindParen:
+			t1 := t.Type.Choices[0]
+			if len(t.Type.Choices) != 1 || t1.Op != "" {
+				return Value{}, false
+			}
+			t = t1.Base
+		default:
+			return Value{}, false
+		}
+	}
+	return Value{}, false
+}
+
+// link checks that the names of the rules are defined, that ranges have
+// numeric bounds and that the arguments of .regexp compile.
+func (s *Schema) link() error {
+	for _, r := range s.Rules {
+		if err := s.linkEntry(r, r.Entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) errorIn(r *Rule, message string) error {
+	return &ParseError{Line: r.Line, Message: "rule " + r.Name + ": " + message}
+}
+
+func (s *Schema) linkGroup(r *Rule, g *Group) error {
+	for _, entries := range g.Choices {
+		for _, e := range entries {
+			if err := s.linkEntry(r, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) linkEntry(r *Rule, e *GroupEntry) error {
+	if e.Group != nil {
+		return s.linkGroup(r, e.Group)
+	}
+	if e.Key != nil {
+		if err := s.linkType1(r, e.Key); err != nil {
+			return err
+		}
+	}
+	return s.linkType(r, e.Type)
+}
+
+func (s *Schema) linkType(r *Rule, t *Type) error {
+	for _, t1 := range t.Choices {
+		if err := s.linkType1(r, t1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) linkType1(r *Rule, t *Type1) error {
+	if err := s.linkType2(r, t.Base); err != nil {
+		return err
+	}
+	if t.Arg != nil {
+		if err := s.linkType2(r, t.Arg); err != nil {
+			return err
+		}
+	}
+	switch t.Op {
+	case "..", "...":
+		lo, okLo := s.value(t.Base)
+		hi, okHi := s.value(t.Arg)
+		if !okLo || !okHi || !isNumber(lo) || !isNumber(hi) {
+			return s.errorIn(r, "range bounds of "+t.String()+" must be numbers")
+		}
+	case ".regexp":
+		v, ok := s.value(t.Arg)
+		if !ok || v.Kind != ValueText {
+			return s.errorIn(r, ".regexp needs a text string")
+		}
+		re, err := regexp.Compile("^(?:" + v.Text + ")$")
+		if err != nil {
+			return s.errorIn(r, err.Error())
+		}
+		t.re = re
+	case ".size":
+		if _, ok := s.value(t.Arg); !ok && t.Arg.Kind != KindParen && t.Arg.Kind != KindName {
+			return s.errorIn(r, ".size needs a number or a range")
+		}
+	case ".lt", ".le", ".gt", ".ge":
+		if v, ok := s.value(t.Arg); !ok || !isNumber(v) {
+			return s.errorIn(r, t.Op+" needs a number")
+		}
+	case ".eq", ".ne":
+		if _, ok := s.value(t.Arg); !ok {
+			return s.errorIn(r, t.Op+" needs a value")
+		}
+	}
+	return nil
+}
+
+func (s *Schema) linkType2(r *Rule, t *Type2) error {
+	switch t.Kind {
+	case KindName, KindUnwrap:
+		return s.linkName(r, t.Name)
+	case KindEnum:
+		if t.Group == nil {
+			return s.linkName(r, t.Name)
+		}
+		return s.linkGroup(r, t.Group)
+	case KindParen, KindTag:
+		return s.linkType(r, t.Type)
+	case KindMap, KindArray:
+		return s.linkGroup(r, t.Group)
+	}
+	return nil
+}
+
+// linkName checks that name is defined. Sockets, whose names start with $,
+// may be left undefined.
+func (s *Schema) linkName(r *Rule, name string) error {
+	if s.lookup(name) == nil && !strings.HasPrefix(name, "$") {
+		return s.errorIn(r, "undefined name "+name)
+	}
+	return nil
+}
+
+func isNumber(v Value) bool {
+	return v.Kind == ValueInt || v.Kind == ValueFloat
+}
@@ -0,0 +1,327 @@
+package cddl_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbor "github.com/wasmcloud/tinygo-cbor"
+	"github.com/wasmcloud/tinygo-cbor/cddl"
+)
+
+func validate(t *testing.T, schema *cddl.Schema, rule, data string) error {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(data, " ", ""))
+	require.NoError(t, err)
+	d := cbor.NewDecoder(b)
+	return schema.Validate(&d, rule)
+}
+
+func TestParse(t *testing.T) {
+	schema, err := cddl.Parse(`
+; a comment
+person = {
+  name: tstr,            ; bareword key
+  ? "age" => 0..150,
+  * tstr => any
+}
+pair = (int, int)
+points = [2*4 pair]
+port = uint .size 2
+id = h'0102' / b64'AQI' / 'raw' / -1 / 1.5
+tagged = #6.32(tstr) / #7.25 / #
+color = &(red: 1, green: 2)
+`)
+	require.NoError(t, err)
+	var lines []string
+	for _, r := range schema.Rules {
+		lines = append(lines, r.Name+" = "+r.Entry.String())
+	}
+	assert.Equal(t, []string{
+		`person = {name: tstr, ? "age" => 0..150, * tstr => any}`,
+		`pair = (int, int)`,
+		`points = [2*4 pair]`,
+		`port = uint .size 2`,
+		`id = h'0102' / h'0102' / h'726177' / -1 / 1.5`,
+		`tagged = #6.32(tstr) / #7.25 / #`,
+		`color = &(red: 1, green: 2)`,
+	}, lines)
+
+	assert.True(t, schema.Rules[0].IsType())
+	assert.False(t, schema.Rules[1].IsType())
+	assert.Equal(t, 8, schema.Rules[1].Line)
+	entry := schema.Rules[0].Entry.Type.Choices[0].Base.Group.Choices[0][1]
+	assert.Equal(t, uint64(0), entry.Min)
+	assert.Equal(t, uint64(1), entry.Max)
+	assert.False(t, entry.Cut)
+	assert.Equal(t, cddl.KindValue, entry.Key.Base.Kind)
+	assert.Equal(t, "..", entry.Type.Choices[0].Op)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct{ src, err string }{
+		{"a = ", "cddl: line 1:5: unexpected end of input"},
+		{"a = {x: int", "cddl: line 1:12: expected }"},
+		{"a = int\n  b = c", "cddl: line 2: rule b: undefined name c"},
+		{"a<t> = [t]", "cddl: line 1:2: generic parameters are not supported"},
+		{"a = tstr .foo 1", "cddl: line 1:10: unsupported control operator .foo"},
+		{"a = int\na = tstr", "cddl: line 2:1: rule a is defined twice"},
+		{`a = tstr .regexp "("`, "cddl: line 1: rule a: error parsing regexp"},
+		{`a = "x"..2`, "cddl: line 1: rule a: range bounds"},
+		{"a = \"abc", "cddl: line 1:5: unterminated text string"},
+		{"", "cddl: line 1:1: no rules"},
+	} {
+		_, err := cddl.Parse(c.src)
+		if assert.Error(t, err, c.src) {
+			assert.Contains(t, err.Error(), c.err, c.src)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := cddl.Parse(`
+claims = {
+  iss: tstr .size (1..16),
+  ? tags: [* tag],
+  caps: [+ cap],
+  ? rev: uint .size 2,
+  * tstr => any
+}
+tag = tstr .regexp "[a-z]+"
+cap = "http" / "kv" / #6.32(tstr)
+`)
+	require.NoError(t, err)
+
+	// {"iss": "abc", "tags": ["foo", "bar"], "caps": ["http"]}
+	assert.NoError(t, validate(t, schema, "", "a3 63697373 63616263 6474616773 82 63666f6f 63626172 6463617073 81 6468747470"))
+	// extra text keys are allowed: {"iss": "a", "caps": ["kv", 32("a")], "x": null}
+	assert.NoError(t, validate(t, schema, "claims", "a3 63697373 6161 6463617073 82 626b76 d8206161 6178 f6"))
+
+	for _, c := range []struct {
+		data    string
+		message string
+		path    string
+		offset  uint32
+	}{
+		// tags ["foo", "BAR"]
+		{"a3 63697373 63616263 6474616773 82 63666f6f 63424152 6463617073 81 6468747470",
+			`text does not match "[a-z]+"`, "/tags/1", 19},
+		{"a2 63697373 63616263 6474616773 80",
+			"missing entry caps: [+ cap]", "/", 0},
+		{"a2 63697373 60 6463617073 81 626b76",
+			"length 0 does not match .size (1..16)", "/iss", 5},
+		{"a3 63697373 6161 6463617073 81 626b76 63726576 1a00010000",
+			"65536 does not fit .size 2", "/rev", 20},
+		{"a3 63697373 6161 6463617073 81 626b76 01 02",
+			"unexpected map key 1", "/1", 16},
+		{"a2 63697373 6161 6463617073 82 626b76 d8216161",
+			"expected cap, got tag 33", "/caps/1", 16},
+		{"a2 63697373 6161 6463617073 80",
+			"missing array item + cap", "/caps", 12},
+		{"82 01 02", "expected map, got array", "/", 0},
+	} {
+		err := validate(t, schema, "", c.data)
+		var verr *cddl.ValidationError
+		if assert.ErrorAs(t, err, &verr, c.data) {
+			assert.Equal(t, cddl.ValidationError{Path: c.path, Offset: c.offset, Message: c.message}, *verr, c.data)
+		}
+	}
+	err = validate(t, schema, "", "82 01 02")
+	assert.EqualError(t, err, "cddl: expected map, got array at /, offset 0")
+
+	err = validate(t, schema, "nothing", "01")
+	assert.EqualError(t, err, "cddl: undefined rule nothing")
+	err = validate(t, schema, "", "a1")
+	assert.Error(t, err)
+}
+
+func TestValidateGroups(t *testing.T) {
+	schema, err := cddl.Parse(`
+points = [* pair]
+pair = (int, int)
+header = [version: 1, ? flags: uint, + tstr]
+shape = {kind: "circle", radius: float} / {kind: "square", side: uint}
+base = (id: uint)
+record = {base, ? name: tstr}
+record-list = [~record-array]
+record-array = [* uint]
+ext = (a: int)
+ext //= (b: tstr)
+holder = {ext}
+level = 1 / 2
+level /= 3
+`)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		rule, data string
+		ok         bool
+	}{
+		{"points", "80", true},
+		{"points", "84 01 02 03 0f", true},
+		{"points", "83 01 02 03", false},
+		{"header", "82 01 6161", true},
+		{"header", "83 01 05 6161", true},
+		{"header", "83 01 6161 6162", true},
+		{"header", "82 02 6161", false},
+		{"header", "81 01", false},
+		{"shape", "a2 646b696e64 66636972636c65 66726164697573 f93c00", true},
+		{"shape", "a2 646b696e64 66737175617265 6473696465 02", true},
+		{"shape", "a2 646b696e64 66737175617265 66726164697573 f93c00", false},
+		{"record", "a1 626964 01", true},
+		{"record", "a2 626964 01 646e616d65 6161", true},
+		{"record", "a1 646e616d65 6161", false},
+		{"record-list", "83 01 02 03", true},
+		{"holder", "a1 6161 01", true},
+		{"holder", "a1 6162 6161", true},
+		{"holder", "a1 6162 01", false},
+		{"level", "03", true},
+		{"level", "04", false},
+	} {
+		err := validate(t, schema, c.rule, c.data)
+		if c.ok {
+			assert.NoError(t, err, c.rule+" "+c.data)
+		} else {
+			assert.Error(t, err, c.rule+" "+c.data)
+		}
+	}
+}
+
+func TestValidateTypes(t *testing.T) {
+	schema, err := cddl.Parse(`
+any-of = [
+  small: -10..10,
+  half-open: 0...1.0,
+  id: bstr .size 4,
+  limit: uint .le 100,
+  answer: int .eq 42,
+  color: &colors,
+  embedded: bstr .cbor [+ uint],
+  date: tdate / time,
+  flag: bool / nil,
+  big: biguint,
+  f32: float32,
+]
+colors = (red: 1, green: 2, blue: 3)
+`)
+	require.NoError(t, err)
+	valid := "8b 29 f93800 4401020304 1864 182a 02 43 82 01 02 c0 6161 f6 c2 41 ff fa3fc00000"
+	assert.NoError(t, validate(t, schema, "", valid))
+
+	for _, c := range []struct{ data, path string }{
+		{"8b 2a f93800 4401020304 1864 182a 02 43820102 c06161 f6 c241ff fa3fc00000", "/0"},
+		{"8b 29 f93c00 4401020304 1864 182a 02 43820102 c06161 f6 c241ff fa3fc00000", "/1"},
+		{"8b 29 f93800 43010203 1864 182a 02 43820102 c06161 f6 c241ff fa3fc00000", "/2"},
+		{"8b 29 f93800 4401020304 1865 182a 02 43820102 c06161 f6 c241ff fa3fc00000", "/3"},
+		{"8b 29 f93800 4401020304 1864 182b 02 43820102 c06161 f6 c241ff fa3fc00000", "/4"},
+		{"8b 29 f93800 4401020304 1864 182a 04 43820102 c06161 f6 c241ff fa3fc00000", "/5"},
+		{"8b 29 f93800 4401020304 1864 182a 02 43820120 c06161 f6 c241ff fa3fc00000", "/6/1"},
+		{"8b 29 f93800 4401020304 1864 182a 02 43820102 c16161 f6 c241ff fa3fc00000", "/7"},
+		{"8b 29 f93800 4401020304 1864 182a 02 43820102 c06161 f7 c241ff fa3fc00000", "/8"},
+		{"8b 29 f93800 4401020304 1864 182a 02 43820102 c06161 f6 c341ff fa3fc00000", "/9"},
+		{"8b 29 f93800 4401020304 1864 182a 02 43820102 c06161 f6 c241ff fb3ff8000000000000", "/10"},
+	} {
+		err := validate(t, schema, "", c.data)
+		var verr *cddl.ValidationError
+		if assert.ErrorAs(t, err, &verr, c.data) {
+			assert.Equal(t, c.path, verr.Path, err.Error())
+		}
+	}
+
+	// the embedded item reports offsets in the outer data
+	err = validate(t, schema, "", "8b 29 f93800 4401020304 1864 182a 02 43820120 c06161 f6 c241ff fa3fc00000")
+	assert.EqualError(t, err, "cddl: expected uint, got -1 at /6/1, offset 18")
+}
+
+func TestValidateIndefinite(t *testing.T) {
+	schema, err := cddl.Parse(`msg = {* tstr => [* tstr .size 3]}`)
+	require.NoError(t, err)
+	// {_ "a": [_ (_ "ab" "c")]}
+	assert.NoError(t, validate(t, schema, "", "bf 6161 9f 7f 626162 6163 ff ff ff"))
+	// {_ "a": [_ "ab"]}
+	err = validate(t, schema, "", "bf 6161 9f 626162 ff ff")
+	assert.EqualError(t, err, "cddl: length 2 does not match .size 3 at /a/0, offset 4")
+}
+
+func TestRecursion(t *testing.T) {
+	schema, err := cddl.Parse(`
+tree = [uint, * tree]
+loop = loop
+left = [left-group]
+left-group = (? left-group, uint)
+`)
+	require.NoError(t, err)
+	assert.NoError(t, validate(t, schema, "tree", "83 01 81 02 82 03 81 04"))
+	assert.Error(t, validate(t, schema, "tree", "82 01 81 f6"))
+	assert.EqualError(t, validate(t, schema, "loop", "01"), "cddl: rules nest too deep at /, offset 0")
+	assert.NoError(t, validate(t, schema, "left", "81 01"))
+}
+
+func TestLimits(t *testing.T) {
+	schema, err := cddl.Parse(`tree = [* tree] / uint`)
+	require.NoError(t, err)
+	nested := func(n int) *cbor.Decoder {
+		d := cbor.NewDecoder(append(bytes.Repeat([]byte{0x81}, n), 0x01))
+		return &d
+	}
+	assert.NoError(t, schema.Validate(nested(cbor.DefaultMaxDepth), ""))
+	assert.ErrorIs(t, schema.Validate(nested(cbor.DefaultMaxDepth+1), ""), cbor.ErrTooDeep)
+	// far deeper than the stack would allow
+	assert.ErrorIs(t, schema.Validate(nested(10000000), ""), cbor.ErrTooDeep)
+
+	schema.Limits = cbor.Limits{MaxDepth: 2, MaxItems: 3, MaxLength: 2}
+	assert.NoError(t, validate(t, schema, "", "81 81 01"))
+	assert.ErrorIs(t, validate(t, schema, "", "81 81 81 01"), cbor.ErrTooDeep)
+	assert.EqualError(t, validate(t, schema, "", "83 01 02 03"), "cddl: length 3 over limit")
+	assert.EqualError(t, validate(t, schema, "", "82 82 01 02 03"), "cddl: more than 3 data items")
+}
+
+func TestAmbiguousRepetition(t *testing.T) {
+	schema, err := cddl.Parse(`
+nested = [* (* int)]
+optional = [* (? int, ? int)]
+exact = [3*3 (? int)]
+pairs = [2*2 (int, int)]
+`)
+	require.NoError(t, err)
+	// an array of n ints, and of the item tail if it is not empty
+	ints := func(n int, tail string) string {
+		size := n
+		if tail != "" {
+			size++
+		}
+		return "99" + hex.EncodeToString([]byte{byte(size >> 8), byte(size)}) + strings.Repeat("01", n) + tail
+	}
+	for _, c := range []struct {
+		rule, data string
+		ok         bool
+	}{
+		// each of these took exponential time to fail
+		{"nested", ints(20, "60"), false},
+		{"optional", ints(21, "60"), false},
+		{"nested", ints(20, ""), true},
+		{"optional", ints(1000, ""), true},
+		{"nested", ints(1000, ""), true},
+		{"exact", "80", true},
+		{"exact", "83 01 02 03", true},
+		{"exact", "84 01 02 03 04", false},
+		{"pairs", "84 01 02 03 04", true},
+		{"pairs", "83 01 02 03", false},
+		{"pairs", "86 01 02 03 04 05 06", false},
+	} {
+		err := validate(t, schema, c.rule, c.data)
+		if c.ok {
+			assert.NoError(t, err, c.rule)
+		} else {
+			assert.Error(t, err, c.rule)
+		}
+	}
+	err = validate(t, schema, "nested", ints(20, "60"))
+	assert.EqualError(t, err, "cddl: expected int, got text string at /20, offset 23")
+
+	schema.MaxSteps = 1000
+	assert.ErrorIs(t, validate(t, schema, "nested", ints(1000, "")), cddl.ErrTooComplex)
+	assert.NoError(t, validate(t, schema, "nested", ints(10, "")))
+}
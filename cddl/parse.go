@@ -0,0 +1,606 @@
+package cddl
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// ParseError reports invalid CDDL source.
+type ParseError struct {
+	// Line and Column locate the error, starting at 1. Column is 0 for
+	// errors that concern a whole rule.
+	Line, Column int
+	Message      string
+}
+
+func (e *ParseError) Error() string {
+	pos := strconv.Itoa(e.Line)
+	if e.Column > 0 {
+		pos += ":" + strconv.Itoa(e.Column)
+	}
+	return "cddl: line " + pos + ": " + e.Message
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF     tokenKind = iota
+	tokName              // rule name or bareword
+	tokValue             // number, text or byte string
+	tokPunct             // punctuation, including =, //= and =>
+	tokControl           // control operator, such as .size
+	tokMajor             // #major or #major.arg
+)
+
+type token struct {
+	kind tokenKind
+	// text of a name, punctuation or control operator
+	text  string
+	value Value
+	// major type and argument of tokMajor
+	major  uint8
+	arg    uint64
+	hasArg bool
+	// space is set if white space or a comment comes before the token
+	space     bool
+	line, col int
+}
+
+// punctuation, longest first
+var puncts = []string{"//=", "...", "//", "/=", "=>", "..", "=", "/", "(", ")", "{", "}", "[", "]", ",", ":", "?", "*", "+", "~", "&", "^", "<", ">", "#"}
+
+type lexer struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (l *lexer) errorAt(pos int, message string) error {
+	return &ParseError{Line: l.line, Column: pos - l.lineStart + 1, Message: message}
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return isAlpha(c) || c == '@' || c == '_' || c == '$'
+}
+
+// name returns the end of the name starting at i. Dashes and dots are part
+// of a name when a letter or digit follows them (RFC 8610 §3.1).
+func (l *lexer) name(i int) int {
+	i++
+	for i < len(l.src) {
+		j := i
+		for j < len(l.src) && (l.src[j] == '-' || l.src[j] == '.') {
+			j++
+		}
+		if j == len(l.src) || !isNameStart(l.src[j]) && !isDigit(l.src[j]) {
+			return i
+		}
+		i = j + 1
+	}
+	return i
+}
+
+// skipSpace skips white space and comments and reports whether there were
+// any.
+func (l *lexer) skipSpace() bool {
+	start := l.pos
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == ';':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return l.pos > start
+		}
+	}
+	return l.pos > start
+}
+
+func (l *lexer) tokens() ([]token, error) {
+	var toks []token
+	for {
+		space := l.skipSpace()
+		t := token{space: space, line: l.line, col: l.pos - l.lineStart + 1}
+		if l.pos == len(l.src) {
+			return append(toks, t), nil
+		}
+		if err := l.token(&t); err != nil {
+			return nil, err
+		}
+		toks = append(toks, t)
+	}
+}
+
+func (l *lexer) token(t *token) error {
+	start := l.pos
+	c := l.src[start]
+	switch {
+	case c == '"':
+		s, err := l.text()
+		t.kind, t.value = tokValue, Value{Kind: ValueText, Text: s}
+		return err
+	case c == '\'':
+		b, err := l.bytes("")
+		t.kind, t.value = tokValue, Value{Kind: ValueBytes, Text: b}
+		return err
+	case isDigit(c) || c == '-' && start+1 < len(l.src) && isDigit(l.src[start+1]):
+		v, err := l.number()
+		t.kind, t.value = tokValue, v
+		return err
+	case isNameStart(c):
+		end := l.name(start)
+		name := l.src[start:end]
+		l.pos = end
+		if (name == "h" || name == "b64") && end < len(l.src) && l.src[end] == '\'' {
+			b, err := l.bytes(name)
+			t.kind, t.value = tokValue, Value{Kind: ValueBytes, Text: b}
+			return err
+		}
+		t.kind, t.text = tokName, name
+		return nil
+	case c == '.' && start+1 < len(l.src) && isAlpha(l.src[start+1]):
+		l.pos = l.name(start + 1)
+		t.kind, t.text = tokControl, l.src[start:l.pos]
+		return nil
+	case c == '#' && start+1 < len(l.src) && isDigit(l.src[start+1]):
+		t.kind, t.major = tokMajor, l.src[start+1]-'0'
+		if t.major > 7 {
+			return l.errorAt(start, "invalid major type")
+		}
+		l.pos = start + 2
+		if l.pos+1 < len(l.src) && l.src[l.pos] == '.' && isDigit(l.src[l.pos+1]) {
+			end := l.pos + 1
+			for end < len(l.src) && isDigit(l.src[end]) {
+				end++
+			}
+			arg, err := strconv.ParseUint(l.src[l.pos+1:end], 10, 64)
+			if err != nil {
+				return l.errorAt(start, "invalid argument of major type")
+			}
+			t.arg, t.hasArg, l.pos = arg, true, end
+		}
+		return nil
+	}
+	for _, p := range puncts {
+		if strings.HasPrefix(l.src[start:], p) {
+			l.pos += len(p)
+			t.kind, t.text = tokPunct, p
+			return nil
+		}
+	}
+	return l.errorAt(start, "unexpected character "+strconv.QuoteRune(rune(c)))
+}
+
+func (l *lexer) text() (string, error) {
+	start := l.pos
+	i := start + 1
+	for i < len(l.src) && l.src[i] != '"' && l.src[i] != '\n' {
+		if l.src[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(l.src) || l.src[i] != '"' {
+		return "", l.errorAt(start, "unterminated text string")
+	}
+	l.pos = i + 1
+	s, err := strconv.Unquote(strings.ReplaceAll(l.src[start:l.pos], `\/`, "/"))
+	if err != nil {
+		return "", l.errorAt(start, "invalid escape in text string")
+	}
+	return s, nil
+}
+
+// bytes reads a byte string with the quote at l.pos, of the given
+// encoding: raw, h (hex) or b64 (base64).
+func (l *lexer) bytes(encoding string) (string, error) {
+	start := l.pos
+	var sb strings.Builder
+	i := start + 1
+	for ; i < len(l.src) && l.src[i] != '\''; i++ {
+		c := l.src[i]
+		if c == '\\' && i+1 < len(l.src) {
+			i++
+			c = l.src[i]
+		}
+		if c == '\n' {
+			l.line++
+			l.lineStart = i + 1
+		}
+		if encoding == "" || c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			sb.WriteByte(c)
+		}
+	}
+	if i == len(l.src) {
+		return "", l.errorAt(start, "unterminated byte string")
+	}
+	l.pos = i + 1
+	content := sb.String()
+	switch encoding {
+	case "h":
+		b, err := hex.DecodeString(content)
+		if err != nil {
+			return "", l.errorAt(start, "invalid hex byte string")
+		}
+		return string(b), nil
+	case "b64":
+		for _, enc := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+			if b, err := enc.DecodeString(content); err == nil {
+				return string(b), nil
+			}
+		}
+		return "", l.errorAt(start, "invalid base64 byte string")
+	}
+	return content, nil
+}
+
+func (l *lexer) number() (Value, error) {
+	start := l.pos
+	i := start
+	neg := l.src[i] == '-'
+	if neg {
+		i++
+	}
+	base := 10
+	if strings.HasPrefix(l.src[i:], "0x") || strings.HasPrefix(l.src[i:], "0b") {
+		if l.src[i+1] == 'x' {
+			base = 16
+		} else {
+			base = 2
+		}
+		i += 2
+	}
+	digits := i
+	isFloat := false
+	for i < len(l.src) && (isDigit(l.src[i]) || base == 16 && strings.IndexByte("abcdefABCDEF", l.src[i]) >= 0) {
+		i++
+	}
+	if base == 10 && i+1 < len(l.src) && l.src[i] == '.' && isDigit(l.src[i+1]) {
+		isFloat = true
+		for i++; i < len(l.src) && isDigit(l.src[i]); i++ {
+		}
+	}
+	if base == 10 && i < len(l.src) && (l.src[i] == 'e' || l.src[i] == 'E') {
+		j := i + 1
+		if j < len(l.src) && (l.src[j] == '+' || l.src[j] == '-') {
+			j++
+		}
+		if j < len(l.src) && isDigit(l.src[j]) {
+			isFloat = true
+			for i = j; i < len(l.src) && isDigit(l.src[i]); i++ {
+			}
+		}
+	}
+	l.pos = i
+	if isFloat {
+		f, err := strconv.ParseFloat(l.src[start:i], 64)
+		if err != nil {
+			return Value{}, l.errorAt(start, "invalid number")
+		}
+		return Value{Kind: ValueFloat, Float: f}, nil
+	}
+	n, err := strconv.ParseUint(l.src[digits:i], base, 64)
+	if err != nil {
+		return Value{}, l.errorAt(start, "invalid number")
+	}
+	if neg && n > 0 {
+		return Value{Kind: ValueInt, Neg: true, Uint: n - 1}, nil
+	}
+	return Value{Kind: ValueInt, Uint: n}, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuation s.
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) errorf(t token, message string) error {
+	return &ParseError{Line: t.line, Column: t.col, Message: message}
+}
+
+func (p *parser) expect(s string) error {
+	if t := p.next(); t.kind != tokPunct || t.text != s {
+		return p.errorf(t, "expected "+s)
+	}
+	return nil
+}
+
+// rule is a rule as written, with its assignment operator.
+type rule struct {
+	Rule
+	assign string
+	tok    token
+}
+
+func (p *parser) rules() ([]rule, error) {
+	var rules []rule
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		if t.kind != tokName {
+			return nil, p.errorf(t, "expected rule name")
+		}
+		if p.is("<") && !p.peek().space {
+			return nil, p.errorf(p.peek(), "generic parameters are not supported")
+		}
+		assign := p.next()
+		if assign.kind != tokPunct || assign.text != "=" && assign.text != "/=" && assign.text != "//=" {
+			return nil, p.errorf(assign, "expected = after rule name")
+		}
+		entry, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule{Rule: Rule{Name: t.text, Entry: entry, Line: t.line}, assign: assign.text, tok: t})
+	}
+	return rules, nil
+}
+
+// group parses the entries of a group up to the closing punctuation.
+func (p *parser) group(end string) (*Group, error) {
+	g := &Group{Choices: [][]*GroupEntry{nil}}
+	for {
+		switch {
+		case p.is(end):
+			p.next()
+			return g, nil
+		case p.is("//"):
+			p.next()
+			g.Choices = append(g.Choices, nil)
+			continue
+		case p.peek().kind == tokEOF:
+			return nil, p.errorf(p.peek(), "expected "+end)
+		}
+		e, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		last := len(g.Choices) - 1
+		g.Choices[last] = append(g.Choices[last], e)
+		if p.is(",") {
+			p.next()
+		}
+	}
+}
+
+func (p *parser) entry() (*GroupEntry, error) {
+	e := &GroupEntry{Min: 1, Max: 1}
+	if err := p.occurrence(e); err != nil {
+		return nil, err
+	}
+	var first *Type2
+	if p.is("(") {
+		p.next()
+		g, err := p.group(")")
+		if err != nil {
+			return nil, err
+		}
+		// a group of a single type is a type in parentheses
+		if len(g.Choices) != 1 || len(g.Choices[0]) != 1 || !(&Rule{Entry: g.Choices[0][0]}).IsType() {
+			e.Group = g
+			return e, nil
+		}
+		first = &Type2{Kind: KindParen, Type: g.Choices[0][0].Type}
+	}
+	t1, err := p.type1(first)
+	if err != nil {
+		return nil, err
+	}
+	if p.is("^") {
+		p.next()
+		e.Cut = true
+		if !p.is("=>") {
+			return nil, p.errorf(p.peek(), "expected => after ^")
+		}
+	}
+	switch {
+	case p.is("=>"):
+		p.next()
+		e.Key = t1
+	case p.is(":"):
+		tok := p.next()
+		if t1.Op != "" || t1.Base.Kind != KindName && t1.Base.Kind != KindValue {
+			return nil, p.errorf(tok, "expected a name or a value before :")
+		}
+		if t1.Base.Kind == KindName {
+			t1 = &Type1{Base: &Type2{Kind: KindValue, Value: Value{Kind: ValueText, Text: t1.Base.Name}}}
+		}
+		e.Key, e.Cut = t1, true
+	default:
+		e.Type, err = p.typ(t1)
+		return e, err
+	}
+	e.Type, err = p.typ(nil)
+	return e, err
+}
+
+// occurrence parses ?, *, + or n*m.
+func (p *parser) occurrence(e *GroupEntry) error {
+	t := p.peek()
+	switch {
+	case p.is("?"):
+		p.next()
+		e.Min, e.Max = 0, 1
+	case p.is("+"):
+		p.next()
+		e.Min, e.Max = 1, Unbounded
+	case p.is("*"):
+		p.next()
+		e.Min, e.Max = 0, Unbounded
+		p.occurrenceMax(e)
+	case t.kind == tokValue && t.value.Kind == ValueInt && !t.value.Neg:
+		star := p.toks[p.pos+1]
+		if star.kind != tokPunct || star.text != "*" || star.space {
+			return nil
+		}
+		p.pos += 2
+		e.Min, e.Max = t.value.Uint, Unbounded
+		p.occurrenceMax(e)
+		if e.Min > e.Max {
+			return p.errorf(t, "occurrence minimum above maximum")
+		}
+	}
+	return nil
+}
+
+// occurrenceMax parses the maximum right after the * of an occurrence.
+func (p *parser) occurrenceMax(e *GroupEntry) {
+	t := p.peek()
+	if t.kind == tokValue && t.value.Kind == ValueInt && !t.value.Neg && !t.space {
+		p.next()
+		e.Max = t.value.Uint
+	}
+}
+
+// typ parses a choice of types, the first of which may have been parsed.
+func (p *parser) typ(first *Type1) (*Type, error) {
+	if first == nil {
+		t1, err := p.type1(nil)
+		if err != nil {
+			return nil, err
+		}
+		first = t1
+	}
+	t := &Type{Choices: []*Type1{first}}
+	for p.is("/") {
+		p.next()
+		t1, err := p.type1(nil)
+		if err != nil {
+			return nil, err
+		}
+		t.Choices = append(t.Choices, t1)
+	}
+	return t, nil
+}
+
+// type1 parses a type with an optional range or control operator. base is
+// the type before it if it has been parsed.
+func (p *parser) type1(base *Type2) (*Type1, error) {
+	if base == nil {
+		var err error
+		if base, err = p.type2(); err != nil {
+			return nil, err
+		}
+	}
+	t1 := &Type1{Base: base}
+	t := p.peek()
+	switch {
+	case p.is("..") || p.is("..."):
+		t1.Op = t.text
+	case t.kind == tokControl:
+		if !knownControl(t.text) {
+			return nil, p.errorf(t, "unsupported control operator "+t.text)
+		}
+		t1.Op = t.text
+	default:
+		return t1, nil
+	}
+	p.next()
+	arg, err := p.type2()
+	t1.Arg = arg
+	return t1, err
+}
+
+func (p *parser) type2() (*Type2, error) {
+	t := p.next()
+	switch t.kind {
+	case tokValue:
+		return &Type2{Kind: KindValue, Value: t.value}, nil
+	case tokName:
+		if p.is("<") && !p.peek().space {
+			return nil, p.errorf(p.peek(), "generic arguments are not supported")
+		}
+		return &Type2{Kind: KindName, Name: t.text}, nil
+	case tokMajor:
+		if t.major == 6 && t.hasArg && p.is("(") {
+			p.next()
+			inner, err := p.typ(nil)
+			if err != nil {
+				return nil, err
+			}
+			return &Type2{Kind: KindTag, Arg: t.arg, HasArg: true, Type: inner}, p.expect(")")
+		}
+		return &Type2{Kind: KindMajor, Major: t.major, Arg: t.arg, HasArg: t.hasArg}, nil
+	case tokPunct:
+		switch t.text {
+		case "#":
+			return &Type2{Kind: KindAny}, nil
+		case "(":
+			inner, err := p.typ(nil)
+			if err != nil {
+				return nil, err
+			}
+			return &Type2{Kind: KindParen, Type: inner}, p.expect(")")
+		case "{", "[":
+			end, kind := "}", KindMap
+			if t.text == "[" {
+				end, kind = "]", KindArray
+			}
+			g, err := p.group(end)
+			return &Type2{Kind: kind, Group: g}, err
+		case "~":
+			name := p.next()
+			if name.kind != tokName {
+				return nil, p.errorf(name, "expected a name after ~")
+			}
+			return &Type2{Kind: KindUnwrap, Name: name.text}, nil
+		case "&":
+			if p.is("(") {
+				p.next()
+				g, err := p.group(")")
+				return &Type2{Kind: KindEnum, Group: g}, err
+			}
+			name := p.next()
+			if name.kind != tokName {
+				return nil, p.errorf(name, "expected a name or a group after &")
+			}
+			return &Type2{Kind: KindEnum, Name: name.text}, nil
+		}
+	case tokEOF:
+		return nil, p.errorf(t, "unexpected end of input")
+	}
+	return nil, p.errorf(t, "expected a type")
+}
+
+func knownControl(op string) bool {
+	switch op {
+	case ".size", ".regexp", ".lt", ".le", ".gt", ".ge", ".eq", ".ne", ".default", ".cbor", ".and", ".within":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,897 @@
+package cddl
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+// maxDepth bounds the nesting of rule references while validating, so
+// that rules referring to themselves without consuming data fail. It
+// leaves room for ten references per level of data nested as deep as
+// cbor.DefaultMaxDepth.
+const maxDepth = 10 * cbor.DefaultMaxDepth
+
+// ValidationError reports the first part of a data item that does not
+// match a schema. When choices leave several candidates, it is the
+// mismatch furthest into the data.
+type ValidationError struct {
+	// Path locates the item from the root, as map keys and array indexes
+	// separated by slashes: "/" for the root, "/people/0/name" below it.
+	Path string
+	// Offset is the offset of the item in the input.
+	Offset  uint32
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "cddl: " + e.Message + " at " + e.Path + ", offset " + strconv.FormatUint(uint64(e.Offset), 10)
+}
+
+// DefaultMaxItems is the number of data items that Validate reads when
+// Schema.Limits.MaxItems is zero.
+const DefaultMaxItems = 1 << 18
+
+// DefaultMaxSteps is the number of matching steps that Validate takes when
+// Schema.MaxSteps is zero.
+const DefaultMaxSteps = 1 << 23
+
+// ErrTooComplex is returned by Validate when matching takes more than
+// Schema.MaxSteps steps, as ambiguous repetitions such as [* (* int)] can
+// on long arrays.
+var ErrTooComplex = cbor.NewReadError("cddl: validation takes too many steps")
+
+// Validate reads one data item from d and checks it against the type rule
+// name, or against the first rule of the schema if name is empty.
+// Malformed data is reported with the error of the decoder, and data
+// beyond the limits of the schema with cbor.ErrTooDeep or an error about
+// its items.
+//
+// Choices backtrack, so the data is decoded into a tree before it is
+// matched. The tree takes about 100 bytes per data item, plus a copy of
+// the strings; with the default limits, that is at most about 26 MB on
+// top of the input.
+func (s *Schema) Validate(d *cbor.Decoder, name string) error {
+	r := s.Rules[0]
+	if name != "" {
+		if r = s.lookup(name); r == nil {
+			return cbor.NewReadError("cddl: undefined rule " + name)
+		}
+	}
+	if !r.IsType() {
+		return cbor.NewReadError("cddl: rule " + r.Name + " is a group, not a type")
+	}
+	it, err := s.reader(d, 0).read(0)
+	if err != nil {
+		return err
+	}
+	v := validator{s: s, arrays: make(map[arrayPos][]int), maxSteps: s.MaxSteps}
+	if v.maxSteps == 0 {
+		v.maxSteps = DefaultMaxSteps
+	}
+	if v.matchType(r.Entry.Type, it) {
+		return nil
+	}
+	if v.exhausted {
+		return ErrTooComplex
+	}
+	return v.err
+}
+
+// item is a decoded data item. Choices and occurrences backtrack, so the
+// data is decoded once into items before it is matched.
+type item struct {
+	offset uint32
+	// major is the major type in the high bits, as cbor.TypeMajorText
+	major uint8
+	// arg is the value of an integer (-1-arg for negative ones), a tag
+	// number or a simple value; for floats, it is the additional
+	// information 25, 26 or 27 that tells their precision.
+	arg   uint64
+	float float64
+	// content of strings and offset of its first byte
+	content       []byte
+	contentOffset uint32
+	// elements of arrays, alternating keys and values of maps and the
+	// content of tags
+	items []*item
+}
+
+// itemReader decodes data items into trees within limits.
+type itemReader struct {
+	d *cbor.Decoder
+	// base is added to the offsets
+	base   uint32
+	limits cbor.Limits
+	items  uint64
+}
+
+// reader returns an itemReader for the limits of the schema, with zero
+// ones replaced by their defaults.
+func (s *Schema) reader(d *cbor.Decoder, base uint32) *itemReader {
+	limits := s.Limits
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = cbor.DefaultMaxDepth
+	}
+	if limits.MaxItems == 0 {
+		limits.MaxItems = DefaultMaxItems
+	}
+	return &itemReader{d: d, base: base, limits: limits}
+}
+
+// read reads the next data item, nested in depth arrays, maps and tags.
+func (r *itemReader) read(depth int) (*item, error) {
+	d, base := r.d, r.base
+	offset := d.Pos()
+	head, err := d.PeekType()
+	if err != nil {
+		return nil, err
+	}
+	it := &item{offset: base + offset, major: head.Major, arg: head.Arg}
+	if r.items++; r.items > r.limits.MaxItems {
+		return nil, cbor.NewReadError("cddl: more than " + strconv.FormatUint(r.limits.MaxItems, 10) + " data items")
+	}
+	if r.limits.MaxLength > 0 && !head.Indefinite && head.Major >= cbor.TypeMajorBytes && head.Major <= cbor.TypeMajorMap &&
+		head.Arg > r.limits.MaxLength {
+		return nil, cbor.NewReadError("cddl: length " + strconv.FormatUint(head.Arg, 10) + " over limit")
+	}
+	if head.Major >= cbor.TypeMajorArray && head.Major <= cbor.TypeMajorTagged && depth >= r.limits.MaxDepth {
+		return nil, cbor.ErrTooDeep
+	}
+	switch head.Major {
+	case cbor.TypeMajorBytes:
+		it.contentOffset = it.offset + uint32(head.HeadLen)
+		it.content, err = d.ReadByteArrayChunked()
+	case cbor.TypeMajorText:
+		var s string
+		s, err = d.ReadStringChunked()
+		it.content = []byte(s)
+	case cbor.TypeMajorArray, cbor.TypeMajorMap:
+		var size uint32
+		var indef bool
+		if head.Major == cbor.TypeMajorArray {
+			size, indef, err = d.ReadArraySize()
+		} else {
+			size, indef, err = d.ReadMapSize()
+			size *= 2
+		}
+		for i := uint32(0); err == nil && (indef || i < size); i++ {
+			if indef {
+				if end, err := d.ReadBreak(); err != nil {
+					return nil, err
+				} else if end {
+					break
+				}
+			}
+			var child *item
+			if child, err = r.read(depth + 1); err == nil {
+				it.items = append(it.items, child)
+			}
+		}
+		if err == nil && head.Major == cbor.TypeMajorMap && len(it.items)%2 == 1 {
+			err = cbor.NewReadError("map key without a value")
+		}
+	case cbor.TypeMajorTagged:
+		var child *item
+		if _, err = d.ReadTag(); err == nil {
+			if child, err = r.read(depth + 1); err == nil {
+				it.items = []*item{child}
+			}
+		}
+	case cbor.TypeMajorSimple:
+		switch head.Simple {
+		case cbor.SimpleFloat16, cbor.SimpleFloat32, cbor.SimpleFloat64:
+			it.arg = 25 + uint64(head.Simple-cbor.SimpleFloat16)
+			it.float, err = d.ReadFloat64()
+		case cbor.SimpleBreak:
+			err = cbor.NewReadError("unexpected break")
+		default:
+			err = d.Skip()
+		}
+	default:
+		err = d.Skip()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// describe returns a short description of the item for error messages.
+func (it *item) describe() string {
+	switch it.major {
+	case cbor.TypeMajorUnsigned:
+		return strconv.FormatUint(it.arg, 10)
+	case cbor.TypeMajorSigned:
+		return Value{Kind: ValueInt, Neg: true, Uint: it.arg}.String()
+	case cbor.TypeMajorBytes:
+		return "byte string"
+	case cbor.TypeMajorText:
+		return "text string"
+	case cbor.TypeMajorArray:
+		return "array"
+	case cbor.TypeMajorMap:
+		return "map"
+	case cbor.TypeMajorTagged:
+		return "tag " + strconv.FormatUint(it.arg, 10)
+	}
+	if it.isFloat() {
+		return Value{Kind: ValueFloat, Float: it.float}.String()
+	}
+	switch it.arg {
+	case 20:
+		return "false"
+	case 21:
+		return "true"
+	case 22:
+		return "null"
+	case 23:
+		return "undefined"
+	}
+	return "simple(" + strconv.FormatUint(it.arg, 10) + ")"
+}
+
+func (it *item) isFloat() bool {
+	return it.major == cbor.TypeMajorSimple && it.arg >= 25 && it.arg <= 27
+}
+
+// pathElem returns the path element of a map key.
+func (it *item) pathElem() string {
+	if it.major == cbor.TypeMajorText {
+		return string(it.content)
+	}
+	return it.describe()
+}
+
+// arrayPos identifies a group being matched at a position of an array.
+type arrayPos struct {
+	group *Group
+	array *item
+	index int
+}
+
+type validator struct {
+	s    *Schema
+	path []string
+	// the mismatch reported if validation fails. A strong mismatch
+	// explains more than a type that does not match at the same offset.
+	err    *ValidationError
+	strong bool
+	// quiet suppresses mismatches, while trying map keys and enumerations
+	quiet int
+	// optional suppresses missing map entries, while trying groups that
+	// need not occur
+	optional int
+	depth    int
+	// groups expanded from group rules
+	groups map[*Rule]*Group
+	// the ends of the groups matched in arrays, by position
+	arrays map[arrayPos][]int
+	// steps counts the work done, up to maxSteps
+	steps, maxSteps uint64
+	exhausted       bool
+}
+
+// step adds n steps of work, and reports false once there have been more
+// than maxSteps.
+func (v *validator) step(n int) bool {
+	v.steps += uint64(n)
+	if v.steps > v.maxSteps {
+		v.exhausted = true
+	}
+	return !v.exhausted
+}
+
+// fail records a mismatch at it, unless one further into the data or an
+// equally deep strong one is known.
+func (v *validator) fail(it *item, message string, strong bool) {
+	if v.quiet > 0 {
+		return
+	}
+	if v.err != nil && (it.offset < v.err.Offset || it.offset == v.err.Offset && v.strong) {
+		return
+	}
+	v.err = &ValidationError{Path: "/" + strings.Join(v.path, "/"), Offset: it.offset, Message: message}
+	v.strong = strong
+}
+
+func (v *validator) push(elem string) {
+	v.path = append(v.path, elem)
+}
+
+func (v *validator) pop() {
+	v.path = v.path[:len(v.path)-1]
+}
+
+func (v *validator) matchType(t *Type, it *item) bool {
+	if !v.step(1) {
+		return false
+	}
+	for _, c := range t.Choices {
+		if v.matchType1(c, it) {
+			return true
+		}
+	}
+	if v.quiet > 0 {
+		return false
+	}
+	parts := make([]string, len(t.Choices))
+	for i, c := range t.Choices {
+		switch {
+		case c.Op == "" && c.Base.Kind == KindMap:
+			parts[i] = "map"
+		case c.Op == "" && c.Base.Kind == KindArray:
+			parts[i] = "array"
+		default:
+			parts[i] = c.String()
+		}
+	}
+	v.fail(it, "expected "+strings.Join(parts, " / ")+", got "+it.describe(), false)
+	return false
+}
+
+func (v *validator) matchType1(t *Type1, it *item) bool {
+	if t.Op == ".." || t.Op == "..." {
+		return v.matchRange(t, it)
+	}
+	if !v.matchType2(t.Base, it) {
+		return false
+	}
+	switch t.Op {
+	case ".size":
+		return v.matchSize(t, it)
+	case ".regexp":
+		if it.major != cbor.TypeMajorText || !t.re.Match(it.content) {
+			v.fail(it, "text does not match "+t.Arg.String(), true)
+			return false
+		}
+	case ".lt", ".le", ".gt", ".ge":
+		arg, _ := v.s.value(t.Arg)
+		c, ok := compare(it, arg)
+		if !ok || !(t.Op == ".lt" && c < 0 || t.Op == ".le" && c <= 0 || t.Op == ".gt" && c > 0 || t.Op == ".ge" && c >= 0) {
+			v.fail(it, it.describe()+" is not "+t.Op[1:]+" "+t.Arg.String(), true)
+			return false
+		}
+	case ".eq", ".ne":
+		arg, _ := v.s.value(t.Arg)
+		if matchValue(arg, it) != (t.Op == ".eq") {
+			v.fail(it, it.describe()+" is not "+t.Op[1:]+" "+t.Arg.String(), true)
+			return false
+		}
+	case ".cbor":
+		if it.major != cbor.TypeMajorBytes {
+			return false
+		}
+		d := cbor.NewDecoder(it.content)
+		inner, err := v.s.reader(&d, it.contentOffset).read(0)
+		if err != nil || !d.Done() {
+			v.fail(it, "byte string does not hold one CBOR data item", true)
+			return false
+		}
+		return v.matchType2(t.Arg, inner)
+	case ".and", ".within":
+		return v.matchType2(t.Arg, it)
+	}
+	return true
+}
+
+func (v *validator) matchRange(t *Type1, it *item) bool {
+	lo, _ := v.s.value(t.Base)
+	hi, _ := v.s.value(t.Arg)
+	// integer ranges match integers, float ranges floats
+	isInt := lo.Kind == ValueInt && hi.Kind == ValueInt
+	if isInt != (it.major == cbor.TypeMajorUnsigned || it.major == cbor.TypeMajorSigned) || !isInt && !it.isFloat() {
+		v.fail(it, "expected "+t.String()+", got "+it.describe(), false)
+		return false
+	}
+	cLo, _ := compare(it, lo)
+	cHi, _ := compare(it, hi)
+	if cLo < 0 || cHi > 0 || cHi == 0 && t.Op == "..." {
+		v.fail(it, it.describe()+" is out of range "+t.String(), false)
+		return false
+	}
+	return true
+}
+
+func (v *validator) matchSize(t *Type1, it *item) bool {
+	switch it.major {
+	case cbor.TypeMajorBytes, cbor.TypeMajorText:
+		n := &item{offset: it.offset, arg: uint64(len(it.content))}
+		v.quiet++
+		ok := v.matchType2(t.Arg, n)
+		v.quiet--
+		if !ok {
+			v.fail(it, "length "+n.describe()+" does not match .size "+t.Arg.String(), true)
+		}
+		return ok
+	case cbor.TypeMajorUnsigned:
+		size, ok := v.s.value(t.Arg)
+		if ok && size.Kind == ValueInt && !size.Neg && (size.Uint >= 8 || it.arg < 1<<(8*size.Uint)) {
+			return true
+		}
+		v.fail(it, it.describe()+" does not fit .size "+t.Arg.String(), true)
+		return false
+	}
+	v.fail(it, ".size does not apply to "+it.describe(), true)
+	return false
+}
+
+func (v *validator) matchType2(t *Type2, it *item) bool {
+	switch t.Kind {
+	case KindAny:
+		return true
+	case KindValue:
+		if matchValue(t.Value, it) {
+			return true
+		}
+	case KindName:
+		r := v.s.lookup(t.Name)
+		if r == nil {
+			// an undefined socket matches nothing
+			break
+		}
+		if !r.IsType() {
+			v.fail(it, "group "+t.Name+" used as a type", true)
+			return false
+		}
+		if !v.enter(it) {
+			return false
+		}
+		ok := v.matchType(r.Entry.Type, it)
+		v.depth--
+		if ok {
+			return true
+		}
+	case KindParen:
+		return v.matchType(t.Type, it)
+	case KindMap:
+		if it.major == cbor.TypeMajorMap {
+			return v.matchMap(t.Group, it)
+		}
+		v.fail(it, "expected map, got "+it.describe(), false)
+		return false
+	case KindArray:
+		if it.major == cbor.TypeMajorArray {
+			return v.matchArray(t.Group, it)
+		}
+		v.fail(it, "expected array, got "+it.describe(), false)
+		return false
+	case KindUnwrap:
+		if inner := v.unwrap(t.Name); inner != nil && inner.Kind == KindTag {
+			return v.matchType(inner.Type, it)
+		}
+		v.fail(it, "~"+t.Name+" is not a tag and cannot be used as a type", true)
+		return false
+	case KindEnum:
+		g := t.Group
+		if g == nil {
+			g = v.ruleGroup(v.s.lookup(t.Name))
+		}
+		v.quiet++
+		ok := g != nil && v.matchEnum(g, it)
+		v.quiet--
+		if ok {
+			return true
+		}
+	case KindTag:
+		if it.major == cbor.TypeMajorTagged && it.arg == t.Arg {
+			return v.matchType(t.Type, it.items[0])
+		}
+	case KindMajor:
+		if it.major>>5 == t.Major && (!t.HasArg || it.arg == t.Arg) {
+			return true
+		}
+	}
+	v.fail(it, "expected "+t.String()+", got "+it.describe(), false)
+	return false
+}
+
+// enter counts a level of rule references, failing beyond maxDepth. The
+// caller decrements v.depth when it succeeds.
+func (v *validator) enter(it *item) bool {
+	if v.depth >= maxDepth {
+		v.fail(it, "rules nest too deep", true)
+		return false
+	}
+	v.depth++
+	return true
+}
+
+// unwrap returns the type that ~name removes the outer layer of: a map,
+// an array or a tag.
+func (v *validator) unwrap(name string) *Type2 {
+	r := v.s.lookup(name)
+	if r == nil || !r.IsType() || len(r.Entry.Type.Choices) != 1 || r.Entry.Type.Choices[0].Op != "" {
+		return nil
+	}
+	return r.Entry.Type.Choices[0].Base
+}
+
+// ruleGroup returns the group of a group rule.
+func (v *validator) ruleGroup(r *Rule) *Group {
+	if r == nil || r.IsType() {
+		return nil
+	}
+	if g, ok := v.groups[r]; ok {
+		return g
+	}
+	if v.groups == nil {
+		v.groups = make(map[*Rule]*Group)
+	}
+	g := &Group{Choices: [][]*GroupEntry{{r.Entry}}}
+	v.groups[r] = g
+	return g
+}
+
+// entryGroup returns the group that e stands for: its inline group, the
+// group of a group rule it names, or the group of a map or array it
+// unwraps. It returns nil if e is a type.
+func (v *validator) entryGroup(e *GroupEntry) *Group {
+	if e.Group != nil {
+		return e.Group
+	}
+	if e.Key != nil || len(e.Type.Choices) != 1 || e.Type.Choices[0].Op != "" {
+		return nil
+	}
+	t := e.Type.Choices[0].Base
+	switch t.Kind {
+	case KindName:
+		if r := v.s.lookup(t.Name); r != nil {
+			return v.ruleGroup(r)
+		}
+		if strings.HasPrefix(t.Name, "$$") {
+			// an undefined group socket is empty
+			return &Group{Choices: [][]*GroupEntry{nil}}
+		}
+	case KindUnwrap:
+		if inner := v.unwrap(t.Name); inner != nil && (inner.Kind == KindMap || inner.Kind == KindArray) {
+			return inner.Group
+		}
+	}
+	return nil
+}
+
+// matchEnum matches it against the values of the entries of g.
+func (v *validator) matchEnum(g *Group, it *item) bool {
+	if !v.enter(it) {
+		return false
+	}
+	defer func() { v.depth-- }()
+	for _, entries := range g.Choices {
+		for _, e := range entries {
+			if sub := v.entryGroup(e); sub != nil {
+				if v.matchEnum(sub, it) {
+					return true
+				}
+			} else if v.matchType(e.Type, it) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *validator) matchMap(g *Group, m *item) bool {
+choices:
+	for _, entries := range g.Choices {
+		used := make([]bool, len(m.items)/2)
+		if !v.mapEntries(entries, m, used) {
+			continue
+		}
+		for i, u := range used {
+			if !u {
+				key := m.items[2*i]
+				v.push(key.pathElem())
+				v.fail(key, "unexpected map key "+key.describe(), true)
+				v.pop()
+				continue choices
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// mapEntries matches entries against the entries of m that are not used
+// yet, marking the ones that match.
+func (v *validator) mapEntries(entries []*GroupEntry, m *item, used []bool) bool {
+	for _, e := range entries {
+		if g := v.entryGroup(e); g != nil {
+			if !v.mapGroup(e, g, m, used) {
+				return false
+			}
+			continue
+		}
+		if e.Key == nil {
+			v.fail(m, "map entry "+e.String()+" has no key", true)
+			return false
+		}
+		count := uint64(0)
+		for i := 0; i < len(used) && count < e.Max; i++ {
+			if used[i] {
+				continue
+			}
+			key, value := m.items[2*i], m.items[2*i+1]
+			v.quiet++
+			ok := v.matchType1(e.Key, key)
+			v.quiet--
+			if !ok {
+				continue
+			}
+			v.push(key.pathElem())
+			ok = v.matchType(e.Type, value)
+			v.pop()
+			if ok {
+				used[i] = true
+				count++
+			} else if e.Cut {
+				return false
+			}
+		}
+		if count < e.Min {
+			if v.optional == 0 {
+				v.fail(m, "missing entry "+e.String(), true)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// mapGroup matches the occurrences of the group g of entry e in m.
+func (v *validator) mapGroup(e *GroupEntry, g *Group, m *item, used []bool) bool {
+	if !v.enter(m) {
+		return false
+	}
+	defer func() { v.depth-- }()
+	count := uint64(0)
+	for count < e.Max {
+		if count >= e.Min {
+			v.optional++
+		}
+		matched, progress := false, false
+		for _, entries := range g.Choices {
+			trial := append([]bool(nil), used...)
+			if v.mapEntries(entries, m, trial) {
+				for i := range trial {
+					progress = progress || trial[i] != used[i]
+				}
+				copy(used, trial)
+				matched = true
+				break
+			}
+		}
+		if count >= e.Min {
+			v.optional--
+		}
+		if !matched {
+			break
+		}
+		count++
+		if !progress {
+			// an empty occurrence can repeat as often as needed
+			count = e.Max
+		}
+	}
+	if count < e.Min {
+		if v.optional == 0 {
+			v.fail(m, "missing entries ("+g.String()+")", true)
+		}
+		return false
+	}
+	return true
+}
+
+func (v *validator) matchArray(g *Group, a *item) bool {
+	ends := v.arrayGroup(g, a, 0)
+	if len(ends) == 0 {
+		return false
+	}
+	end := ends[len(ends)-1]
+	if end == len(a.items) {
+		return true
+	}
+	// a mismatch of the item itself explains more
+	if next := a.items[end]; v.err == nil || v.err.Offset < next.offset {
+		v.push(strconv.Itoa(end))
+		v.fail(next, "unexpected array item "+next.describe(), true)
+		v.pop()
+	}
+	return false
+}
+
+// arrayGroup matches g against the items of a from index i and returns the
+// index after each way it matches, in ascending order. Results are
+// memoized, so that ambiguous repetitions take polynomial time.
+func (v *validator) arrayGroup(g *Group, a *item, i int) []int {
+	pos := arrayPos{group: g, array: a, index: i}
+	if ends, ok := v.arrays[pos]; ok {
+		// nil while g is being matched here: g refers to itself without
+		// consuming items
+		return ends
+	}
+	v.arrays[pos] = nil
+	var ends []int
+	for _, entries := range g.Choices {
+		ends = union(ends, v.arrayEntries(entries, a, i))
+	}
+	v.arrays[pos] = ends
+	return ends
+}
+
+func (v *validator) arrayEntries(entries []*GroupEntry, a *item, i int) []int {
+	ends := []int{i}
+	for _, e := range entries {
+		if ends = v.arrayRepeat(e, a, ends); len(ends) == 0 {
+			break
+		}
+	}
+	return ends
+}
+
+// arrayRepeat returns the indexes after e.Min to e.Max occurrences of e
+// from any of starts, in ascending order. Further occurrences are only
+// tried from indexes not reached before, which keeps the work polynomial;
+// an empty occurrence can repeat as often as needed.
+func (v *validator) arrayRepeat(e *GroupEntry, a *item, starts []int) []int {
+	var ends []int
+	var reached map[int]bool
+	mark := func(i int) {
+		if reached == nil {
+			reached = make(map[int]bool)
+		}
+		reached[i] = true
+		ends = append(ends, i)
+	}
+	if e.Min == 0 {
+		for _, i := range starts {
+			mark(i)
+		}
+	}
+	level := starts
+	for n := uint64(0); n < e.Max && len(level) > 0; n++ {
+		var next []int
+		for _, i := range level {
+			once := v.arrayOnce(e, n, a, i)
+			if !v.step(len(once)) {
+				return nil
+			}
+			for _, j := range once {
+				if j != i {
+					next = append(next, j)
+				} else if !reached[i] {
+					mark(i)
+				}
+			}
+		}
+		if len(next) > 1 {
+			sort.Ints(next)
+		}
+		level = nil
+		for k, j := range next {
+			if reached[j] || k > 0 && j == next[k-1] {
+				continue
+			}
+			level = append(level, j)
+			if n+1 >= e.Min {
+				mark(j)
+			}
+		}
+	}
+	sort.Ints(ends)
+	return ends
+}
+
+// arrayOnce matches one occurrence of e, the n+1st, from index i, and
+// returns the indexes after it. Keys are ignored in arrays.
+func (v *validator) arrayOnce(e *GroupEntry, n uint64, a *item, i int) []int {
+	if g := v.entryGroup(e); g != nil {
+		return v.arrayGroup(g, a, i)
+	}
+	if i == len(a.items) {
+		if n < e.Min {
+			v.fail(a, "missing array item "+e.String(), true)
+		}
+		return nil
+	}
+	v.push(strconv.Itoa(i))
+	ok := v.matchType(e.Type, a.items[i])
+	v.pop()
+	if !ok {
+		return nil
+	}
+	return []int{i + 1}
+}
+
+// union merges two ascending sets of indexes.
+func union(a, b []int) []int {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	out := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			out, a = append(out, a[0]), a[1:]
+		case a[0] > b[0]:
+			out, b = append(out, b[0]), b[1:]
+		default:
+			out, a, b = append(out, a[0]), a[1:], b[1:]
+		}
+	}
+	out = append(out, a...)
+	return append(out, b...)
+}
+
+// matchValue reports whether it equals the literal value.
+func matchValue(val Value, it *item) bool {
+	switch val.Kind {
+	case ValueInt:
+		return it.arg == val.Uint && (it.major == cbor.TypeMajorUnsigned && !val.Neg || it.major == cbor.TypeMajorSigned && val.Neg)
+	case ValueFloat:
+		return it.isFloat() && it.float == val.Float
+	case ValueText:
+		return it.major == cbor.TypeMajorText && string(it.content) == val.Text
+	}
+	return it.major == cbor.TypeMajorBytes && bytes.Equal(it.content, []byte(val.Text))
+}
+
+// compare returns the sign of the number it minus val, and false if it is
+// not a number.
+func compare(it *item, val Value) (int, bool) {
+	switch {
+	case it.isFloat() || val.Kind == ValueFloat:
+		f, ok := itemFloat(it)
+		if !ok {
+			return 0, false
+		}
+		g := val.Float
+		if val.Kind == ValueInt {
+			g = intFloat(val.Neg, val.Uint)
+		}
+		switch {
+		case f < g:
+			return -1, true
+		case f > g:
+			return 1, true
+		}
+		return 0, true
+	case it.major == cbor.TypeMajorUnsigned || it.major == cbor.TypeMajorSigned:
+		neg := it.major == cbor.TypeMajorSigned
+		switch {
+		case neg != val.Neg && neg:
+			return -1, true
+		case neg != val.Neg:
+			return 1, true
+		case it.arg == val.Uint:
+			return 0, true
+		case (it.arg < val.Uint) != neg:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func itemFloat(it *item) (float64, bool) {
+	switch {
+	case it.isFloat():
+		return it.float, true
+	case it.major == cbor.TypeMajorUnsigned || it.major == cbor.TypeMajorSigned:
+		return intFloat(it.major == cbor.TypeMajorSigned, it.arg), true
+	}
+	return 0, false
+}
+
+func intFloat(neg bool, u uint64) float64 {
+	if neg {
+		return -1 - float64(u)
+	}
+	return float64(u)
+}
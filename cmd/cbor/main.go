@@ -0,0 +1,257 @@
+// Command cbor inspects and converts CBOR data.
+//
+// Usage:
+//
+//	cbor diag [flags] [file]      print diagnostic notation (RFC 8949 §8)
+//	cbor annotate [flags] [file]  print an annotated hex listing
+//	cbor json [flags] [file]      convert to JSON
+//	cbor fromjson [flags] [file]  convert JSON to CBOR
+//	cbor validate [flags] [file]  check well-formedness and limits
+//	cbor canon [flags] [file]     re-encode deterministically
+//
+// Every subcommand reads file, or standard input if no file is given. CBOR
+// input is raw bytes unless -in selects hex or base64, in which case white
+// space is ignored, so that blobs can be pasted from logs; -x is short for
+// -in=hex. Subcommands writing CBOR take -out with the same formats.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+const usageText = `usage: cbor <command> [flags] [file]
+
+commands:
+  diag      print diagnostic notation
+  annotate  print an annotated hex listing
+  json      convert to JSON
+  fromjson  convert JSON to CBOR
+  validate  check well-formedness and limits
+  canon     re-encode deterministically
+
+run cbor <command> -h for the flags of a command
+`
+
+// commands run with their arguments, reading input from stdin if no file
+// is given and writing output to stdout.
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"diag":     diag,
+	"annotate": annotate,
+	"json":     toJSON,
+	"fromjson": fromJSON,
+	"validate": validate,
+	"canon":    canon,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usageText)
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usageText)
+		os.Exit(2)
+	}
+	if err := command(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "cbor %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// input holds the flags selecting the input of a command.
+type input struct {
+	flags  *flag.FlagSet
+	format *string
+	hex    *bool
+}
+
+func newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: cbor %s [flags] [file]\n", name)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func newInput(name string) input {
+	flags := newFlags(name)
+	return input{
+		flags:  flags,
+		format: flags.String("in", "raw", "input format: raw, hex or base64"),
+		hex:    flags.Bool("x", false, "short for -in=hex"),
+	}
+}
+
+// read parses args and reads the CBOR input.
+func (in input) read(args []string, stdin io.Reader) ([]byte, error) {
+	data, err := readFile(in.flags, args, stdin)
+	if err != nil {
+		return nil, err
+	}
+	format := *in.format
+	if *in.hex {
+		format = "hex"
+	}
+	return decodeText(data, format)
+}
+
+// readFile parses args and reads the file they name, or stdin.
+func readFile(flags *flag.FlagSet, args []string, stdin io.Reader) ([]byte, error) {
+	_ = flags.Parse(args)
+	switch flags.NArg() {
+	case 0:
+		return io.ReadAll(stdin)
+	case 1:
+		return os.ReadFile(flags.Arg(0))
+	}
+	return nil, errors.New("too many arguments")
+}
+
+func decodeText(data []byte, format string) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(data)), "")
+	switch format {
+	case "raw":
+		return data, nil
+	case "hex":
+		return hex.DecodeString(text)
+	case "base64":
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if decoded, err := enc.DecodeString(text); err == nil {
+				return decoded, nil
+			}
+		}
+		return nil, errors.New("invalid base64 input")
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// outputFlag adds the -out flag of commands writing CBOR.
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("out", "raw", "output format: raw, hex or base64")
+}
+
+func writeCBOR(stdout io.Writer, data []byte, format string) error {
+	var err error
+	switch format {
+	case "raw":
+		_, err = stdout.Write(data)
+	case "hex":
+		_, err = fmt.Fprintln(stdout, hex.EncodeToString(data))
+	case "base64":
+		_, err = fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(data))
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	return err
+}
+
+func diag(args []string, stdin io.Reader, stdout io.Writer) error {
+	data, err := newInput("diag").read(args, stdin)
+	if err != nil {
+		return err
+	}
+	text, err := cbor.Diag(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, text)
+	return err
+}
+
+func annotate(args []string, stdin io.Reader, stdout io.Writer) error {
+	data, err := newInput("annotate").read(args, stdin)
+	if err != nil {
+		return err
+	}
+	listing, err := cbor.Annotate(data)
+	if _, werr := io.WriteString(stdout, listing); err == nil {
+		err = werr
+	}
+	return err
+}
+
+func toJSON(args []string, stdin io.Reader, stdout io.Writer) error {
+	in := newInput("json")
+	nonFinite := in.flags.String("nonfinite", "null", "output for NaN and infinities: null, string or error")
+	data, err := in.read(args, stdin)
+	if err != nil {
+		return err
+	}
+	var opts cbor.ToJSONOptions
+	switch *nonFinite {
+	case "null":
+		opts.NonFinite = cbor.NonFiniteNull
+	case "string":
+		opts.NonFinite = cbor.NonFiniteString
+	case "error":
+		opts.NonFinite = cbor.NonFiniteError
+	default:
+		return fmt.Errorf("unknown -nonfinite %q", *nonFinite)
+	}
+	w := bufio.NewWriter(stdout)
+	if err := cbor.ToJSON(data, w, opts); err != nil {
+		return err
+	}
+	if err := w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func fromJSON(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := newFlags("fromjson")
+	out := outputFlag(flags)
+	bigNums := flags.Bool("bignum", false, "encode integers beyond 64 bits as bignums instead of floats")
+	data, err := readFile(flags, args, stdin)
+	if err != nil {
+		return err
+	}
+	encoded, err := cbor.FromJSONBytes(data, cbor.FromJSONOptions{BigNums: *bigNums})
+	if err != nil {
+		return err
+	}
+	return writeCBOR(stdout, encoded, *out)
+}
+
+func validate(args []string, stdin io.Reader, stdout io.Writer) error {
+	in := newInput("validate")
+	var limits cbor.Limits
+	in.flags.IntVar(&limits.MaxDepth, "depth", cbor.DefaultMaxDepth, "maximum nesting depth")
+	in.flags.Uint64Var(&limits.MaxLength, "length", 0, "maximum length of strings, arrays and maps, 0 for no limit")
+	in.flags.Uint64Var(&limits.MaxItems, "items", 0, "maximum number of data items, 0 for no limit")
+	data, err := in.read(args, stdin)
+	if err != nil {
+		return err
+	}
+	if err := cbor.Validate(data, limits); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, "ok")
+	return err
+}
+
+func canon(args []string, stdin io.Reader, stdout io.Writer) error {
+	in := newInput("canon")
+	out := outputFlag(in.flags)
+	data, err := in.read(args, stdin)
+	if err != nil {
+		return err
+	}
+	encoded, err := cbor.Canonical(data)
+	if err != nil {
+		return err
+	}
+	return writeCBOR(stdout, encoded, *out)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	// {"b": 2, "a": 1.0}
+	const input = "a2 6162 02 6161 f93c00\n"
+	for _, tc := range []struct {
+		args   []string
+		stdin  string
+		stdout string
+		err    string
+	}{
+		{args: []string{"diag", "-x"}, stdin: input, stdout: "{\"b\": 2, \"a\": 1.0}\n"},
+		{args: []string{"diag", "-in=base64"}, stdin: "gwECAw==", stdout: "[1, 2, 3]\n"},
+		{args: []string{"diag"}, stdin: "\x83\x01\x02\x03", stdout: "[1, 2, 3]\n"},
+		{args: []string{"diag", "-x"}, stdin: "81", err: "range error"},
+		{args: []string{"diag", "-in=octal"}, stdin: "01", err: `unknown format "octal"`},
+		{args: []string{"annotate", "-x"}, stdin: input, stdout: "" +
+			"000000  a2         # map(2)\n" +
+			"000001    61 62    # text(1) \"b\"\n" +
+			"000003    02       # unsigned(2)\n" +
+			"000004    61 61    # text(1) \"a\"\n" +
+			"000006    f9 3c00  # float16(1)\n"},
+		{args: []string{"annotate", "-x"}, stdin: "9f", stdout: "000000  9f  # array(*)\n", err: "range error"},
+		{args: []string{"json", "-x"}, stdin: input, stdout: "{\"b\":2,\"a\":1}\n"},
+		{args: []string{"json", "-x", "-nonfinite=string"}, stdin: "f97c00", stdout: "\"Infinity\"\n"},
+		{args: []string{"json", "-x", "-nonfinite=error"}, stdin: "f97c00", err: "non-finite float"},
+		{args: []string{"fromjson", "-out=hex"}, stdin: `{"b": [1, 2.5]}`, stdout: "a161628201f94100\n"},
+		{args: []string{"fromjson"}, stdin: `[1]`, stdout: "\x81\x01"},
+		{args: []string{"validate", "-x"}, stdin: input, stdout: "ok\n"},
+		{args: []string{"validate", "-x"}, stdin: "a2 6162 02", err: "range error at offset 4"},
+		{args: []string{"validate", "-x", "-depth=1"}, stdin: "8181 01", err: "nesting too deep at offset 1"},
+		{args: []string{"validate", "-x", "-items=2"}, stdin: "820102", err: "at offset"},
+		{args: []string{"canon", "-x", "-out=hex"}, stdin: input, stdout: "a26161f93c00616202\n"},
+		{args: []string{"canon", "-x", "-out=base64"}, stdin: "1a00000001", stdout: "AQ==\n"},
+	} {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := commands[tc.args[0]](tc.args[1:], strings.NewReader(tc.stdin), &stdout)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.stdout, stdout.String())
+		})
+	}
+}
+
+func TestFileArgument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.cbor")
+	require.NoError(t, os.WriteFile(path, []byte{0x82, 0x01, 0x02}, 0o644))
+	var stdout bytes.Buffer
+	require.NoError(t, diag([]string{path}, strings.NewReader(""), &stdout))
+	assert.Equal(t, "[1, 2]\n", stdout.String())
+
+	assert.EqualError(t, diag([]string{path, path}, strings.NewReader(""), &stdout), "too many arguments")
+}
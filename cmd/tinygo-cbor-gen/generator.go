@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wasmcloud/tinygo-cbor/internal/fieldtag"
+)
+
+const libraryPath = "github.com/wasmcloud/tinygo-cbor"
+
+// basic types and the Writer/Decoder method suffix used to encode them
+var basicTypes = map[string]struct {
+	method string // WriteX / ReadX suffix
+	wire   string // Go type taken and returned by the method
+}{
+	"bool":    {"Bool", "bool"},
+	"int8":    {"Int8", "int8"},
+	"int16":   {"Int16", "int16"},
+	"int32":   {"Int32", "int32"},
+	"int64":   {"Int64", "int64"},
+	"int":     {"Int64", "int64"},
+	"uint8":   {"Uint8", "uint8"},
+	"byte":    {"Uint8", "uint8"},
+	"uint16":  {"Uint16", "uint16"},
+	"uint32":  {"Uint32", "uint32"},
+	"uint64":  {"Uint64", "uint64"},
+	"uint":    {"Uint64", "uint64"},
+	"float32": {"Float32", "float32"},
+	"float64": {"Float64", "float64"},
+	"string":  {"String", "string"},
+}
+
+type field struct {
+	name      string // Go field name
+	key       string // map key, a decimal integer if intKey is set
+	intKey    bool
+	typ       ast.Expr
+	omitEmpty bool
+}
+
+func (f field) keyString() string {
+	if f.intKey {
+		return f.key
+	}
+	return strconv.Quote(f.key)
+}
+
+type structType struct {
+	name    string
+	fields  []field
+	toArray bool
+}
+
+// intKeys reports whether any field has an integer key, in which case keys
+// are decoded through a cbor.FieldTable.
+func (st structType) intKeys() bool {
+	for _, f := range st.fields {
+		if f.intKey {
+			return true
+		}
+	}
+	return false
+}
+
+// tableName names the FieldTable of the struct, with a prefix that keeps it
+// clear of the identifiers of the package it is generated into.
+func (st structType) tableName() string {
+	return "cborgen" + st.name + "Fields"
+}
+
+type generator struct {
+	fset    *token.FileSet
+	pkgName string
+	types   map[string]*ast.TypeSpec // all types declared in the package
+	toArray bool                     // encode every struct as an array
+	buf     bytes.Buffer
+}
+
+func newGenerator(fset *token.FileSet, files []*ast.File) *generator {
+	g := &generator{
+		fset:  fset,
+		types: map[string]*ast.TypeSpec{},
+	}
+	for _, file := range files {
+		g.pkgName = file.Name.Name
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				g.types[ts.Name.Name] = ts
+			}
+		}
+	}
+	return g
+}
+
+// structNames returns the names of all struct types declared in the package.
+func (g *generator) structNames() []string {
+	var names []string
+	for name, ts := range g.types {
+		if _, ok := ts.Type.(*ast.StructType); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) typeString(expr ast.Expr) string {
+	var b bytes.Buffer
+	_ = printer.Fprint(&b, g.fset, expr)
+	return b.String()
+}
+
+// generate returns the formatted source of Encode and Decode methods for
+// the named struct types.
+func (g *generator) generate(names []string) ([]byte, error) {
+	g.printf("// Code generated by tinygo-cbor-gen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", g.pkgName)
+	g.printf("import cbor %q\n", libraryPath)
+	for _, name := range names {
+		st, err := g.structType(name)
+		if err != nil {
+			return nil, err
+		}
+		if !st.toArray && st.intKeys() {
+			g.genFieldTable(st)
+		}
+		if err := g.genEncode(st); err != nil {
+			return nil, err
+		}
+		if err := g.genDecode(st); err != nil {
+			return nil, err
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+func (g *generator) structType(name string) (structType, error) {
+	ts, ok := g.types[name]
+	if !ok {
+		return structType{}, fmt.Errorf("type %s not found", name)
+	}
+	s, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return structType{}, fmt.Errorf("type %s is not a struct", name)
+	}
+	st := structType{name: name, toArray: g.toArray}
+	for _, f := range s.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return structType{}, err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		ft := fieldtag.Parse(tag.Get("cbor"))
+		names := f.Names
+		if len(names) == 0 {
+			// embedded field, named after its type
+			ident := f.Type
+			if star, ok := ident.(*ast.StarExpr); ok {
+				ident = star.X
+			}
+			if sel, ok := ident.(*ast.SelectorExpr); ok {
+				ident = sel.Sel
+			}
+			id, ok := ident.(*ast.Ident)
+			if !ok {
+				return structType{}, fmt.Errorf("%s: unsupported embedded field", name)
+			}
+			names = []*ast.Ident{id}
+		}
+		for _, n := range names {
+			if n.Name == "_" {
+				if ft.ToArray {
+					st.toArray = true
+				}
+				continue
+			}
+			if ft.Skip() || !ast.IsExported(n.Name) {
+				continue
+			}
+			fieldKey, _, err := ft.Key(n.Name)
+			if err != nil {
+				return structType{}, fmt.Errorf("%s.%s: %v", name, n.Name, err)
+			}
+			st.fields = append(st.fields, field{
+				name:      n.Name,
+				key:       fieldKey,
+				intKey:    ft.KeyAsInt,
+				typ:       f.Type,
+				omitEmpty: ft.OmitEmpty,
+			})
+		}
+	}
+	return st, nil
+}
+
+// resolve follows local named types to their underlying type, stopping at
+// structs, which are encoded through their own methods.
+func (g *generator) resolve(expr ast.Expr) ast.Expr {
+	for {
+		id, ok := expr.(*ast.Ident)
+		if !ok {
+			return expr
+		}
+		ts, ok := g.types[id.Name]
+		if !ok {
+			return expr
+		}
+		if _, isStruct := ts.Type.(*ast.StructType); isStruct {
+			return expr
+		}
+		expr = ts.Type
+	}
+}
+
+// nonEmpty returns a condition that is true when value is not empty.
+func (g *generator) nonEmpty(expr ast.Expr, value string) (string, error) {
+	switch t := g.resolve(expr).(type) {
+	case *ast.Ident:
+		basic, ok := basicTypes[t.Name]
+		if !ok {
+			break
+		}
+		switch basic.wire {
+		case "bool":
+			return value, nil
+		case "string":
+			return value + ` != ""`, nil
+		default:
+			return value + " != 0", nil
+		}
+	case *ast.ArrayType:
+		return "len(" + value + ") != 0", nil
+	case *ast.MapType:
+		return "len(" + value + ") != 0", nil
+	case *ast.StarExpr:
+		return value + " != nil", nil
+	}
+	return "", fmt.Errorf("omitempty is not supported for %s", g.typeString(expr))
+}
+
+// genFieldTable declares the key table used to decode structs with
+// integer keys.
+func (g *generator) genFieldTable(st structType) {
+	g.printf("\nvar %s = cbor.NewFieldTable(\n", st.tableName())
+	for _, f := range st.fields {
+		if f.intKey {
+			g.printf("cbor.IntKey(%s),\n", f.key)
+		} else {
+			g.printf("cbor.TextKey(%q),\n", f.key)
+		}
+	}
+	g.printf(")\n")
+}
+
+func (g *generator) genEncode(st structType) error {
+	g.printf("\n// Encode writes %s to encoder.\n", st.name)
+	g.printf("func (o *%s) Encode(encoder cbor.Writer) error {\n", st.name)
+	g.printf("if o == nil {\nencoder.WriteNil()\nreturn encoder.CheckError()\n}\n")
+	if st.toArray {
+		g.printf("encoder.WriteArraySize(%d)\n", len(st.fields))
+		for _, f := range st.fields {
+			if err := g.encodeValue(f.typ, "o."+f.name, 0); err != nil {
+				return fmt.Errorf("%s.%s: %v", st.name, f.name, err)
+			}
+		}
+		g.printf("return encoder.CheckError()\n}\n")
+		return nil
+	}
+
+	fixed := 0
+	var conditions []string
+	for _, f := range st.fields {
+		if !f.omitEmpty {
+			fixed++
+			continue
+		}
+		cond, err := g.nonEmpty(f.typ, "o."+f.name)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", st.name, f.name, err)
+		}
+		conditions = append(conditions, cond)
+	}
+	if len(conditions) == 0 {
+		g.printf("encoder.WriteMapSize(%d)\n", fixed)
+	} else {
+		g.printf("numFields := uint32(%d)\n", fixed)
+		for _, cond := range conditions {
+			g.printf("if %s {\nnumFields++\n}\n", cond)
+		}
+		g.printf("encoder.WriteMapSize(numFields)\n")
+	}
+	for _, f := range st.fields {
+		if f.omitEmpty {
+			cond, _ := g.nonEmpty(f.typ, "o."+f.name)
+			g.printf("if %s {\n", cond)
+		}
+		if f.intKey {
+			g.printf("encoder.WriteInt64(%s)\n", f.key)
+		} else {
+			g.printf("encoder.WriteString(%q)\n", f.key)
+		}
+		if err := g.encodeValue(f.typ, "o."+f.name, 0); err != nil {
+			return fmt.Errorf("%s.%s: %v", st.name, f.name, err)
+		}
+		if f.omitEmpty {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return encoder.CheckError()\n}\n")
+	return nil
+}
+
+// encodeValue emits code writing value, an addressable expression of type
+// expr. depth disambiguates loop variables of nested containers.
+func (g *generator) encodeValue(expr ast.Expr, value string, depth int) error {
+	switch t := g.resolve(expr).(type) {
+	case *ast.Ident:
+		if basic, ok := basicTypes[t.Name]; ok {
+			if t == expr && t.Name == basic.wire {
+				g.printf("encoder.Write%s(%s)\n", basic.method, value)
+			} else {
+				g.printf("encoder.Write%s(%s(%s))\n", basic.method, basic.wire, value)
+			}
+			return nil
+		}
+		if _, ok := g.types[t.Name]; ok {
+			g.printf("if err := %s.Encode(encoder); err != nil {\nreturn err\n}\n", receiver(value))
+			return nil
+		}
+		return fmt.Errorf("unsupported type %s", t.Name)
+	case *ast.SelectorExpr:
+		// types from other packages must implement cbor.Codec
+		g.printf("if err := %s.Encode(encoder); err != nil {\nreturn err\n}\n", receiver(value))
+		return nil
+	case *ast.StarExpr:
+		g.printf("if %s == nil {\nencoder.WriteNil()\n} else {\n", value)
+		if err := g.encodeValue(t.X, "*"+value, depth); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+	case *ast.ArrayType:
+		if isByte(g.resolve(t.Elt)) {
+			if t.Len == nil {
+				g.printf("if %s == nil {\nencoder.WriteNil()\n} else {\nencoder.WriteByteArray(%s)\n}\n", value, value)
+			} else {
+				g.printf("encoder.WriteByteArray(%s[:])\n", paren(value))
+			}
+			return nil
+		}
+		item := "i" + strconv.Itoa(depth)
+		if t.Len == nil {
+			g.printf("if %s == nil {\nencoder.WriteNil()\n} else {\n", value)
+		}
+		g.printf("encoder.WriteArraySize(uint32(len(%s)))\n", value)
+		g.printf("for %s := range %s {\n", item, value)
+		if err := g.encodeValue(t.Elt, paren(value)+"["+item+"]", depth+1); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		if t.Len == nil {
+			g.printf("}\n")
+		}
+		return nil
+	case *ast.MapType:
+		k, v := "k"+strconv.Itoa(depth), "v"+strconv.Itoa(depth)
+		g.printf("if %s == nil {\nencoder.WriteNil()\n} else {\n", value)
+		g.printf("encoder.WriteMapSize(uint32(len(%s)))\n", value)
+		g.printf("for %s, %s := range %s {\n", k, v, value)
+		if err := g.encodeValue(t.Key, k, depth+1); err != nil {
+			return err
+		}
+		if err := g.encodeValue(t.Value, v, depth+1); err != nil {
+			return err
+		}
+		g.printf("}\n}\n")
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", g.typeString(expr))
+}
+
+// paren wraps a dereference so that it can be indexed.
+func paren(value string) string {
+	if strings.HasPrefix(value, "*") {
+		return "(" + value + ")"
+	}
+	return value
+}
+
+// receiver returns the expression to call pointer methods on value.
+func receiver(value string) string {
+	if strings.HasPrefix(value, "*") {
+		return value[1:]
+	}
+	return value
+}
+
+func isByte(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && (id.Name == "byte" || id.Name == "uint8")
+}
+
+func (g *generator) genDecode(st structType) error {
+	g.printf("\n// Decode reads %s from decoder.\n", st.name)
+	g.printf("func (o *%s) Decode(decoder *cbor.Decoder) error {\n", st.name)
+	if st.toArray {
+		// missing trailing fields are left unset and extra ones skipped
+		g.printf("fields, err := decoder.ReadArrayFields()\n")
+		g.printf("if err != nil {\nreturn err\n}\n")
+		for _, f := range st.fields {
+			g.printf("if ok, err := fields.Next(); err != nil {\nreturn err\n} else if ok {\n")
+			if err := g.decodeValue(f.typ, "o."+f.name, 0); err != nil {
+				return fmt.Errorf("%s.%s: %v", st.name, f.name, err)
+			}
+			g.printf("}\n")
+		}
+		g.printf("return fields.Finish()\n}\n")
+		return nil
+	}
+
+	g.printf("numFields, indef, err := decoder.ReadMapSize()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("if indef {\nreturn cbor.NewReadError(\"%s: indefinite length maps not supported\")\n}\n", st.name)
+	g.printf("for ; numFields > 0; numFields-- {\n")
+	if st.intKeys() {
+		g.printf("field, err := %s.ReadKey(decoder)\n", st.tableName())
+	} else {
+		g.printf("field, err := decoder.ReadString()\n")
+	}
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("switch field {\n")
+	for i, f := range st.fields {
+		if st.intKeys() {
+			g.printf("case %d: // %s\n", i, f.keyString())
+		} else {
+			g.printf("case %q:\n", f.key)
+		}
+		if err := g.decodeValue(f.typ, "o."+f.name, 0); err != nil {
+			return fmt.Errorf("%s.%s: %v", st.name, f.name, err)
+		}
+	}
+	g.printf("default:\nif err := decoder.Skip(); err != nil {\nreturn err\n}\n")
+	g.printf("}\n}\nreturn nil\n}\n")
+	return nil
+}
+
+// decodeValue emits code reading into target, an addressable expression of
+// type expr.
+func (g *generator) decodeValue(expr ast.Expr, target string, depth int) error {
+	switch t := g.resolve(expr).(type) {
+	case *ast.Ident:
+		if basic, ok := basicTypes[t.Name]; ok {
+			if t == expr && t.Name == basic.wire {
+				g.printf("if %s, err = decoder.Read%s(); err != nil {\nreturn err\n}\n", target, basic.method)
+			} else if t.Name == "int" || t.Name == "uint" {
+				// 32 bits wide on some targets, such as wasm with TinyGo
+				g.printf("if v, err := decoder.Read%s(); err != nil {\nreturn err\n} else if %s(%s(v)) != v {\nreturn cbor.ErrRange\n} else {\n%s = %s(v)\n}\n",
+					basic.method, basic.wire, t.Name, target, g.typeString(expr))
+			} else {
+				g.printf("if v, err := decoder.Read%s(); err != nil {\nreturn err\n} else {\n%s = %s(v)\n}\n",
+					basic.method, target, g.typeString(expr))
+			}
+			return nil
+		}
+		if _, ok := g.types[t.Name]; ok {
+			g.printf("if err := %s.Decode(decoder); err != nil {\nreturn err\n}\n", receiver(target))
+			return nil
+		}
+		return fmt.Errorf("unsupported type %s", t.Name)
+	case *ast.SelectorExpr:
+		g.printf("if err := %s.Decode(decoder); err != nil {\nreturn err\n}\n", receiver(target))
+		return nil
+	case *ast.StarExpr:
+		g.printf("if isNil, err := decoder.IsNextNil(); err != nil {\nreturn err\n} else if isNil {\n%s = nil\n} else {\n", target)
+		g.printf("%s = new(%s)\n", target, g.typeString(t.X))
+		if err := g.decodeValue(t.X, "*"+target, depth); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+	case *ast.ArrayType:
+		if isByte(g.resolve(t.Elt)) {
+			if t.Len == nil {
+				g.printf("if isNil, err := decoder.IsNextNil(); err != nil {\nreturn err\n} else if isNil {\n%s = nil\n} else {\n", target)
+				if typ := g.typeString(expr); typ == "[]byte" {
+					g.printf("if %s, err = decoder.ReadByteArrayCopy(); err != nil {\nreturn err\n}\n}\n", target)
+				} else {
+					g.printf("v, err := decoder.ReadByteArrayCopy()\nif err != nil {\nreturn err\n}\n")
+					g.printf("%s = %s(v)\n}\n", target, typ)
+				}
+			} else {
+				g.printf("if v, err := decoder.ReadByteArray(); err != nil {\nreturn err\n} else if len(v) != len(%s) {\n", target)
+				g.printf("return cbor.NewReadError(\"byte array length mismatch\")\n} else {\ncopy(%s[:], v)\n}\n", paren(target))
+			}
+			return nil
+		}
+		item := "i" + strconv.Itoa(depth)
+		if t.Len == nil {
+			g.printf("if isNil, err := decoder.IsNextNil(); err != nil {\nreturn err\n} else if isNil {\n%s = nil\n} else {\n", target)
+		} else {
+			g.printf("{\n")
+		}
+		g.printf("size, indef, err := decoder.ReadArraySize()\n")
+		g.printf("if err != nil {\nreturn err\n}\n")
+		g.printf("if indef {\nreturn cbor.NewReadError(\"indefinite length arrays not supported\")\n}\n")
+		if t.Len == nil {
+			g.printf("%s = make(%s, size)\n", target, g.typeString(expr))
+		} else {
+			g.printf("if int(size) != len(%s) {\nreturn cbor.NewReadError(\"array length mismatch\")\n}\n", target)
+		}
+		g.printf("for %s := range %s {\n", item, target)
+		if err := g.decodeValue(t.Elt, paren(target)+"["+item+"]", depth+1); err != nil {
+			return err
+		}
+		g.printf("}\n}\n")
+		return nil
+	case *ast.MapType:
+		item, k, v := "i"+strconv.Itoa(depth), "k"+strconv.Itoa(depth), "v"+strconv.Itoa(depth)
+		g.printf("if isNil, err := decoder.IsNextNil(); err != nil {\nreturn err\n} else if isNil {\n%s = nil\n} else {\n", target)
+		g.printf("size, indef, err := decoder.ReadMapSize()\n")
+		g.printf("if err != nil {\nreturn err\n}\n")
+		g.printf("if indef {\nreturn cbor.NewReadError(\"indefinite length maps not supported\")\n}\n")
+		g.printf("%s = make(%s, size)\n", target, g.typeString(expr))
+		g.printf("for %s := uint32(0); %s < size; %s++ {\n", item, item, item)
+		g.printf("var %s %s\n", k, g.typeString(t.Key))
+		if err := g.decodeValue(t.Key, k, depth+1); err != nil {
+			return err
+		}
+		g.printf("var %s %s\n", v, g.typeString(t.Value))
+		if err := g.decodeValue(t.Value, v, depth+1); err != nil {
+			return err
+		}
+		g.printf("%s[%s] = %s\n}\n}\n", paren(target), k, v)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", g.typeString(expr))
+}
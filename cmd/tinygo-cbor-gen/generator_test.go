@@ -0,0 +1,41 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The generated code checked in under internal/gentest must be up to date.
+func TestGeneratedCodeIsCurrent(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	output := "types_cbor.go"
+	fset := token.NewFileSet()
+	files, err := parseDir(fset, dir, output)
+	require.NoError(t, err)
+	src, err := newGenerator(fset, files).generate([]string{"Everything", "Nested", "Point", "Compact"})
+	require.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join(dir, output))
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(src), "run go generate ./internal/gentest")
+}
+
+func TestBadKeyAsInt(t *testing.T) {
+	dir := t.TempDir()
+	src := "package p\n\ntype T struct {\n\tF string `cbor:\"f,keyasint\"`\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "t.go"), []byte(src), 0644))
+	err := run(dir, "T", "", false)
+	assert.EqualError(t, err, "T.F: keyasint requires an integer key, not \"f\"")
+}
+
+func TestUnsupportedType(t *testing.T) {
+	dir := t.TempDir()
+	src := "package p\n\ntype T struct {\n\tF func()\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "t.go"), []byte(src), 0644))
+	err := run(dir, "T", "", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+// Command tinygo-cbor-gen generates cbor.Codec implementations for Go
+// struct types.
+//
+// It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/wasmcloud/tinygo-cbor/cmd/tinygo-cbor-gen -type=Person,Address
+//
+// For each type an Encode(cbor.Writer) error and a Decode(*cbor.Decoder)
+// error method is written to <file>_cbor.go, next to the file holding the
+// go:generate directive.
+//
+// Structs are encoded as maps keyed by field name. The key defaults to the
+// field name with its leading upper-case run lowered ("BoolValue" becomes
+// "boolValue") and can be changed with a struct tag:
+//
+//	Name  string `cbor:"name"`            // key "name"
+//	Notes string `cbor:"notes,omitempty"` // left out when empty
+//	Cache []byte `cbor:"-"`               // never encoded
+//
+// The keyasint option makes the key an integer, which is much more compact:
+//
+//	Name string `cbor:"1,keyasint"` // key 1
+//
+// A blank field tagged `cbor:",toarray"`, or the -array flag, encodes the
+// struct as an array of its fields in declaration order instead. Such
+// arrays may be shorter or longer than the struct, so that fields can be
+// appended in later versions of a type. Pointers,
+// slices and maps are nullable. Unknown map keys are skipped on decode.
+// Types from other packages must implement cbor.Codec.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct types; all structs in the package if empty")
+	output := flag.String("output", "", "output file; defaults to <file>_cbor.go, where <file> is $GOFILE or the package name")
+	toArray := flag.Bool("array", false, "encode every struct as an array of its fields")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: tinygo-cbor-gen [flags] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	if err := run(dir, *typeNames, *output, *toArray); err != nil {
+		fmt.Fprintf(os.Stderr, "tinygo-cbor-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, typeNames string, output string, toArray bool) error {
+	fset := token.NewFileSet()
+	files, err := parseDir(fset, dir, output)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+	g := newGenerator(fset, files)
+	g.toArray = toArray
+
+	names := g.structNames()
+	if typeNames != "" {
+		names = strings.Split(typeNames, ",")
+	}
+	src, err := g.generate(names)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		base := os.Getenv("GOFILE")
+		if base == "" {
+			base = g.pkgName
+		}
+		output = strings.TrimSuffix(base, ".go") + "_cbor.go"
+	}
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(dir, output)
+	}
+	return os.WriteFile(output, src, 0644)
+}
+
+// parseDir parses the non-test Go files of a package, leaving out
+// previously generated output.
+func parseDir(fset *token.FileSet, dir string, output string) ([]*ast.File, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, path := range matches {
+		base := filepath.Base(path)
+		if strings.HasSuffix(base, "_test.go") || base == filepath.Base(output) {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if isGenerated(file) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func isGenerated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") && strings.HasSuffix(c.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
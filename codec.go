@@ -1,22 +1,73 @@
 package cbor
 
+// Encodable is the interface that applies to data structures that can
+// encode to the CBOR format.
+type Encodable interface {
+	Encode(encoder Writer) error
+}
+
+// Decodable is the interface that applies to data structures that can
+// decode from the CBOR format.
+type Decodable interface {
+	Decode(decoder *Decoder) error
+}
+
 // Codec is the interface that applies to data structures that can
-// encode to and decode from the MessagPack format.
+// encode to and decode from the CBOR format.
 type Codec interface {
-	Decode(decoder *Decoder) error
-	Encode(encoder Writer) error
+	Decodable
+	Encodable
+}
+
+// ToBytes creates a `[]byte` from `value`.
+func ToBytes(value Encodable) ([]byte, error) {
+	return AppendBytes(nil, value)
 }
 
-// ToBytes creates a `[]byte` from `codec`.
-func ToBytes(codec Codec) ([]byte, error) {
+// AppendBytes appends the encoding of `value` to `dst` and returns the
+// extended buffer. On error, `dst` is returned unchanged.
+func AppendBytes(dst []byte, value Encodable) ([]byte, error) {
 	var sizer Sizer
-	if err := codec.Encode(&sizer); err != nil {
-		return nil, err
+	if err := value.Encode(&sizer); err != nil {
+		return dst, err
 	}
-	buffer := make([]byte, sizer.Len())
-	encoder := NewEncoder(buffer)
-	if err := codec.Encode(&encoder); err != nil {
-		return nil, err
+	if err := sizer.CheckError(); err != nil {
+		return dst, err
 	}
-	return buffer, nil
+	start := len(dst)
+	out := dst
+	if n := start + int(sizer.Len()); n <= cap(dst) {
+		out = dst[:n]
+	} else {
+		out = make([]byte, n)
+		copy(out, dst)
+	}
+	encoder := NewEncoder(out[start:])
+	if err := value.Encode(&encoder); err != nil {
+		return dst, err
+	}
+	if err := encoder.CheckError(); err != nil {
+		return dst, err
+	}
+	return out[:start+int(encoder.reader.byteOffset)], nil
+}
+
+// FromBytes decodes `value` from `data`, which must hold exactly one item:
+// ErrTrailingData is returned if any bytes remain after it, so that
+// concatenated garbage is rejected.
+func FromBytes(data []byte, value Decodable) error {
+	decoder := NewDecoder(data)
+	if err := value.Decode(&decoder); err != nil {
+		return err
+	}
+	if !decoder.Done() {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+// FromBytesStrict is FromBytes under the name that spells out its
+// rejection of trailing data.
+func FromBytesStrict(data []byte, value Decodable) error {
+	return FromBytes(data, value)
 }
@@ -0,0 +1,180 @@
+package cbor
+
+// WriteSetSize writes the head of a set (tag 258) of length elements. The
+// elements follow as the items of an array.
+func WriteSetSize(w Writer, length uint32) {
+	w.WriteTag(TagSet)
+	w.WriteArraySize(length)
+}
+
+// ReadSetSize reads the head of a set (tag 258) and returns its number of
+// elements.
+func (d *Decoder) ReadSetSize() (uint32, error) {
+	tag, err := d.ReadTag()
+	if err != nil {
+		return 0, err
+	}
+	if tag != TagSet {
+		return 0, ReadError{"expected set (tag 258)"}
+	}
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return 0, err
+	}
+	if indef {
+		return 0, ReadError{"indefinite length sets not supported"}
+	}
+	return size, nil
+}
+
+// ReadSet reads a set (tag 258), calling fn once per element with the
+// Decoder positioned on it. fn must consume exactly one item. If unique is
+// true, elements are compared by their encoded bytes and a duplicate
+// results in an error.
+func (d *Decoder) ReadSet(unique bool, fn func(d *Decoder) error) error {
+	size, err := d.ReadSetSize()
+	if err != nil {
+		return err
+	}
+	var seen map[string]struct{}
+	if unique {
+		seen = make(map[string]struct{}, size)
+	}
+	for ; size > 0; size-- {
+		start := d.reader.byteOffset
+		if err := fn(d); err != nil {
+			return err
+		}
+		if unique {
+			key := string(d.reader.buffer[start:d.reader.byteOffset])
+			if _, ok := seen[key]; ok {
+				return ReadError{"duplicate set element"}
+			}
+			seen[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// dimensions product, or false on overflow
+func elementCount(dims []uint32) (uint32, bool) {
+	count := uint64(1)
+	for _, dim := range dims {
+		count *= uint64(dim)
+		if count > 0xffffffff {
+			return 0, false
+		}
+	}
+	return uint32(count), true
+}
+
+func writeMultiDimHead(w Writer, dims []uint32, columnMajor bool) {
+	if columnMajor {
+		w.WriteTag(TagMultiDimColumnMajor)
+	} else {
+		w.WriteTag(TagMultiDimRowMajor)
+	}
+	w.WriteArraySize(2)
+	w.WriteArraySize(uint32(len(dims)))
+	for _, dim := range dims {
+		w.WriteUint32(dim)
+	}
+}
+
+// WriteMultiDimArraySize writes the head of a multi-dimensional array (tag
+// 40, or tag 1040 if columnMajor is set) with the given dimensions. The
+// product of the dimensions elements must follow, as the items of an array.
+// It writes nothing and returns ErrRange if the product does not fit an
+// array length.
+func WriteMultiDimArraySize(w Writer, dims []uint32, columnMajor bool) error {
+	count, ok := elementCount(dims)
+	if !ok {
+		return ErrRange
+	}
+	writeMultiDimHead(w, dims, columnMajor)
+	w.WriteArraySize(count)
+	return nil
+}
+
+// WriteMultiDimTypedArray writes a multi-dimensional array (tag 40, or tag
+// 1040 if columnMajor is set) whose elements are held in a typed array.
+// It writes nothing and returns ErrRange if the typed array does not hold
+// exactly the product of the dimensions elements.
+func WriteMultiDimTypedArray(w Writer, dims []uint32, columnMajor bool, value TypedArray) error {
+	count, ok := elementCount(dims)
+	if !ok || uint64(len(value.Data)) != uint64(count)*uint64(value.ElemSize()) {
+		return ErrRange
+	}
+	writeMultiDimHead(w, dims, columnMajor)
+	w.WriteTypedArray(value)
+	return nil
+}
+
+func (d *Decoder) readMultiDimHead() ([]uint32, bool, error) {
+	tag, err := d.ReadTag()
+	if err != nil {
+		return nil, false, err
+	}
+	if tag != TagMultiDimRowMajor && tag != TagMultiDimColumnMajor {
+		return nil, false, ReadError{"expected multi-dimensional array (tag 40 or 1040)"}
+	}
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return nil, false, err
+	}
+	if indef || size != 2 {
+		return nil, false, ReadError{"multi-dimensional array must be an array of two elements"}
+	}
+	numDims, indef, err := d.ReadArraySize()
+	if err != nil {
+		return nil, false, err
+	}
+	if indef || numDims == 0 {
+		return nil, false, ReadError{"bad multi-dimensional array dimensions"}
+	}
+	dims := make([]uint32, numDims)
+	for i := range dims {
+		if dims[i], err = d.ReadUint32(); err != nil {
+			return nil, false, err
+		}
+	}
+	return dims, tag == TagMultiDimColumnMajor, nil
+}
+
+// ReadMultiDimArraySize reads the head of a multi-dimensional array (tag 40
+// or 1040) whose elements are held in a plain array. It returns the
+// dimensions and whether the elements are in column-major order, leaving
+// the Decoder positioned on the first element. The number of elements is
+// checked against the dimensions.
+func (d *Decoder) ReadMultiDimArraySize() ([]uint32, bool, error) {
+	dims, columnMajor, err := d.readMultiDimHead()
+	if err != nil {
+		return nil, false, err
+	}
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return nil, false, err
+	}
+	if count, ok := elementCount(dims); indef || !ok || count != size {
+		return nil, false, ReadError{"multi-dimensional array dimensions do not match element count"}
+	}
+	return dims, columnMajor, nil
+}
+
+// ReadMultiDimTypedArray reads a multi-dimensional array (tag 40 or 1040)
+// whose elements are held in a typed array. The number of elements is
+// checked against the dimensions.
+func (d *Decoder) ReadMultiDimTypedArray() ([]uint32, bool, TypedArray, error) {
+	dims, columnMajor, err := d.readMultiDimHead()
+	if err != nil {
+		return nil, false, TypedArray{}, err
+	}
+	value, err := d.ReadTypedArray()
+	if err != nil {
+		return nil, false, TypedArray{}, err
+	}
+	if count, ok := elementCount(dims); !ok || uint64(count) != uint64(value.Len()) {
+		return nil, false, TypedArray{}, ReadError{"multi-dimensional array dimensions do not match element count"}
+	}
+	return dims, columnMajor, value, nil
+}
@@ -0,0 +1,222 @@
+package cose_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbor "github.com/wasmcloud/tinygo-cbor"
+	"github.com/wasmcloud/tinygo-cbor/cose"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// RFC 9052 Appendix C.2.1
+func TestSign1Example(t *testing.T) {
+	data := decodeHex(t, "d28443a10126a10442313154546869732069732074686520636f6e74656e742e"+
+		"58408eb33e4ca31d1c465ab05aac34cc6b23d58fef5c083106c4d25a91aef0b0117e"+
+		"2af9a291aa32e14ab834dc56ed2a223444547e01f11d3b0916e5a4c345cacb36")
+	x, _ := new(big.Int).SetString("bac5b11cad8f99f9c72b05cf4b9e26d244dc189f745228255a219a86d6a09eff", 16)
+	y, _ := new(big.Int).SetString("20138bf82dc1b6d562be0fa54ab7804a3a64b6d72ccfed6b6fb6ed28bbfc117e", 16)
+	verifier, err := cose.NewES256Verifier(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	require.NoError(t, err)
+
+	var msg cose.Sign1
+	require.NoError(t, cbor.FromBytes(data, &msg))
+	assert.Equal(t, int64(cose.AlgorithmES256), msg.Protected.Algorithm)
+	assert.Equal(t, []byte("11"), msg.Unprotected.KeyID)
+	assert.Equal(t, []byte("This is the content."), msg.Payload)
+	require.NoError(t, msg.Verify(verifier, nil))
+
+	encoded, err := cbor.ToBytes(&msg)
+	require.NoError(t, err)
+	assert.Equal(t, data, encoded)
+
+	msg.Payload[0] ^= 1
+	assert.ErrorIs(t, msg.Verify(verifier, nil), cose.ErrSignature)
+}
+
+func TestSign1Ed25519(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	msg := cose.Sign1{
+		Protected:   cose.Headers{ContentType: "application/cbor"},
+		Unprotected: cose.Headers{KeyID: []byte("actor")},
+		Payload:     []byte{0xa1, 0x01, 0x02},
+	}
+	require.NoError(t, msg.Sign(cose.NewEd25519Signer(private), []byte("aad")))
+	data, err := cbor.ToBytes(&msg)
+	require.NoError(t, err)
+
+	var decoded cose.Sign1
+	require.NoError(t, cbor.FromBytes(data, &decoded))
+	assert.Equal(t, msg.Protected, decoded.Protected)
+	assert.Equal(t, msg.Unprotected, decoded.Unprotected)
+	verifier := cose.NewEd25519Verifier(public)
+	require.NoError(t, decoded.Verify(verifier, []byte("aad")))
+	assert.ErrorIs(t, decoded.Verify(verifier, nil), cose.ErrSignature)
+
+	es256, err := cose.NewES256Verifier(&ecdsa.PublicKey{Curve: elliptic.P256()})
+	require.NoError(t, err)
+	assert.ErrorIs(t, decoded.Verify(es256, []byte("aad")), cose.ErrAlgorithmMismatch)
+}
+
+func TestSign1ES256Detached(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewES256Signer(key, rand.Reader)
+	require.NoError(t, err)
+	verifier, err := cose.NewES256Verifier(&key.PublicKey)
+	require.NoError(t, err)
+
+	payload := []byte("detached")
+	var msg cose.Sign1
+	require.NoError(t, msg.Sign(signer, nil, payload))
+	assert.Len(t, msg.Signature, 64)
+	data, err := cbor.ToBytes(&msg)
+	require.NoError(t, err)
+
+	var decoded cose.Sign1
+	require.NoError(t, cbor.FromBytes(data, &decoded))
+	assert.Nil(t, decoded.Payload)
+	require.NoError(t, decoded.Verify(verifier, nil, payload))
+	assert.Error(t, decoded.Verify(verifier, nil, []byte("other")))
+
+	_, err = cose.NewES256Signer(&ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P384()}}, rand.Reader)
+	assert.ErrorIs(t, err, cose.ErrAlgorithmMismatch)
+}
+
+func TestHeaderChecks(t *testing.T) {
+	var msg cose.Sign1
+
+	// algorithm in both protected and unprotected headers
+	data := decodeHex(t, "d28443a10126a10126f640")
+	assert.ErrorIs(t, cbor.FromBytes(data, &msg), cose.ErrDuplicateHeader)
+
+	// critical parameter 4 (kid) is not protected
+	data = decodeHex(t, "d28446a20126028104a1044231314040")
+	assert.ErrorIs(t, cbor.FromBytes(data, &msg), cose.ErrCritical)
+
+	// critical unknown parameter 99
+	data = decodeHex(t, "d2844aa3012602811863186300a04040")
+	assert.ErrorIs(t, cbor.FromBytes(data, &msg), cose.ErrCritical)
+
+	// critical algorithm; unknown parameter 24 is skipped
+	data = decodeHex(t, "d28449a30126028101181800a0f640")
+	require.NoError(t, cbor.FromBytes(data, &msg))
+	assert.Equal(t, []int64{1}, msg.Protected.Critical)
+
+	data = decodeHex(t, "8340a0f6")
+	assert.Error(t, cbor.FromBytes(data, &msg))
+
+	// unknown parameter 99 holds indefinite length items:
+	// {1: -7, 99: [[_ 1], (_ "x")], 4: h'31'}
+	var h cose.Headers
+	data = decodeHex(t, "a301261863829f01ff7f6178ff044131")
+	require.NoError(t, cbor.FromBytes(data, &h))
+	assert.Equal(t, cose.Headers{Algorithm: cose.AlgorithmES256, KeyID: []byte("1")}, h)
+}
+
+// RFC 9052 Appendix C.6.1
+func TestMac0Example(t *testing.T) {
+	data := decodeHex(t, "d18443a10105a054546869732069732074686520636f6e74656e742e"+
+		"5820a1a848d3471f9d61ee49018d244c824772f223ad4f935293f1789fc3a08d8c58")
+	key := decodeHex(t, "849b57219dae48de646d07dbb533566e976686457c1491be3a76dcea6c427188")
+
+	var msg cose.Mac0
+	require.NoError(t, cbor.FromBytes(data, &msg))
+	require.NoError(t, msg.Verify(key, nil))
+	assert.ErrorIs(t, msg.Verify(key, []byte("aad")), cose.ErrMAC)
+
+	again := cose.Mac0{Payload: msg.Payload}
+	require.NoError(t, again.Authenticate(key, nil))
+	encoded, err := cbor.ToBytes(&again)
+	require.NoError(t, err)
+	assert.Equal(t, data, encoded)
+}
+
+func TestMac0Detached(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	msg := cose.Mac0{Unprotected: cose.Headers{KeyID: []byte("k")}}
+	require.NoError(t, msg.Authenticate(key, nil, []byte("payload")))
+	data, err := cbor.ToBytes(&msg)
+	require.NoError(t, err)
+
+	var decoded cose.Mac0
+	require.NoError(t, cbor.FromBytes(data, &decoded))
+	require.NoError(t, decoded.Verify(key, nil, []byte("payload")))
+	assert.ErrorIs(t, decoded.Verify(key, nil, []byte("other")), cose.ErrMAC)
+	assert.ErrorIs(t, decoded.Verify([]byte("wrong"), nil, []byte("payload")), cose.ErrMAC)
+}
+
+func TestEncrypt0(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		key := make([]byte, size)
+		_, err := rand.Read(key)
+		require.NoError(t, err)
+		c, err := cose.NewAESGCM(key)
+		require.NoError(t, err)
+
+		msg := cose.Encrypt0{Protected: cose.Headers{ContentType: "text/plain"}}
+		require.NoError(t, msg.Encrypt(c, []byte("secret"), []byte("aad"), rand.Reader))
+		assert.Len(t, msg.Unprotected.IV, 12)
+		data, err := cbor.ToBytes(&msg)
+		require.NoError(t, err)
+		assert.Equal(t, uint8(0xd0), data[0])
+
+		var decoded cose.Encrypt0
+		require.NoError(t, cbor.FromBytes(data, &decoded))
+		assert.Equal(t, c.Algorithm(), decoded.Protected.Algorithm)
+		plaintext, err := decoded.Decrypt(c, []byte("aad"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("secret"), plaintext)
+
+		_, err = decoded.Decrypt(c, nil)
+		assert.ErrorIs(t, err, cose.ErrDecrypt)
+		decoded.Ciphertext[0] ^= 1
+		_, err = decoded.Decrypt(c, []byte("aad"))
+		assert.ErrorIs(t, err, cose.ErrDecrypt)
+	}
+
+	short, err := cose.NewAESGCM(make([]byte, 16))
+	require.NoError(t, err)
+	long, err := cose.NewAESGCM(make([]byte, 32))
+	require.NoError(t, err)
+	var msg cose.Encrypt0
+	require.NoError(t, msg.Encrypt(short, []byte("x"), nil, rand.Reader))
+	_, err = msg.Decrypt(long, nil)
+	assert.ErrorIs(t, err, cose.ErrAlgorithmMismatch)
+
+	_, err = cose.NewAESGCM(make([]byte, 10))
+	assert.ErrorIs(t, err, cose.ErrAlgorithmMismatch)
+
+	// every call draws a fresh IV, replacing the previous one
+	first := append([]byte{}, msg.Unprotected.IV...)
+	require.NoError(t, msg.Encrypt(short, []byte("x"), nil, rand.Reader))
+	assert.NotEqual(t, first, msg.Unprotected.IV)
+	msg.Protected.IV = first
+	require.NoError(t, msg.Encrypt(short, []byte("x"), nil, rand.Reader))
+	assert.Nil(t, msg.Protected.IV)
+	assert.ErrorIs(t, msg.Encrypt(short, []byte("x"), nil, nil), cose.ErrNoRandom)
+
+	// an explicit IV
+	iv := bytes.Repeat([]byte{7}, 12)
+	require.NoError(t, msg.EncryptWithIV(short, iv, []byte("x"), nil))
+	assert.Equal(t, iv, msg.Unprotected.IV)
+	plaintext, err := msg.Decrypt(short, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("x"), plaintext)
+	assert.Error(t, msg.EncryptWithIV(short, iv[:8], []byte("x"), nil))
+}
@@ -0,0 +1,192 @@
+package cose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"strconv"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+// TagEncrypt0 is the CBOR tag of a COSE_Encrypt0 message.
+const TagEncrypt0 = 16
+
+// context string of the Enc_structure of COSE_Encrypt0
+const contextEncrypt0 = "Encrypt0"
+
+var (
+	// ErrDecrypt is returned when a ciphertext fails authentication.
+	ErrDecrypt = errors.New("cose: decryption failed")
+	// ErrNoRandom is returned by Encrypt when it has no source of
+	// randomness to draw the IV from.
+	ErrNoRandom = errors.New("cose: no source of randomness for the IV")
+)
+
+// Cipher is a content encryption key for an AEAD algorithm.
+//
+// Only AES-GCM is provided: ChaCha20/Poly1305 (algorithm 24) is not in the
+// standard library.
+type Cipher struct {
+	algorithm int64
+	aead      cipher.AEAD
+}
+
+// NewAESGCM returns a Cipher for AES-GCM with a 128, 192 or 256-bit key.
+func NewAESGCM(key []byte) (*Cipher, error) {
+	var algorithm int64
+	switch len(key) {
+	case 16:
+		algorithm = AlgorithmA128GCM
+	case 24:
+		algorithm = AlgorithmA192GCM
+	case 32:
+		algorithm = AlgorithmA256GCM
+	default:
+		return nil, ErrAlgorithmMismatch
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{algorithm: algorithm, aead: aead}, nil
+}
+
+// Algorithm returns the COSE algorithm identifier of the cipher.
+func (c *Cipher) Algorithm() int64 {
+	return c.algorithm
+}
+
+// Encrypt0 is a COSE_Encrypt0 message (RFC 9052 §5.2): content encrypted
+// with a key the recipient already has.
+type Encrypt0 struct {
+	Protected   Headers
+	Unprotected Headers
+	// Ciphertext is the encrypted content, including the authentication
+	// tag. It is nil for detached content.
+	Ciphertext []byte
+
+	// serialized protected headers, as authenticated
+	protected []byte
+}
+
+// Encrypt encrypts plaintext into the message under a fresh random IV
+// drawn from rand, which is stored in the unprotected headers. It sets the
+// algorithm of the protected headers to that of c and replaces any IV
+// already in the headers. external is additional data that is
+// authenticated but not transmitted; it may be nil.
+func (m *Encrypt0) Encrypt(c *Cipher, plaintext, external []byte, rand io.Reader) error {
+	if rand == nil {
+		return ErrNoRandom
+	}
+	iv := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return err
+	}
+	return m.EncryptWithIV(c, iv, plaintext, external)
+}
+
+// EncryptWithIV is Encrypt with an IV chosen by the caller, such as one
+// derived from a message counter. An IV must never be used twice with the
+// same key: doing so with AES-GCM reveals the plaintexts and allows
+// forgeries. Prefer Encrypt unless the IVs are managed elsewhere.
+func (m *Encrypt0) EncryptWithIV(c *Cipher, iv, plaintext, external []byte) error {
+	if len(iv) != c.aead.NonceSize() {
+		return errors.New("cose: IV must be " + strconv.Itoa(c.aead.NonceSize()) + " bytes")
+	}
+	m.Protected.Algorithm = c.algorithm
+	m.Protected.IV = nil
+	m.Unprotected.IV = append([]byte{}, iv...)
+	protected, err := encodeProtected(&m.Protected)
+	if err != nil {
+		return err
+	}
+	m.protected = protected
+	aad, err := m.encStructure(external)
+	if err != nil {
+		return err
+	}
+	m.Ciphertext = c.aead.Seal(nil, iv, plaintext, aad)
+	return nil
+}
+
+// Decrypt authenticates and decrypts the message. The protected headers
+// must name the algorithm of c.
+func (m *Encrypt0) Decrypt(c *Cipher, external []byte) ([]byte, error) {
+	if m.Protected.Algorithm != c.algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	iv, err := m.iv(c)
+	if err != nil {
+		return nil, err
+	}
+	aad, err := m.encStructure(external)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := c.aead.Open(nil, iv, m.Ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// iv returns the full IV of the message. Partial IVs are not supported.
+func (m *Encrypt0) iv(c *Cipher) ([]byte, error) {
+	iv := m.Protected.IV
+	if iv == nil {
+		iv = m.Unprotected.IV
+	}
+	if len(iv) != c.aead.NonceSize() {
+		return nil, cbor.NewReadError("cose: missing or invalid IV")
+	}
+	return iv, nil
+}
+
+// encStructure encodes the Enc_structure of RFC 9052 §5.3.
+func (m *Encrypt0) encStructure(external []byte) ([]byte, error) {
+	if external == nil {
+		external = []byte{}
+	}
+	if m.protected == nil {
+		m.protected = []byte{}
+	}
+	return encodeDeterministic(func(w cbor.Writer) error {
+		w.WriteArraySize(3)
+		w.WriteString(contextEncrypt0)
+		w.WriteByteArray(m.protected)
+		w.WriteByteArray(external)
+		return w.CheckError()
+	})
+}
+
+// Encode writes the message with its tag.
+func (m *Encrypt0) Encode(encoder cbor.Writer) error {
+	encoder.WriteTag(TagEncrypt0)
+	encoder.WriteArraySize(3)
+	encoder.WriteByteArray(m.protected)
+	if err := m.Unprotected.Encode(encoder); err != nil {
+		return err
+	}
+	writeOptionalBytes(encoder, m.Ciphertext)
+	return encoder.CheckError()
+}
+
+// Decode reads a tagged or untagged message and checks its headers.
+func (m *Encrypt0) Decode(decoder *cbor.Decoder) error {
+	*m = Encrypt0{}
+	if err := readMessage(decoder, TagEncrypt0, 3, "COSE_Encrypt0"); err != nil {
+		return err
+	}
+	var err error
+	if m.protected, err = readHeaders(decoder, &m.Protected, &m.Unprotected); err != nil {
+		return err
+	}
+	m.Ciphertext, err = readOptionalBytes(decoder)
+	return err
+}
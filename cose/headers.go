@@ -0,0 +1,303 @@
+// Package cose implements CBOR Object Signing and Encryption (RFC 9052)
+// messages on top of the cbor package.
+//
+// Messages implement cbor.Codec, so they can be embedded in other
+// structures or converted with cbor.ToBytes and cbor.FromBytes. The bytes
+// that are signed are always encoded with cbor.Deterministic.
+package cose
+
+import (
+	"errors"
+	"strconv"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+// Header parameter labels (RFC 9052 §3.1).
+const (
+	HeaderAlgorithm   = 1
+	HeaderCritical    = 2
+	HeaderContentType = 3
+	HeaderKeyID       = 4
+	HeaderIV          = 5
+	HeaderPartialIV   = 6
+)
+
+// Algorithm identifiers (RFC 9053).
+const (
+	AlgorithmEdDSA   = -8
+	AlgorithmES256   = -7
+	AlgorithmA128GCM = 1
+	AlgorithmA192GCM = 2
+	AlgorithmA256GCM = 3
+	AlgorithmHMAC256 = 5 // HMAC with SHA-256, 256-bit tag
+)
+
+var (
+	ErrAlgorithmMismatch = errors.New("cose: algorithm does not match the key")
+	ErrDuplicateHeader   = errors.New("cose: header parameter in both protected and unprotected headers")
+	ErrCritical          = errors.New("cose: unsupported critical header parameter")
+)
+
+var headerFields = cbor.NewFieldTable(
+	cbor.IntKey(HeaderAlgorithm),
+	cbor.IntKey(HeaderCritical),
+	cbor.IntKey(HeaderContentType),
+	cbor.IntKey(HeaderKeyID),
+	cbor.IntKey(HeaderIV),
+	cbor.IntKey(HeaderPartialIV),
+)
+
+// Headers holds the header parameters of a message that this package
+// understands. Zero values are left out of the encoding. Other parameters
+// are skipped when decoding, unless they are marked critical.
+type Headers struct {
+	Algorithm int64
+	// Critical lists the labels of parameters that a recipient must
+	// understand. It is only allowed in protected headers.
+	Critical []int64
+	// ContentType is the media type of the payload. Integer CoAP content
+	// formats are not supported.
+	ContentType string
+	KeyID       []byte
+	IV          []byte
+	PartialIV   []byte
+}
+
+// has reports whether the parameter of field index i is present.
+func (h *Headers) has(i int) bool {
+	switch i {
+	case 0:
+		return h.Algorithm != 0
+	case 1:
+		return h.Critical != nil
+	case 2:
+		return h.ContentType != ""
+	case 3:
+		return h.KeyID != nil
+	case 4:
+		return h.IV != nil
+	default:
+		return h.PartialIV != nil
+	}
+}
+
+// Encode writes the headers as a map, with labels in ascending order.
+func (h *Headers) Encode(encoder cbor.Writer) error {
+	count := uint32(0)
+	for i := 0; i < headerFields.Len(); i++ {
+		if h.has(i) {
+			count++
+		}
+	}
+	encoder.WriteMapSize(count)
+	if h.has(0) {
+		headerFields.WriteKey(encoder, 0)
+		encoder.WriteInt64(h.Algorithm)
+	}
+	if h.has(1) {
+		headerFields.WriteKey(encoder, 1)
+		encoder.WriteArraySize(uint32(len(h.Critical)))
+		for _, label := range h.Critical {
+			encoder.WriteInt64(label)
+		}
+	}
+	if h.has(2) {
+		headerFields.WriteKey(encoder, 2)
+		encoder.WriteString(h.ContentType)
+	}
+	if h.has(3) {
+		headerFields.WriteKey(encoder, 3)
+		encoder.WriteByteArray(h.KeyID)
+	}
+	if h.has(4) {
+		headerFields.WriteKey(encoder, 4)
+		encoder.WriteByteArray(h.IV)
+	}
+	if h.has(5) {
+		headerFields.WriteKey(encoder, 5)
+		encoder.WriteByteArray(h.PartialIV)
+	}
+	return encoder.CheckError()
+}
+
+// Decode reads a header map.
+func (h *Headers) Decode(decoder *cbor.Decoder) error {
+	*h = Headers{}
+	size, indef, err := decoder.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if indef {
+		return cbor.NewReadError("cose: indefinite length header map")
+	}
+	for ; size > 0; size-- {
+		field, err := headerFields.ReadKey(decoder)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 0:
+			h.Algorithm, err = decoder.ReadInt64()
+		case 1:
+			h.Critical, err = readLabels(decoder)
+		case 2:
+			h.ContentType, err = decoder.ReadString()
+		case 3:
+			h.KeyID, err = decoder.ReadByteArrayCopy()
+		case 4:
+			h.IV, err = decoder.ReadByteArrayCopy()
+		case 5:
+			h.PartialIV, err = decoder.ReadByteArrayCopy()
+		default:
+			err = decoder.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readLabels(decoder *cbor.Decoder) ([]int64, error) {
+	size, indef, err := decoder.ReadArraySize()
+	if err != nil {
+		return nil, err
+	}
+	if indef || size == 0 {
+		return nil, cbor.NewReadError("cose: critical headers must be a non-empty array")
+	}
+	labels := make([]int64, size)
+	for i := range labels {
+		if labels[i], err = decoder.ReadInt64(); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// checkHeaders validates the headers of a received message: no parameter
+// may be both protected and unprotected, and critical parameters must be
+// protected ones that this package understands.
+func checkHeaders(protected, unprotected *Headers) error {
+	for i := 0; i < headerFields.Len(); i++ {
+		if protected.has(i) && unprotected.has(i) {
+			return ErrDuplicateHeader
+		}
+	}
+	if unprotected.Critical != nil {
+		return ErrCritical
+	}
+	for _, label := range protected.Critical {
+		field := -1
+		for i := 0; i < headerFields.Len(); i++ {
+			if key := headerFields.Key(i); key.Int() == label {
+				field = i
+			}
+		}
+		if field < 0 || !protected.has(field) {
+			return ErrCritical
+		}
+	}
+	return nil
+}
+
+// encodeProtected returns the serialized protected headers: empty for an
+// empty map, as RFC 9052 §3 requires.
+func encodeProtected(h *Headers) ([]byte, error) {
+	if isEmpty(h) {
+		return []byte{}, nil
+	}
+	return encodeDeterministic(h.Encode)
+}
+
+func isEmpty(h *Headers) bool {
+	for i := 0; i < headerFields.Len(); i++ {
+		if h.has(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeProtected parses serialized protected headers.
+func decodeProtected(data []byte, h *Headers) error {
+	if len(data) == 0 {
+		*h = Headers{}
+		return nil
+	}
+	return cbor.FromBytes(data, h)
+}
+
+// encodeDeterministic encodes what write writes with cbor.Deterministic.
+func encodeDeterministic(write func(w cbor.Writer) error) ([]byte, error) {
+	sizer := cbor.NewSizer(cbor.Deterministic())
+	if err := write(&sizer); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer, cbor.Deterministic())
+	if err := write(&encoder); err != nil {
+		return nil, err
+	}
+	return buffer, encoder.CheckError()
+}
+
+// readMessage reads the optional tag and the array head of a message of
+// size items.
+func readMessage(decoder *cbor.Decoder, tag uint64, size uint32, name string) error {
+	head, err := decoder.PeekType()
+	if err != nil {
+		return err
+	}
+	if head.Major == cbor.TypeMajorTagged {
+		number, err := decoder.ReadTag()
+		if err != nil {
+			return err
+		}
+		if number != tag {
+			return cbor.NewReadError("cose: unexpected tag")
+		}
+	}
+	n, indef, err := decoder.ReadArraySize()
+	if err != nil {
+		return err
+	}
+	if n != size || indef {
+		return cbor.NewReadError("cose: " + name + " must be an array of " + strconv.Itoa(int(size)) + " items")
+	}
+	return nil
+}
+
+// readHeaders reads the protected and unprotected headers of a message and
+// checks them. It returns the serialized protected headers.
+func readHeaders(decoder *cbor.Decoder, protected, unprotected *Headers) ([]byte, error) {
+	raw, err := decoder.ReadByteArrayCopy()
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeProtected(raw, protected); err != nil {
+		return nil, err
+	}
+	if err := unprotected.Decode(decoder); err != nil {
+		return nil, err
+	}
+	return raw, checkHeaders(protected, unprotected)
+}
+
+// readOptionalBytes reads a byte string, or null as nil.
+func readOptionalBytes(decoder *cbor.Decoder) ([]byte, error) {
+	// IsNextNil consumes the null
+	if isNil, err := decoder.IsNextNil(); err != nil || isNil {
+		return nil, err
+	}
+	return decoder.ReadByteArrayCopy()
+}
+
+func writeOptionalBytes(encoder cbor.Writer, b []byte) {
+	if b == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteByteArray(b)
+	}
+}
@@ -0,0 +1,116 @@
+package cose
+
+import (
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+// TagSign1 is the CBOR tag of a COSE_Sign1 message.
+const TagSign1 = 18
+
+// context string of the Sig_structure of COSE_Sign1
+const contextSignature1 = "Signature1"
+
+// Sign1 is a COSE_Sign1 message (RFC 9052 §4.2): a payload with a single
+// signature.
+//
+//	msg := cose.Sign1{Payload: payload}
+//	if err := msg.Sign(cose.NewEd25519Signer(key), nil); err != nil {
+//		...
+//	}
+//	data, err := cbor.ToBytes(&msg)
+type Sign1 struct {
+	Protected   Headers
+	Unprotected Headers
+	// Payload is the signed content. A nil payload is encoded as null, for
+	// detached content that Sign and Verify are given separately.
+	Payload   []byte
+	Signature []byte
+
+	// serialized protected headers, as signed
+	protected []byte
+}
+
+// Sign signs the message, setting the algorithm of the protected headers
+// to that of signer. external is additional data that is signed but not
+// transmitted; it may be nil. For detached content, pass the payload as
+// detached and leave Payload nil.
+func (m *Sign1) Sign(signer Signer, external []byte, detached ...[]byte) error {
+	m.Protected.Algorithm = signer.Algorithm()
+	protected, err := encodeProtected(&m.Protected)
+	if err != nil {
+		return err
+	}
+	m.protected = protected
+	toBeSigned, err := m.sigStructure(external, detached)
+	if err != nil {
+		return err
+	}
+	m.Signature, err = signer.Sign(toBeSigned)
+	return err
+}
+
+// Verify checks the signature of a decoded or signed message. The protected
+// headers must name the algorithm of verifier.
+func (m *Sign1) Verify(verifier Verifier, external []byte, detached ...[]byte) error {
+	if m.Protected.Algorithm != verifier.Algorithm() {
+		return ErrAlgorithmMismatch
+	}
+	toBeSigned, err := m.sigStructure(external, detached)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(toBeSigned, m.Signature)
+}
+
+// sigStructure encodes the Sig_structure of RFC 9052 §4.4.
+func (m *Sign1) sigStructure(external []byte, detached [][]byte) ([]byte, error) {
+	payload := m.Payload
+	if len(detached) > 0 {
+		payload = detached[0]
+	}
+	if external == nil {
+		external = []byte{}
+	}
+	if m.protected == nil {
+		m.protected = []byte{}
+	}
+	return encodeDeterministic(func(w cbor.Writer) error {
+		w.WriteArraySize(4)
+		w.WriteString(contextSignature1)
+		w.WriteByteArray(m.protected)
+		w.WriteByteArray(external)
+		w.WriteByteArray(payload)
+		return w.CheckError()
+	})
+}
+
+// Encode writes the message with its tag.
+func (m *Sign1) Encode(encoder cbor.Writer) error {
+	encoder.WriteTag(TagSign1)
+	encoder.WriteArraySize(4)
+	encoder.WriteByteArray(m.protected)
+	if err := m.Unprotected.Encode(encoder); err != nil {
+		return err
+	}
+	writeOptionalBytes(encoder, m.Payload)
+	encoder.WriteByteArray(m.Signature)
+	return encoder.CheckError()
+}
+
+// Decode reads a tagged or untagged message and checks its headers. The
+// signature is not verified.
+func (m *Sign1) Decode(decoder *cbor.Decoder) error {
+	*m = Sign1{}
+	if err := readMessage(decoder, TagSign1, 4, "COSE_Sign1"); err != nil {
+		return err
+	}
+	var err error
+	if m.protected, err = readHeaders(decoder, &m.Protected, &m.Unprotected); err != nil {
+		return err
+	}
+	if m.Payload, err = readOptionalBytes(decoder); err != nil {
+		return err
+	}
+	m.Signature, err = decoder.ReadByteArrayCopy()
+	return err
+}
@@ -0,0 +1,129 @@
+package cose
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// ErrSignature is returned when a signature does not verify.
+var ErrSignature = errors.New("cose: invalid signature")
+
+// Signer signs the bytes of a Sig_structure.
+type Signer interface {
+	// Algorithm returns the COSE algorithm identifier of the signer.
+	Algorithm() int64
+	Sign(toBeSigned []byte) ([]byte, error)
+}
+
+// Verifier verifies a signature over the bytes of a Sig_structure.
+type Verifier interface {
+	// Algorithm returns the COSE algorithm identifier of the verifier.
+	Algorithm() int64
+	Verify(toBeSigned, signature []byte) error
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns a Signer for EdDSA with an Ed25519 key.
+func NewEd25519Signer(key ed25519.PrivateKey) Signer {
+	return ed25519Signer{key: key}
+}
+
+func (s ed25519Signer) Algorithm() int64 {
+	return AlgorithmEdDSA
+}
+
+func (s ed25519Signer) Sign(toBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, toBeSigned), nil
+}
+
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier returns a Verifier for EdDSA with an Ed25519 key.
+func NewEd25519Verifier(key ed25519.PublicKey) Verifier {
+	return ed25519Verifier{key: key}
+}
+
+func (v ed25519Verifier) Algorithm() int64 {
+	return AlgorithmEdDSA
+}
+
+func (v ed25519Verifier) Verify(toBeSigned, signature []byte) error {
+	if !ed25519.Verify(v.key, toBeSigned, signature) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// size of each of r and s in an ES256 signature
+const es256ScalarSize = 32
+
+type es256Signer struct {
+	key  *ecdsa.PrivateKey
+	rand io.Reader
+}
+
+// NewES256Signer returns a Signer for ECDSA with SHA-256 on a P-256 key,
+// drawing randomness from rand. Signatures are the concatenation of r and
+// s, as RFC 9053 §2.1 requires.
+func NewES256Signer(key *ecdsa.PrivateKey, rand io.Reader) (Signer, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return es256Signer{key: key, rand: rand}, nil
+}
+
+func (s es256Signer) Algorithm() int64 {
+	return AlgorithmES256
+}
+
+func (s es256Signer) Sign(toBeSigned []byte) ([]byte, error) {
+	digest := sha256.Sum256(toBeSigned)
+	r, sv, err := ecdsa.Sign(s.rand, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 2*es256ScalarSize)
+	r.FillBytes(signature[:es256ScalarSize])
+	sv.FillBytes(signature[es256ScalarSize:])
+	return signature, nil
+}
+
+type es256Verifier struct {
+	key *ecdsa.PublicKey
+}
+
+// NewES256Verifier returns a Verifier for ECDSA with SHA-256 on a P-256
+// key.
+func NewES256Verifier(key *ecdsa.PublicKey) (Verifier, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return es256Verifier{key: key}, nil
+}
+
+func (v es256Verifier) Algorithm() int64 {
+	return AlgorithmES256
+}
+
+func (v es256Verifier) Verify(toBeSigned, signature []byte) error {
+	if len(signature) != 2*es256ScalarSize {
+		return ErrSignature
+	}
+	digest := sha256.Sum256(toBeSigned)
+	r := new(big.Int).SetBytes(signature[:es256ScalarSize])
+	s := new(big.Int).SetBytes(signature[es256ScalarSize:])
+	if !ecdsa.Verify(v.key, digest[:], r, s) {
+		return ErrSignature
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+// Package cwt implements CBOR Web Tokens (RFC 8392): claims sets that are
+// signed or authenticated with the cose package.
+//
+//	data, err := cwt.Sign(&cwt.Claims{
+//		Issuer:     "host",
+//		Subject:    "actor",
+//		Expiration: time.Now().Add(time.Hour),
+//	}, signer, cose.Headers{KeyID: kid})
+//
+//	claims, err := cwt.Verify(data, verifier)
+//	if err == nil {
+//		err = (&cwt.Validator{Issuer: "host"}).Validate(claims)
+//	}
+package cwt
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	cbor "github.com/wasmcloud/tinygo-cbor"
+	"github.com/wasmcloud/tinygo-cbor/cose"
+)
+
+// TagCWT is the CBOR tag that marks a COSE message as a CWT.
+const TagCWT = 61
+
+// Claim keys (RFC 8392 §4).
+const (
+	ClaimIssuer     = 1
+	ClaimSubject    = 2
+	ClaimAudience   = 3
+	ClaimExpiration = 4
+	ClaimNotBefore  = 5
+	ClaimIssuedAt   = 6
+	ClaimCWTID      = 7
+)
+
+var (
+	// ErrExpired is returned by Validate when the expiration time has
+	// passed.
+	ErrExpired = errors.New("cwt: token has expired")
+	// ErrNotYetValid is returned by Validate before the not before time.
+	ErrNotYetValid = errors.New("cwt: token is not yet valid")
+	// ErrIssuedLater is returned by Validate when the issued at time is
+	// in the future.
+	ErrIssuedLater = errors.New("cwt: token issued in the future")
+	// ErrIssuer is returned by Validate when the issuer is not the
+	// expected one.
+	ErrIssuer = errors.New("cwt: unexpected issuer")
+	// ErrAudience is returned by Validate when the audience is not the
+	// expected one.
+	ErrAudience = errors.New("cwt: unexpected audience")
+	// ErrNotTagged is returned by Verify and VerifyMAC when the COSE
+	// message lacks its tag.
+	ErrNotTagged = errors.New("cwt: COSE message is not tagged")
+	// ErrMessageType is returned by Verify and VerifyMAC when the COSE
+	// message is of another type than the one verified.
+	ErrMessageType = errors.New("cwt: unexpected COSE message type")
+
+	errTimeEncoding   = cbor.NewReadError("cwt: NumericDate must be an integer or a float")
+	errDuplicateClaim = cbor.NewReadError("cwt: duplicate claim")
+)
+
+var claimFields = cbor.NewFieldTable(
+	cbor.IntKey(ClaimIssuer),
+	cbor.IntKey(ClaimSubject),
+	cbor.IntKey(ClaimAudience),
+	cbor.IntKey(ClaimExpiration),
+	cbor.IntKey(ClaimNotBefore),
+	cbor.IntKey(ClaimIssuedAt),
+	cbor.IntKey(ClaimCWTID),
+)
+
+// Claims is the claims set of a token. Zero values are left out of the
+// encoding, and other claims are skipped when decoding. A claims set that
+// repeats a claim key fails to decode. Times are encoded as integer
+// seconds since the epoch, so fractions of a second are lost.
+type Claims struct {
+	Issuer     string
+	Subject    string
+	Audience   string
+	Expiration time.Time
+	NotBefore  time.Time
+	IssuedAt   time.Time
+	CWTID      []byte
+}
+
+// has reports whether the claim of field index i is present.
+func (c *Claims) has(i int) bool {
+	switch i {
+	case 0:
+		return c.Issuer != ""
+	case 1:
+		return c.Subject != ""
+	case 2:
+		return c.Audience != ""
+	case 3:
+		return !c.Expiration.IsZero()
+	case 4:
+		return !c.NotBefore.IsZero()
+	case 5:
+		return !c.IssuedAt.IsZero()
+	default:
+		return c.CWTID != nil
+	}
+}
+
+// Encode writes the claims as a map, with keys in ascending order.
+func (c *Claims) Encode(encoder cbor.Writer) error {
+	count := uint32(0)
+	for i := 0; i < claimFields.Len(); i++ {
+		if c.has(i) {
+			count++
+		}
+	}
+	encoder.WriteMapSize(count)
+	for i := 0; i < claimFields.Len(); i++ {
+		if !c.has(i) {
+			continue
+		}
+		claimFields.WriteKey(encoder, i)
+		switch i {
+		case 0:
+			encoder.WriteString(c.Issuer)
+		case 1:
+			encoder.WriteString(c.Subject)
+		case 2:
+			encoder.WriteString(c.Audience)
+		case 3:
+			encoder.WriteInt64(c.Expiration.Unix())
+		case 4:
+			encoder.WriteInt64(c.NotBefore.Unix())
+		case 5:
+			encoder.WriteInt64(c.IssuedAt.Unix())
+		default:
+			encoder.WriteByteArray(c.CWTID)
+		}
+	}
+	return encoder.CheckError()
+}
+
+// Decode reads a claims map.
+func (c *Claims) Decode(decoder *cbor.Decoder) error {
+	*c = Claims{}
+	size, indef, err := decoder.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if indef {
+		return cbor.NewReadError("cwt: indefinite length claims map")
+	}
+	var seen uint8
+	var others map[string]bool
+	for ; size > 0; size-- {
+		probe := *decoder
+		field, err := claimFields.ReadKey(decoder)
+		if err != nil {
+			return err
+		}
+		if field >= 0 {
+			if seen&(1<<field) != 0 {
+				return errDuplicateClaim
+			}
+			seen |= 1 << field
+		} else if key, ok := claimKey(&probe); ok {
+			if others[key] {
+				return errDuplicateClaim
+			}
+			if others == nil {
+				others = make(map[string]bool)
+			}
+			others[key] = true
+		}
+		switch field {
+		case 0:
+			c.Issuer, err = decoder.ReadString()
+		case 1:
+			c.Subject, err = decoder.ReadString()
+		case 2:
+			c.Audience, err = decoder.ReadString()
+		case 3:
+			c.Expiration, err = readNumericDate(decoder)
+		case 4:
+			c.NotBefore, err = readNumericDate(decoder)
+		case 5:
+			c.IssuedAt, err = readNumericDate(decoder)
+		case 6:
+			c.CWTID, err = decoder.ReadByteArrayCopy()
+		default:
+			err = decoder.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimKey returns a string that identifies the integer or text claim key
+// that follows, however it is encoded.
+func claimKey(decoder *cbor.Decoder) (string, bool) {
+	head, err := decoder.PeekType()
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case head.IsInteger():
+		return strconv.Itoa(int(head.Major)) + ":" + strconv.FormatUint(head.Arg, 10), true
+	case head.Major == cbor.TypeMajorText:
+		text, err := decoder.ReadString()
+		return "t:" + text, err == nil
+	}
+	return "", false
+}
+
+// readNumericDate reads seconds since the epoch, as an integer or a float.
+// RFC 8392 §2 leaves out tag 1, so a tagged date is an error.
+func readNumericDate(decoder *cbor.Decoder) (time.Time, error) {
+	head, err := decoder.PeekType()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch head.Major {
+	case cbor.TypeMajorUnsigned, cbor.TypeMajorSigned:
+		seconds, err := decoder.ReadInt64()
+		return time.Unix(seconds, 0), err
+	case cbor.TypeMajorSimple:
+		f, err := decoder.ReadFloat64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= 1<<63 {
+			return time.Time{}, errTimeEncoding
+		}
+		seconds, frac := math.Modf(f)
+		return time.Unix(int64(seconds), int64(frac*1e9)), nil
+	}
+	return time.Time{}, errTimeEncoding
+}
+
+// Validator checks the time-based claims of a token and, if set, its
+// issuer and audience. A missing time claim is not checked.
+type Validator struct {
+	// Now returns the current time; time.Now if nil. Tests inject a
+	// fixed clock here.
+	Now func() time.Time
+	// Leeway allows for clock skew between issuer and recipient.
+	Leeway time.Duration
+	// Issuer and Audience, if not empty, must equal the claims.
+	Issuer   string
+	Audience string
+}
+
+// Validate checks claims at the current time.
+func (v *Validator) Validate(claims *Claims) error {
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	t := now()
+	if !claims.Expiration.IsZero() && !t.Before(claims.Expiration.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if !claims.NotBefore.IsZero() && t.Add(v.Leeway).Before(claims.NotBefore) {
+		return ErrNotYetValid
+	}
+	if !claims.IssuedAt.IsZero() && t.Add(v.Leeway).Before(claims.IssuedAt) {
+		return ErrIssuedLater
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return ErrIssuer
+	}
+	if v.Audience != "" && claims.Audience != v.Audience {
+		return ErrAudience
+	}
+	return nil
+}
+
+// tagged wraps a COSE message in the CWT tag.
+type tagged struct {
+	message cbor.Encodable
+}
+
+func (t tagged) Encode(encoder cbor.Writer) error {
+	encoder.WriteTag(TagCWT)
+	return t.message.Encode(encoder)
+}
+
+// Sign returns claims as a tagged COSE_Sign1 token. unprotected usually
+// holds the key ID.
+func Sign(claims *Claims, signer cose.Signer, unprotected cose.Headers) ([]byte, error) {
+	payload, err := cbor.ToBytes(claims)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Sign1{Unprotected: unprotected, Payload: payload}
+	if err := msg.Sign(signer, nil); err != nil {
+		return nil, err
+	}
+	return cbor.ToBytes(tagged{&msg})
+}
+
+// Authenticate returns claims as a tagged COSE_Mac0 token.
+func Authenticate(claims *Claims, key []byte, unprotected cose.Headers) ([]byte, error) {
+	payload, err := cbor.ToBytes(claims)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Mac0{Unprotected: unprotected, Payload: payload}
+	if err := msg.Authenticate(key, nil); err != nil {
+		return nil, err
+	}
+	return cbor.ToBytes(tagged{&msg})
+}
+
+// Verify checks the signature of a COSE_Sign1 token and returns its
+// claims. The claims are not validated.
+func Verify(data []byte, verifier cose.Verifier) (*Claims, error) {
+	var msg cose.Sign1
+	if err := unwrap(data, cose.TagSign1, &msg); err != nil {
+		return nil, err
+	}
+	if err := msg.Verify(verifier, nil); err != nil {
+		return nil, err
+	}
+	return decodeClaims(msg.Payload)
+}
+
+// VerifyMAC checks the tag of a COSE_Mac0 token and returns its claims.
+// The claims are not validated.
+func VerifyMAC(data, key []byte) (*Claims, error) {
+	var msg cose.Mac0
+	if err := unwrap(data, cose.TagMac0, &msg); err != nil {
+		return nil, err
+	}
+	if err := msg.Verify(key, nil); err != nil {
+		return nil, err
+	}
+	return decodeClaims(msg.Payload)
+}
+
+// unwrap decodes the COSE message of a token, with or without the CWT
+// tag. RFC 8392 §6 requires the COSE tag, which tells the message types
+// apart.
+func unwrap(data []byte, tag uint64, msg cbor.Decodable) error {
+	decoder := cbor.NewDecoder(data)
+	head, err := decoder.PeekType()
+	if err != nil {
+		return err
+	}
+	if head.Major == cbor.TypeMajorTagged && head.Arg == TagCWT {
+		if _, err := decoder.ReadTag(); err != nil {
+			return err
+		}
+		if head, err = decoder.PeekType(); err != nil {
+			return err
+		}
+	}
+	if head.Major != cbor.TypeMajorTagged {
+		return ErrNotTagged
+	}
+	if head.Arg != tag {
+		return ErrMessageType
+	}
+	if err := msg.Decode(&decoder); err != nil {
+		return err
+	}
+	if !decoder.Done() {
+		return cbor.ErrTrailingData
+	}
+	return nil
+}
+
+func decodeClaims(payload []byte) (*Claims, error) {
+	var claims Claims
+	if err := cbor.FromBytes(payload, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
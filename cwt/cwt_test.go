@@ -0,0 +1,145 @@
+package cwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbor "github.com/wasmcloud/tinygo-cbor"
+	"github.com/wasmcloud/tinygo-cbor/cose"
+	"github.com/wasmcloud/tinygo-cbor/cwt"
+)
+
+// RFC 8392 Appendix A.1
+const exampleClaims = "a70175636f61703a2f2f61732e6578616d706c652e636f6d02656572696b77" +
+	"037818636f61703a2f2f6c696768742e6578616d706c652e636f6d041a5612aeb0" +
+	"051a5610d9f0061a5610d9f007420b71"
+
+func TestClaimsExample(t *testing.T) {
+	data, err := hex.DecodeString(exampleClaims)
+	require.NoError(t, err)
+	var claims cwt.Claims
+	require.NoError(t, cbor.FromBytes(data, &claims))
+	assert.Equal(t, cwt.Claims{
+		Issuer:     "coap://as.example.com",
+		Subject:    "erikw",
+		Audience:   "coap://light.example.com",
+		Expiration: time.Unix(1444064944, 0),
+		NotBefore:  time.Unix(1443944944, 0),
+		IssuedAt:   time.Unix(1443944944, 0),
+		CWTID:      []byte{0x0b, 0x71},
+	}, claims)
+
+	encoded, err := cbor.ToBytes(&claims)
+	require.NoError(t, err)
+	assert.Equal(t, data, encoded)
+}
+
+func TestClaimsDecode(t *testing.T) {
+	// {4: 1.5, 8: "cnf", 1: "x"}: float date, unknown claim skipped
+	var claims cwt.Claims
+	require.NoError(t, cbor.FromBytes([]byte{0xa3, 0x04, 0xf9, 0x3e, 0x00, 0x08, 0x63, 'c', 'n', 'f', 0x01, 0x61, 'x'}, &claims))
+	assert.Equal(t, "x", claims.Issuer)
+	assert.Equal(t, time.Unix(1, 5e8), claims.Expiration)
+
+	// {8: [_ (_ "cnf")], 1: "y"}: unknown claim of indefinite length
+	claims = cwt.Claims{}
+	require.NoError(t, cbor.FromBytes([]byte{0xa2, 0x08, 0x9f, 0x7f, 0x63, 'c', 'n', 'f', 0xff, 0xff, 0x01, 0x61, 'y'}, &claims))
+	assert.Equal(t, cwt.Claims{Issuer: "y"}, claims)
+
+	// {4: 1(0)}: tag 1 is not allowed
+	assert.Error(t, cbor.FromBytes([]byte{0xa1, 0x04, 0xc1, 0x00}, &claims))
+
+	// {1: "x", 1: "y"}: duplicate claims are rejected
+	var readErr cbor.ReadError
+	assert.ErrorAs(t, cbor.FromBytes([]byte{0xa2, 0x01, 0x61, 'x', 0x01, 0x61, 'y'}, &claims), &readErr)
+	// {8: 0, 8: 1}, the second 8 on two bytes, and {"a": 0, "a": 1}: so
+	// are unknown ones
+	assert.ErrorAs(t, cbor.FromBytes([]byte{0xa2, 0x08, 0x00, 0x18, 0x08, 0x01}, &claims), &readErr)
+	assert.ErrorAs(t, cbor.FromBytes([]byte{0xa2, 0x61, 'a', 0x00, 0x61, 'a', 0x01}, &claims), &readErr)
+	// {8: 0, -9: 1, "8": 2}: distinct keys
+	assert.NoError(t, cbor.FromBytes([]byte{0xa3, 0x08, 0x00, 0x28, 0x01, 0x61, '8', 0x02}, &claims))
+}
+
+func TestValidator(t *testing.T) {
+	now := time.Unix(1000, 0)
+	v := cwt.Validator{Now: func() time.Time { return now }, Issuer: "host", Audience: "actor"}
+	claims := cwt.Claims{
+		Issuer:     "host",
+		Audience:   "actor",
+		Expiration: now.Add(time.Minute),
+		NotBefore:  now,
+		IssuedAt:   now,
+	}
+	assert.NoError(t, v.Validate(&claims))
+
+	expired := claims
+	expired.Expiration = now
+	assert.ErrorIs(t, v.Validate(&expired), cwt.ErrExpired)
+	v.Leeway = time.Second
+	assert.NoError(t, v.Validate(&expired))
+	v.Leeway = 0
+
+	early := claims
+	early.NotBefore = now.Add(time.Second)
+	assert.ErrorIs(t, v.Validate(&early), cwt.ErrNotYetValid)
+	early.NotBefore = time.Time{}
+	early.IssuedAt = now.Add(time.Second)
+	assert.ErrorIs(t, v.Validate(&early), cwt.ErrIssuedLater)
+
+	other := claims
+	other.Issuer = "other"
+	assert.ErrorIs(t, v.Validate(&other), cwt.ErrIssuer)
+	other = claims
+	other.Audience = ""
+	assert.ErrorIs(t, v.Validate(&other), cwt.ErrAudience)
+
+	assert.NoError(t, (&cwt.Validator{}).Validate(&cwt.Claims{}))
+}
+
+func TestSignVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	claims := cwt.Claims{Issuer: "host", Subject: "actor", Expiration: time.Unix(2000000000, 0)}
+	data, err := cwt.Sign(&claims, cose.NewEd25519Signer(private), cose.Headers{KeyID: []byte("k1")})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xd8, 0x3d, 0xd2}, data[:3])
+
+	verified, err := cwt.Verify(data, cose.NewEd25519Verifier(public))
+	require.NoError(t, err)
+	assert.Equal(t, claims, *verified)
+
+	// the CWT tag is optional
+	_, err = cwt.Verify(data[2:], cose.NewEd25519Verifier(public))
+	assert.NoError(t, err)
+
+	data[len(data)-1] ^= 1
+	_, err = cwt.Verify(data, cose.NewEd25519Verifier(public))
+	assert.ErrorIs(t, err, cose.ErrSignature)
+
+	_, err = cwt.VerifyMAC(data, []byte("key"))
+	assert.ErrorIs(t, err, cwt.ErrMessageType)
+}
+
+func TestAuthenticate(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	claims := cwt.Claims{Subject: "actor", CWTID: []byte{1, 2}}
+	data, err := cwt.Authenticate(&claims, key, cose.Headers{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xd8, 0x3d, 0xd1}, data[:3])
+
+	verified, err := cwt.VerifyMAC(data, key)
+	require.NoError(t, err)
+	assert.Equal(t, claims, *verified)
+
+	_, err = cwt.VerifyMAC(data, []byte("other"))
+	assert.ErrorIs(t, err, cose.ErrMAC)
+
+	// an untagged COSE message cannot be told apart
+	_, err = cwt.VerifyMAC(data[3:], key)
+	assert.ErrorIs(t, err, cwt.ErrNotTagged)
+}
@@ -22,6 +22,13 @@ func NewDataReader(buffer []byte) DataReader {
 	}
 }
 
+// Reset makes the reader use buffer from its start, clearing any error.
+func (d *DataReader) Reset(buffer []byte) {
+	d.buffer = buffer
+	d.byteOffset = 0
+	d.err = nil
+}
+
 func (d *DataReader) checkRange(n uint32) error {
 	if d.byteOffset+n > uint32(len(d.buffer)) {
 		d.updateError(ErrRange)
@@ -30,6 +37,25 @@ func (d *DataReader) checkRange(n uint32) error {
 	return nil
 }
 
+// checkWrite is checkRange for writes. A write that does not fit still
+// advances the offset, so that the offset ends up at the size the data
+// needs, as with a Sizer.
+func (d *DataReader) checkWrite(n uint32) error {
+	if err := d.checkRange(n); err != nil {
+		d.byteOffset += n
+		return err
+	}
+	return nil
+}
+
+// number of bytes after the current offset
+func (d *DataReader) Remaining() uint32 {
+	if d.byteOffset >= uint32(len(d.buffer)) {
+		return 0
+	}
+	return uint32(len(d.buffer)) - d.byteOffset
+}
+
 // check whether any errors have occurred
 func (d *DataReader) CheckError() error {
 	return d.err 
@@ -55,7 +81,7 @@ func (d *DataReader) GetBytes(length uint32) ([]byte, error) {
 
 func (d *DataReader) SetBytes(src []byte) error {
 	srcLen := uint32(len(src))
-	if err := d.checkRange(srcLen); err != nil {
+	if err := d.checkWrite(srcLen); err != nil {
 		return err
 	}
 	copy(d.buffer[d.byteOffset:], src)
@@ -169,7 +195,7 @@ func (d *DataReader) GetUint64() (uint64, error) {
 }
 
 func (d *DataReader) SetFloat32(value float32) error {
-	if err := d.checkRange(4); err != nil {
+	if err := d.checkWrite(4); err != nil {
 		return err
 	}
 	bits := math.Float32bits(value)
@@ -179,7 +205,7 @@ func (d *DataReader) SetFloat32(value float32) error {
 }
 
 func (d *DataReader) SetFloat64(value float64) error {
-	if err := d.checkRange(8); err != nil {
+	if err := d.checkWrite(8); err != nil {
 		return err
 	}
 	bits := math.Float64bits(value)
@@ -189,7 +215,7 @@ func (d *DataReader) SetFloat64(value float64) error {
 }
 
 func (d *DataReader) SetInt8(value int8) error {
-	if err := d.checkRange(1); err != nil {
+	if err := d.checkWrite(1); err != nil {
 		return err
 	}
 	d.buffer[d.byteOffset] = uint8(value)
@@ -198,7 +224,7 @@ func (d *DataReader) SetInt8(value int8) error {
 }
 
 func (d *DataReader) SetInt16(value int16) error {
-	if err := d.checkRange(2); err != nil {
+	if err := d.checkWrite(2); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint16(d.buffer[d.byteOffset:], uint16(value))
@@ -207,7 +233,7 @@ func (d *DataReader) SetInt16(value int16) error {
 }
 
 func (d *DataReader) SetInt32(value int32) error {
-	if err := d.checkRange(4); err != nil {
+	if err := d.checkWrite(4); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint32(d.buffer[d.byteOffset:], uint32(value))
@@ -216,7 +242,7 @@ func (d *DataReader) SetInt32(value int32) error {
 }
 
 func (d *DataReader) SetInt64(value int64) error {
-	if err := d.checkRange(8); err != nil {
+	if err := d.checkWrite(8); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint64(d.buffer[d.byteOffset:], uint64(value))
@@ -225,7 +251,7 @@ func (d *DataReader) SetInt64(value int64) error {
 }
 
 func (d *DataReader) SetUint8(value uint8) error {
-	if err := d.checkRange(1); err != nil {
+	if err := d.checkWrite(1); err != nil {
 		return err
 	}
 	d.buffer[d.byteOffset] = value
@@ -234,7 +260,7 @@ func (d *DataReader) SetUint8(value uint8) error {
 }
 
 func (d *DataReader) SetUint16(value uint16) error {
-	if err := d.checkRange(2); err != nil {
+	if err := d.checkWrite(2); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint16(d.buffer[d.byteOffset:], value)
@@ -243,7 +269,7 @@ func (d *DataReader) SetUint16(value uint16) error {
 }
 
 func (d *DataReader) SetUint32(value uint32) error {
-	if err := d.checkRange(4); err != nil {
+	if err := d.checkWrite(4); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint32(d.buffer[d.byteOffset:], value)
@@ -252,7 +278,7 @@ func (d *DataReader) SetUint32(value uint32) error {
 }
 
 func (d *DataReader) SetUint64(value uint64) error {
-	if err := d.checkRange(8); err != nil {
+	if err := d.checkWrite(8); err != nil {
 		return err
 	}
 	binary.BigEndian.PutUint64(d.buffer[d.byteOffset:], value)
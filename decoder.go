@@ -3,6 +3,7 @@ package cbor
 import (
 	"math"
 	"strconv"
+	"unicode/utf8"
 )
 
 type ReadError struct {
@@ -17,14 +18,35 @@ func NewReadError(s string) ReadError {
 	return ReadError{message: s}
 }
 
+// ErrTrailingData is returned when bytes remain after the decoded item.
+var ErrTrailingData = ReadError{"trailing data after item"}
+
+// ErrInvalidSimple is returned for the simple values 24 to 31, which are
+// reserved: when writing them, and when reading their two-byte encoding.
+var ErrInvalidSimple = ReadError{"invalid simple value"}
+
+// Decoder reads CBOR from a buffer. A Decoder can be reused with Reset, so
+// that a long-lived component can decode every request with the same one.
 type Decoder struct {
 	reader DataReader
+	opts   decoderOptions
+}
+
+func NewDecoder(buffer []byte, opts ...DecoderOption) Decoder {
+	d := Decoder{
+		opts: newDecoderOptions(opts),
+	}
+	d.Reset(buffer)
+	return d
 }
 
-func NewDecoder(buffer []byte) Decoder {
-	return Decoder{
-		reader: NewDataReader(buffer),
+// Reset makes the decoder read buffer from its start, clearing any error.
+// Options given to NewDecoder are kept.
+func (d *Decoder) Reset(buffer []byte) {
+	if d.opts.stripSelfDescribe {
+		buffer = StripSelfDescribed(buffer)
 	}
+	d.reader.Reset(buffer)
 }
 
 // private function - exposed for debugging
@@ -32,6 +54,16 @@ func (d *Decoder) Pos() uint32 {
 	return d.reader.byteOffset
 }
 
+// Remaining returns the number of bytes left to decode.
+func (d *Decoder) Remaining() uint32 {
+	return d.reader.Remaining()
+}
+
+// Done reports whether the whole buffer has been decoded.
+func (d *Decoder) Done() bool {
+	return d.reader.Remaining() == 0
+}
+
 func (d *Decoder) IsNextNil() (bool, error) {
 	prefix, err := d.reader.PeekUint8()
 	if err != nil {
@@ -44,6 +76,18 @@ func (d *Decoder) IsNextNil() (bool, error) {
 	return false, nil
 }
 
+func (d *Decoder) IsNextUndefined() (bool, error) {
+	prefix, err := d.reader.PeekUint8()
+	if err != nil {
+		return false, err
+	}
+	if prefix == TypeUndefined {
+		err = d.reader.Discard(1)
+		return true, err
+	}
+	return false, nil
+}
+
 func (d *Decoder) ReadNull() (bool, error) {
 	prefix, err := d.reader.GetUint8()
 	if err != nil {
@@ -67,6 +111,33 @@ func (d *Decoder) ReadBool() (bool, error) {
 	return false, NewReadError("bad value for bool")
 }
 
+// ReadSimple reads a simple value (major type 7), including false (20),
+// true (21), null (22) and undefined (23). Floats are not simple values.
+func (d *Decoder) ReadSimple() (uint8, error) {
+	prefix, err := d.reader.GetUint8()
+	if err != nil {
+		return 0, err
+	}
+	if TypeOf(prefix) != TypeMajorSimple {
+		return 0, ReadError{"expected simple value"}
+	}
+	info := InfoOf(prefix)
+	if info < 24 {
+		return info, nil
+	}
+	if info != 24 {
+		return 0, ReadError{"expected simple value"}
+	}
+	v, err := d.reader.GetUint8()
+	if err != nil {
+		return 0, err
+	}
+	if v < 32 {
+		return 0, ErrInvalidSimple
+	}
+	return v, nil
+}
+
 func (d *Decoder) ReadInt8() (int8, error) {
 	v, err := d.reader.GetUint8()
 	if err != nil {
@@ -404,7 +475,8 @@ func (d *Decoder) ReadFloat32() (float32, error) {
 		return d.reader.GetFloat32()
 	}
 	if prefix == TypeF16 {
-		return 0, ReadError{"f16 not supported"}
+		h, err := d.reader.GetUint16()
+		return float16ToFloat32(h), err
 	}
 	return 0, ReadError{"bad prefix for float32"}
 }
@@ -421,10 +493,15 @@ func (d *Decoder) ReadFloat64() (float64, error) {
 	if prefix == TypeF64 {
 		return d.reader.GetFloat64()
 	}
+	if prefix == TypeF16 {
+		h, err := d.reader.GetUint16()
+		return float64(float16ToFloat32(h)), err
+	}
 	return 0, ReadError{"bad prefix for float64"}
 }
 
-// Read string of defined length
+// Read string of defined length. The string is copied out of the input
+// buffer; see ReadStringUnsafe for a variant that does not copy.
 func (d *Decoder) ReadString() (string, error) {
 	strLen, err := d.readStringLength()
 	if err != nil {
@@ -455,7 +532,31 @@ func (d *Decoder) readStringLength() (uint32, error) {
 	return uint32(strLen), nil
 }
 
+// ReadStringUnsafe reads a string without copying it. The string shares
+// memory with the input buffer, so the buffer must not be modified while
+// the string is in use.
+func (d *Decoder) ReadStringUnsafe() (string, error) {
+	strLen, err := d.readStringLength()
+	if err != nil {
+		return "", err
+	}
+	strBytes, err := d.reader.GetBytes(strLen)
+	if err != nil {
+		return "", err
+	}
+	return UnsafeString(strBytes), nil
+}
+
+// ReadByteArray reads a byte array. The result aliases the input buffer,
+// like ReadBytesNoCopy; use ReadByteArrayCopy to own the bytes.
 func (d *Decoder) ReadByteArray() ([]byte, error) {
+	return d.ReadBytesNoCopy()
+}
+
+// ReadBytesNoCopy reads a byte array without copying it. The result
+// aliases the input buffer, so it is only valid as long as the buffer is
+// and changes to one show in the other.
+func (d *Decoder) ReadBytesNoCopy() ([]byte, error) {
 	binLen, err := d.readBinLength()
 	if err != nil {
 		return nil, err
@@ -467,6 +568,39 @@ func (d *Decoder) ReadByteArray() ([]byte, error) {
 	return binBytes, nil
 }
 
+// ReadByteArrayCopy reads a byte array into newly allocated memory.
+func (d *Decoder) ReadByteArrayCopy() ([]byte, error) {
+	binBytes, err := d.ReadBytesNoCopy()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, binBytes...), nil
+}
+
+// ReadStringChunked reads a text string of definite or indefinite length,
+// joining the chunks of the latter. Unlike ReadString, it checks that the
+// string is valid UTF-8.
+func (d *Decoder) ReadStringChunked() (string, error) {
+	strBytes, err := d.readChunked(TypeMajorText)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(strBytes) {
+		return "", ReadError{"invalid UTF-8 in text string"}
+	}
+	return string(strBytes), nil
+}
+
+// ReadByteArrayChunked reads a byte string of definite or indefinite
+// length, joining the chunks of the latter, into newly allocated memory.
+func (d *Decoder) ReadByteArrayChunked() ([]byte, error) {
+	binBytes, err := d.readChunked(TypeMajorBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, binBytes...), nil
+}
+
 func (d *Decoder) readBinLength() (uint32, error) {
 	prefix, err := d.reader.GetUint8()
 	if err != nil {
@@ -543,105 +677,138 @@ func (d *Decoder) ReadTag() (uint64, error) {
 	return d.unsigned(InfoOf(prefix))
 }
 
-// subtract without underflow
-func saturating_sub(a uint64, b uint64) uint64 {
-	if b >= a {
-		return 0
+// ReadEmbedded reads an encoded CBOR data item (tag 24) and returns a
+// Decoder positioned on the embedded bytes. The returned Decoder aliases
+// the input buffer.
+func (d *Decoder) ReadEmbedded() (Decoder, error) {
+	tag, err := d.ReadTag()
+	if err != nil {
+		return Decoder{}, err
+	}
+	if tag != TagEmbeddedCBOR {
+		return Decoder{}, ReadError{"expected embedded CBOR (tag 24)"}
+	}
+	inner, err := d.ReadByteArray()
+	if err != nil {
+		return Decoder{}, err
 	}
-	return a - b
+	return NewDecoder(inner), nil
 }
 
-func (d *Decoder) Skip() error {
-	var nrounds uint64 = 1
-	var irounds uint64 = 0
+// ReadTypedArray reads an RFC 8746 typed array (tags 64-87). The data of
+// the returned array aliases the input buffer.
+func (d *Decoder) ReadTypedArray() (TypedArray, error) {
+	tag, err := d.ReadTag()
+	if err != nil {
+		return TypedArray{}, err
+	}
+	if !isTypedArrayTag(tag) {
+		return TypedArray{}, ReadError{"expected typed array"}
+	}
+	data, err := d.ReadByteArray()
+	if err != nil {
+		return TypedArray{}, err
+	}
+	a := TypedArray{Tag: tag, Data: data}
+	if len(data)%a.ElemSize() != 0 {
+		return TypedArray{}, ReadError{"typed array length is not a multiple of its element size"}
+	}
+	return a, nil
+}
 
-	for nrounds > 0 || irounds > 0 {
-		peek, err := d.reader.PeekUint8()
+// major type and initial byte of the next item
+func (d *Decoder) peekMajor() (uint8, uint8, error) {
+	prefix, err := d.reader.PeekUint8()
+	if err != nil {
+		return 0, 0, err
+	}
+	return TypeOf(prefix), prefix, nil
+}
+
+// ReadBreak consumes the break that ends an indefinite length array, map
+// or string and returns true, or returns false if another item is next.
+func (d *Decoder) ReadBreak() (bool, error) {
+	return d.atBreak()
+}
+
+// whether the next item is the break ending an indefinite length item
+func (d *Decoder) atBreak() (bool, error) {
+	prefix, err := d.reader.PeekUint8()
+	if err != nil {
+		return false, err
+	}
+	if prefix == TypeBreak {
+		return true, d.reader.Discard(1)
+	}
+	return false, nil
+}
+
+// skipFrame is an array, map, tag or indefinite length string that Skip
+// is inside of.
+type skipFrame struct {
+	// items still to skip; unused for indefinite lengths, which end at a
+	// break
+	left       uint64
+	indefinite bool
+	// chunks is the major type the chunks of an indefinite length string
+	// must have, or 0xff for other items
+	chunks uint8
+}
+
+// Skip consumes the next data item, including the items nested in it. It
+// does not recurse, so deeply nested data cannot exhaust the stack.
+func (d *Decoder) Skip() error {
+	frames := []skipFrame{{left: 1, chunks: 0xff}}
+	for len(frames) > 0 {
+		top := &frames[len(frames)-1]
+		if !top.indefinite && top.left == 0 {
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		t, err := d.PeekType()
 		if err != nil {
 			return err
 		}
-		if peek >= TypeU8ShortMin && peek <= TypeU64 {
-			if _, err = d.ReadUint64(); err != nil {
-				return err
-			}
-		} else if peek >= TypeMajorSigned && peek <= TypeI64 {
-			if _, err = d.ReadInt64(); err != nil {
-				return err
-			}
-		} else if peek >= TypeMajorBytes && peek <= TypeBytesIndef {
-			n, err := d.readBinLength()
-			if err != nil {
-				// this will return error for indefinite byte len
-				return err
-			}
-			if err = d.reader.Discard(n); err != nil {
-				return err
-			}
-		} else if peek >= TypeMajorText && peek < TypeMajorArray {
-			n, err := d.readStringLength()
-			if err != nil {
-				// this will return error for indefinite byte len
-				return err
-			}
-			if err = d.reader.Discard(n); err != nil {
-				return err
-			}
-		} else if peek >= TypeMajorArray && peek <= TypeArrayIndef {
-			n, indef, err := d.ReadArraySize()
-			if err != nil {
-				return err
-			}
-			// if indef {
-			//	return ReadError{"Indefinite arrays not supported"}
-			// }
-			if !indef {
-				nrounds += uint64(n)
-			} else if nrounds < 2 {
-				irounds += 1
-			} else {
-				return ReadError{"no arrays of indefinite length inside regular arrays or maps"}
+		if t.Simple == SimpleBreak {
+			if !top.indefinite {
+				return ReadError{"unexpected break @" + strconv.Itoa(int(d.reader.byteOffset))}
 			}
-		} else if peek >= TypeMajorMap && peek <= TypeMapIndef {
-			n, indef, err := d.ReadMapSize()
-			if err != nil {
-				return err
-			}
-			if !indef {
-				nrounds += uint64(n) * 2
-			} else if nrounds < 2 {
-				irounds += 1
-			} else {
-				return ReadError{"no maps of indefinite length inside regular arrays or maps"}
-			}
-		} else if peek >= TypeMajorTagged && peek <= TypeTagMax {
-			n, err := d.ReadUint8()
-			if err != nil {
-				return err
-			}
-			_, err = d.unsigned(InfoOf(n))
-			if err != nil {
+			if err := d.reader.Discard(1); err != nil {
 				return err
 			}
+			frames = frames[:len(frames)-1]
 			continue
-		} else if peek >= TypeMajorSimple && peek <= 0xfb {
-			n, err := d.ReadUint8()
-			if err != nil {
-				return err
-			}
-			_, err = d.unsigned(InfoOf(n))
-			if err != nil {
-				return err
-			}
-		} else if peek == TypeBreak {
-			_, err := d.ReadUint8()
-			if err != nil {
+		}
+		if top.chunks != 0xff && (t.Major != top.chunks || t.Indefinite) {
+			return ReadError{"invalid chunk in indefinite length string"}
+		}
+		if !top.indefinite {
+			top.left--
+		}
+		if err := d.reader.Discard(uint32(t.HeadLen)); err != nil {
+			return err
+		}
+		// strings hold Arg bytes and arrays and maps at least Arg items of
+		// one byte or more, so longer lengths cannot be satisfied
+		if !t.Indefinite && t.Major >= TypeMajorBytes && t.Major <= TypeMajorMap &&
+			t.Arg > uint64(d.reader.Remaining()) {
+			d.reader.updateError(ErrRange)
+			return ErrRange
+		}
+		switch t.Major {
+		case TypeMajorBytes, TypeMajorText:
+			if t.Indefinite {
+				frames = append(frames, skipFrame{indefinite: true, chunks: t.Major})
+			} else if err := d.reader.Discard(uint32(t.Arg)); err != nil {
 				return err
 			}
-			irounds = saturating_sub(irounds, 1)
-		} else {
-			return ReadError{message: "unknown tag " + strconv.Itoa(int(peek)) + " @" + strconv.Itoa(int(d.reader.byteOffset))}
+		case TypeMajorArray:
+			frames = append(frames, skipFrame{left: t.Arg, indefinite: t.Indefinite, chunks: 0xff})
+		case TypeMajorMap:
+			frames = append(frames, skipFrame{left: t.Arg * 2, indefinite: t.Indefinite, chunks: 0xff})
+		case TypeMajorTagged:
+			frames = append(frames, skipFrame{left: 1, chunks: 0xff})
 		}
-		nrounds = saturating_sub(nrounds, 1)
 	}
 	return nil
 }
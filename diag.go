@@ -0,0 +1,179 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Diag returns the data item in buf in the diagnostic notation of RFC 8949
+// §8, for example
+//
+//	{"a": 1, "b": [_ h'0102', -2.5], 1: 0("2013-03-21T20:04:00Z")}
+//
+// Indefinite length items are marked with an underscore. Encoding widths
+// are not shown.
+func Diag(buf []byte) (string, error) {
+	d := NewDecoder(buf)
+	g := diagWriter{d: &d}
+	if err := g.item(); err != nil {
+		return "", err
+	}
+	if !d.Done() {
+		return "", ErrTrailingData
+	}
+	return string(g.out), nil
+}
+
+type diagWriter struct {
+	d     *Decoder
+	out   []byte
+	depth nesting
+}
+
+func (g *diagWriter) item() error {
+	head, err := g.d.PeekType()
+	if err != nil {
+		return err
+	}
+	if err := g.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return err
+	}
+	switch head.Major {
+	case TypeMajorUnsigned:
+		g.out = strconv.AppendUint(g.out, head.Arg, 10)
+	case TypeMajorSigned:
+		if head.Arg == math.MaxUint64 {
+			g.out = append(g.out, "-18446744073709551616"...)
+		} else {
+			g.out = append(g.out, '-')
+			g.out = strconv.AppendUint(g.out, head.Arg+1, 10)
+		}
+	case TypeMajorBytes, TypeMajorText:
+		if head.Indefinite {
+			return g.items(head)
+		}
+		if head.Arg >= 0xffffffff {
+			return ReadError{"string too long"}
+		}
+		content, err := g.d.reader.GetBytes(uint32(head.Arg))
+		if err != nil {
+			return err
+		}
+		if head.Major == TypeMajorText {
+			g.out = appendQuoted(g.out, content)
+		} else {
+			g.out = append(g.out, "h'"...)
+			g.out = append(g.out, hex.EncodeToString(content)...)
+			g.out = append(g.out, '\'')
+		}
+	case TypeMajorArray, TypeMajorMap:
+		return g.items(head)
+	case TypeMajorTagged:
+		if err := g.depth.enter(); err != nil {
+			return err
+		}
+		g.out = strconv.AppendUint(g.out, head.Arg, 10)
+		g.out = append(g.out, '(')
+		if err := g.item(); err != nil {
+			return err
+		}
+		g.out = append(g.out, ')')
+		g.depth.leave()
+	default:
+		switch head.Simple {
+		case SimpleFloat16:
+			g.float(float64(float16ToFloat32(uint16(head.Arg))), 32)
+		case SimpleFloat32:
+			g.float(float64(math.Float32frombits(uint32(head.Arg))), 32)
+		case SimpleFloat64:
+			g.float(math.Float64frombits(head.Arg), 64)
+		case SimpleBreak:
+			return ReadError{"unexpected break"}
+		default:
+			g.out = append(g.out, simpleComment(head)...)
+		}
+	}
+	return nil
+}
+
+// items writes an array, a map or an indefinite length string, whose head
+// has been read.
+func (g *diagWriter) items(head ItemType) error {
+	if err := g.depth.enter(); err != nil {
+		return err
+	}
+	isString := head.Major == TypeMajorBytes || head.Major == TypeMajorText
+	isMap := head.Major == TypeMajorMap
+	open, end := "[", "]"
+	switch {
+	case isString:
+		open, end = "(", ")"
+	case isMap:
+		open, end = "{", "}"
+	}
+	g.out = append(g.out, open...)
+	if head.Indefinite {
+		g.out = append(g.out, "_ "...)
+	} else if head.Arg >= 0xffffffff {
+		return ReadError{"container too large"}
+	}
+	n := head.Arg
+	if isMap {
+		n *= 2
+	}
+	for i := uint64(0); head.Indefinite || i < n; i++ {
+		if head.Indefinite {
+			if done, err := g.d.atBreak(); err != nil {
+				return err
+			} else if done {
+				break
+			}
+		}
+		if i > 0 {
+			if isMap && i%2 == 1 {
+				g.out = append(g.out, ": "...)
+			} else {
+				g.out = append(g.out, ", "...)
+			}
+		}
+		if isString {
+			chunk, err := g.d.PeekType()
+			if err != nil {
+				return err
+			}
+			if chunk.Major != head.Major || chunk.Indefinite {
+				return ReadError{"invalid chunk in indefinite length string"}
+			}
+		}
+		if err := g.item(); err != nil {
+			return err
+		}
+	}
+	g.out = append(g.out, end...)
+	g.depth.leave()
+	return nil
+}
+
+func (g *diagWriter) float(f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		g.out = append(g.out, "NaN"...)
+	case math.IsInf(f, 1):
+		g.out = append(g.out, "Infinity"...)
+	case math.IsInf(f, -1):
+		g.out = append(g.out, "-Infinity"...)
+	default:
+		// keep a decimal point so that the number reads as a float
+		s := strconv.FormatFloat(f, 'g', -1, bits)
+		if !strings.Contains(s, ".") {
+			if i := strings.IndexByte(s, 'e'); i >= 0 {
+				s = s[:i] + ".0" + s[i:]
+			} else {
+				s += ".0"
+			}
+		}
+		g.out = append(g.out, s...)
+	}
+}
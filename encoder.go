@@ -1,18 +1,79 @@
 package cbor
 
+import (
+	"strconv"
+)
+
+// Encoder writes CBOR into a fixed size buffer. An Encoder can be reused
+// with Reset, which makes it suitable for a sync.Pool:
+//
+//	var encoders = sync.Pool{New: func() interface{} { return new(cbor.Encoder) }}
+//
+//	encoder := encoders.Get().(*cbor.Encoder)
+//	encoder.Reset(buffer)
+//	...
+//	encoders.Put(encoder)
 type Encoder struct {
 	reader DataReader
+	opts   encoderOptions
 }
 
-func NewEncoder(buffer []byte) Encoder {
-	return Encoder{
-		reader: NewDataReader(buffer),
+func NewEncoder(buffer []byte, opts ...EncoderOption) Encoder {
+	e := Encoder{
+		opts: newEncoderOptions(opts),
 	}
+	e.Reset(buffer)
+	return e
+}
+
+// Reset makes the encoder write to buffer from its start, clearing any
+// error. Options given to NewEncoder are kept.
+func (e *Encoder) Reset(buffer []byte) {
+	e.reader.Reset(buffer)
+	if e.opts.selfDescribe {
+		_ = e.reader.SetBytes(selfDescribedPrefix[:])
+	}
+}
+
+// ErrShortBuffer is returned by Encoder.CheckError when the data did not
+// fit in the buffer. Size is the buffer size the data needs, so the caller
+// can retry once with an exact allocation. It matches ErrRange with
+// errors.Is.
+type ErrShortBuffer struct {
+	Size uint32
+}
+
+func (e ErrShortBuffer) Error() string {
+	return "buffer too small: " + strconv.FormatUint(uint64(e.Size), 10) + " bytes needed"
+}
+
+func (e ErrShortBuffer) Is(target error) bool {
+	return target == ErrRange
 }
 
 // check whether any errors have occurred
 func (e *Encoder) CheckError() error {
-	return e.reader.CheckError()
+	err := e.reader.CheckError()
+	if err == ErrRange && e.Needed() > 0 {
+		return ErrShortBuffer{Size: e.Len()}
+	}
+	return err
+}
+
+// Len returns the number of bytes encoded so far. Writes past the end of
+// the buffer are still counted, so after a short buffer error Len is the
+// size the data needs.
+func (e *Encoder) Len() uint32 {
+	return e.reader.byteOffset
+}
+
+// Needed returns how many bytes the buffer is short of, or 0 if everything
+// written so far fits.
+func (e *Encoder) Needed() uint32 {
+	if size := uint32(len(e.reader.buffer)); e.reader.byteOffset > size {
+		return e.reader.byteOffset - size
+	}
+	return 0
 }
 
 // cbor ok
@@ -20,6 +81,23 @@ func (e *Encoder) WriteNil() {
 	_ = e.reader.SetUint8(TypeNull)
 }
 
+func (e *Encoder) WriteUndefined() {
+	_ = e.reader.SetUint8(TypeUndefined)
+}
+
+// WriteSimple writes a simple value. Values 24 to 31 are reserved and
+// cannot be encoded.
+func (e *Encoder) WriteSimple(value uint8) {
+	if value < 24 {
+		_ = e.reader.SetUint8(TypeMajorSimple | value)
+	} else if value < 32 {
+		e.reader.updateError(ErrInvalidSimple)
+	} else {
+		_ = e.reader.SetUint8(TypeSimple8)
+		_ = e.reader.SetUint8(value)
+	}
+}
+
 // cbor ok
 func (e *Encoder) WriteBool(value bool) {
 	if value {
@@ -162,25 +240,48 @@ func (e *Encoder) WriteUint64(value uint64) {
 }
 
 func (e *Encoder) WriteFloat32(value float32) {
+	if e.opts.deterministic {
+		e.WriteFloat(float64(value))
+		return
+	}
 	_ = e.reader.SetUint8(TypeF32)
 	_ = e.reader.SetFloat32(value)
 }
 
 func (e *Encoder) WriteFloat64(value float64) {
+	if e.opts.deterministic {
+		e.WriteFloat(value)
+		return
+	}
 	_ = e.reader.SetUint8(TypeF64)
 	_ = e.reader.SetFloat64(value)
 }
 
+// WriteFloat writes value in the shortest of half, single and double
+// precision that represents it exactly.
+func (e *Encoder) WriteFloat(value float64) {
+	prefix, bits := shortestFloat(value)
+	_ = e.reader.SetUint8(prefix)
+	switch prefix {
+	case TypeF16:
+		_ = e.reader.SetUint16(uint16(bits))
+	case TypeF32:
+		_ = e.reader.SetUint32(uint32(bits))
+	default:
+		_ = e.reader.SetUint64(bits)
+	}
+}
+
 func (e *Encoder) writeTypeLength(t uint8, x uint64) {
 	if x <= TypeU8ShortMax {
 		_ = e.reader.SetUint8(t | uint8(x))
-	} else if x < 0xff {
+	} else if x <= 0xff {
 		_ = e.reader.SetUint8(t | 24)
 		_ = e.reader.SetUint8(uint8(x))
-	} else if x < 0xffff {
+	} else if x <= 0xffff {
 		_ = e.reader.SetUint8(t | 25)
 		_ = e.reader.SetUint16(uint16(x))
-	} else if x < 0xffffffff {
+	} else if x <= 0xffffffff {
 		_ = e.reader.SetUint8(t | 26)
 		_ = e.reader.SetUint32(uint32(x))
 	} else {
@@ -207,3 +308,25 @@ func (e *Encoder) WriteArraySize(length uint32) {
 func (e *Encoder) WriteMapSize(length uint32) {
 	e.writeTypeLength(TypeMajorMap, uint64(length))
 }
+
+func (e *Encoder) WriteTag(tag uint64) {
+	e.writeTypeLength(TypeMajorTagged, tag)
+}
+
+// WriteEmbedded writes the item produced by fn as an encoded CBOR data item
+// (tag 24). fn is called twice: once to size the item, once to encode it.
+func (e *Encoder) WriteEmbedded(fn func(Writer)) {
+	// same options, without the self-describe prefix
+	sizer := Sizer{opts: encoderOptions{deterministic: e.opts.deterministic}}
+	fn(&sizer)
+	e.WriteTag(TagEmbeddedCBOR)
+	e.writeTypeLength(TypeMajorBytes, uint64(sizer.Len()))
+	fn(e)
+}
+
+// WriteTypedArray writes an RFC 8746 typed array: its tag followed by the
+// packed elements as a byte string.
+func (e *Encoder) WriteTypedArray(value TypedArray) {
+	e.WriteTag(value.Tag)
+	e.WriteByteArray(value.Data)
+}
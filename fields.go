@@ -0,0 +1,202 @@
+package cbor
+
+import "math"
+
+// FieldKey is the map key of a struct field: a text string or an integer.
+// Integer keys are much more compact than field names.
+type FieldKey struct {
+	text  string
+	num   int64
+	isInt bool
+}
+
+// TextKey returns a text string field key.
+func TextKey(s string) FieldKey {
+	return FieldKey{text: s}
+}
+
+// IntKey returns an integer field key.
+func IntKey(n int64) FieldKey {
+	return FieldKey{num: n, isInt: true}
+}
+
+// IsInt reports whether the key is an integer.
+func (k FieldKey) IsInt() bool {
+	return k.isInt
+}
+
+// Text returns the key of a text key.
+func (k FieldKey) Text() string {
+	return k.text
+}
+
+// Int returns the key of an integer key.
+func (k FieldKey) Int() int64 {
+	return k.num
+}
+
+// Write writes the key.
+func (k FieldKey) Write(w Writer) {
+	if k.isInt {
+		w.WriteInt64(k.num)
+	} else {
+		w.WriteString(k.text)
+	}
+}
+
+// FieldTable maps the field indices of a map-keyed struct to their keys.
+// It is meant to be declared once per type and shared by the type's Encode
+// and Decode methods:
+//
+//	var personFields = cbor.NewFieldTable(cbor.IntKey(1), cbor.IntKey(2))
+//
+//	func (o *Person) Decode(decoder *cbor.Decoder) error {
+//		...
+//		field, err := personFields.ReadKey(decoder)
+//		switch field {
+//		case 0:
+//			o.Name, err = decoder.ReadString()
+//		case 1:
+//			o.Age, err = decoder.ReadUint8()
+//		default:
+//			err = decoder.Skip()
+//		}
+//		...
+//	}
+type FieldTable struct {
+	keys []FieldKey
+}
+
+// NewFieldTable returns a table in which field i has key keys[i].
+func NewFieldTable(keys ...FieldKey) FieldTable {
+	return FieldTable{keys: keys}
+}
+
+// Len returns the number of fields.
+func (t *FieldTable) Len() int {
+	return len(t.keys)
+}
+
+// Key returns the key of field.
+func (t *FieldTable) Key(field int) FieldKey {
+	return t.keys[field]
+}
+
+// WriteKey writes the key of field.
+func (t *FieldTable) WriteKey(w Writer, field int) {
+	t.keys[field].Write(w)
+}
+
+// ReadKey reads a map key and returns the index of the matching field, or
+// -1 if the key is unknown. Keys of any type are consumed, so the caller
+// only has to skip the value of an unknown field.
+func (t *FieldTable) ReadKey(d *Decoder) (int, error) {
+	head, err := d.PeekType()
+	if err != nil {
+		return -1, err
+	}
+	switch {
+	case head.Major == TypeMajorText && !head.Indefinite:
+		strLen, err := d.readStringLength()
+		if err != nil {
+			return -1, err
+		}
+		strBytes, err := d.reader.GetBytes(strLen)
+		if err != nil {
+			return -1, err
+		}
+		for i, k := range t.keys {
+			if !k.isInt && k.text == string(strBytes) {
+				return i, nil
+			}
+		}
+		return -1, nil
+	case head.IsInteger():
+		if err := d.reader.Discard(uint32(head.HeadLen)); err != nil {
+			return -1, err
+		}
+		if head.Arg > math.MaxInt64 {
+			// cannot match an int64 key
+			return -1, nil
+		}
+		if head.Major == TypeMajorSigned {
+			return t.findInt(-1 - int64(head.Arg)), nil
+		}
+		return t.findInt(int64(head.Arg)), nil
+	default:
+		return -1, d.Skip()
+	}
+}
+
+func (t *FieldTable) findInt(n int64) int {
+	for i, k := range t.keys {
+		if k.isInt && k.num == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// ArrayFields reads a struct encoded positionally, as an array of its
+// fields in declaration order. Arrays written by older or newer versions
+// of a type are tolerated: Next reports false once the array runs out of
+// fields, and Finish skips fields the reader does not know about.
+//
+//	fields, err := decoder.ReadArrayFields()
+//	if ok, err := fields.Next(); err != nil {
+//		return err
+//	} else if ok {
+//		o.Name, err = decoder.ReadString()
+//	}
+//	...
+//	return fields.Finish()
+type ArrayFields struct {
+	decoder   *Decoder
+	remaining uint32
+	indef     bool
+	done      bool
+}
+
+// ReadArrayFields reads the head of a positionally encoded struct.
+func (d *Decoder) ReadArrayFields() (ArrayFields, error) {
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return ArrayFields{}, err
+	}
+	return ArrayFields{decoder: d, remaining: size, indef: indef, done: !indef && size == 0}, nil
+}
+
+// Next reports whether the array holds another field. If it does, the
+// Decoder is positioned on it and the caller must read it.
+func (a *ArrayFields) Next() (bool, error) {
+	if a.done {
+		return false, nil
+	}
+	if a.indef {
+		prefix, err := a.decoder.reader.PeekUint8()
+		if err != nil {
+			return false, err
+		}
+		if prefix == TypeBreak {
+			a.done = true
+			return false, a.decoder.reader.Discard(1)
+		}
+		return true, nil
+	}
+	a.remaining--
+	a.done = a.remaining == 0
+	return true, nil
+}
+
+// Finish skips any fields that were not read.
+func (a *ArrayFields) Finish() error {
+	for {
+		ok, err := a.Next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := a.decoder.Skip(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cbor
+
+import "math"
+
+// float16ToFloat32 widens the bits of an IEEE 754 half-precision float.
+// Every half-precision value is exactly representable as a float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch {
+	case exp == 0x1f:
+		// infinity or NaN, keeping the payload
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	case exp != 0:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+	case frac == 0:
+		return math.Float32frombits(sign)
+	}
+	// subnormal: frac * 2^-24
+	f := float32(frac) / (1 << 24)
+	if sign != 0 {
+		f = -f
+	}
+	return f
+}
+
+// float32ToFloat16 narrows f to half precision. ok is false if the result
+// would not have the same value.
+func float32ToFloat16(f float32) (h uint16, ok bool) {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int32(b>>23) & 0xff
+	frac := b & 0x7fffff
+	switch {
+	case exp == 0xff:
+		if frac&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | 0x7c00 | uint16(frac>>13), true
+	case exp == 0:
+		// zero; float32 subnormals are too small for half precision
+		return sign, frac == 0
+	}
+	e := exp - 127
+	switch {
+	case e >= -14 && e <= 15:
+		if frac&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(e+15)<<10 | uint16(frac>>13), true
+	case e >= -24 && e < -14:
+		// half precision subnormal: m * 2^-24
+		mant := frac | 1<<23
+		shift := uint32(-1 - e)
+		if mant&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(mant>>shift), true
+	}
+	return 0, false
+}
+
+// shortestFloat returns the initial byte and bits of the shortest encoding
+// of f that keeps its value. NaN is always encoded as the half precision
+// quiet NaN.
+func shortestFloat(f float64) (uint8, uint64) {
+	if f != f {
+		return TypeF16, 0x7e00
+	}
+	f32 := float32(f)
+	if float64(f32) != f {
+		return TypeF64, math.Float64bits(f)
+	}
+	if h, ok := float32ToFloat16(f32); ok {
+		return TypeF16, uint64(h)
+	}
+	return TypeF32, uint64(math.Float32bits(f32))
+}
@@ -31,6 +31,7 @@ const (
 	TypeBoolTrue       = 0xf5
 	TypeNull           = 0xf6
 	TypeUndefined      = 0xf7
+	TypeSimple8        = 0xf8
 	TypeF16            = 0xf9
 	TypeF32            = 0xfa
 	TypeF64            = 0xfb
@@ -44,3 +45,46 @@ const (
 	TypeMajorTagged    = 0xc0 // major type : high 3 bits
 	TypeMajorSimple    = 0xe0 // major type : high 3 bits
 )
+
+// Registered tag numbers used by this package.
+const (
+	TagEmbeddedCBOR        = 24    // encoded CBOR data item, wrapped in a byte string
+	TagMultiDimRowMajor    = 40    // multi-dimensional array, row-major order
+	TagTypedArrayMin       = 64    // first RFC 8746 typed array tag
+	TagTypedArrayMax       = 87    // last RFC 8746 typed array tag
+	TagSet                 = 258   // set of unique elements
+	TagMultiDimColumnMajor = 1040  // multi-dimensional array, column-major order
+	TagSelfDescribed       = 55799 // self-described CBOR, encodes as 0xd9d9f7
+)
+
+// head of tag 55799
+var selfDescribedPrefix = [3]byte{0xd9, 0xd9, 0xf7}
+
+// RFC 8746 typed array tags. The tag number encodes the element type as
+// 0b010_f_s_e_ll: f is set for floats, s for signed integers, e for little
+// endian and ll is the element width.
+const (
+	TagUint8Array        = 64
+	TagUint16BEArray     = 65
+	TagUint32BEArray     = 66
+	TagUint64BEArray     = 67
+	TagUint8ClampedArray = 68
+	TagUint16LEArray     = 69
+	TagUint32LEArray     = 70
+	TagUint64LEArray     = 71
+	TagInt8Array         = 72
+	TagInt16BEArray      = 73
+	TagInt32BEArray      = 74
+	TagInt64BEArray      = 75
+	TagInt16LEArray      = 77
+	TagInt32LEArray      = 78
+	TagInt64LEArray      = 79
+	TagFloat16BEArray    = 80
+	TagFloat32BEArray    = 81
+	TagFloat64BEArray    = 82
+	TagFloat128BEArray   = 83
+	TagFloat16LEArray    = 84
+	TagFloat32LEArray    = 85
+	TagFloat64LEArray    = 86
+	TagFloat128LEArray   = 87
+)
@@ -0,0 +1,90 @@
+// Package fieldtag parses the `cbor` struct tags understood by both
+// Marshal and tinygo-cbor-gen, so that the two agree on field keys.
+package fieldtag
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrKeyAsInt is returned for a keyasint field whose key is not an
+// integer.
+var ErrKeyAsInt = errors.New("keyasint requires an integer key")
+
+// Tag is a parsed `cbor:"key,opt1,opt2"` tag value.
+type Tag struct {
+	// Name is the key given in the tag: empty for the default key, "-" for
+	// a field that is left out.
+	Name string
+	// OmitEmpty, KeyAsInt and ToArray are set by the options of the same
+	// name.
+	OmitEmpty bool
+	KeyAsInt  bool
+	ToArray   bool
+}
+
+// Parse splits a `cbor:"key,opt1,opt2"` tag value. Unknown options are
+// ignored.
+func Parse(tag string) Tag {
+	parts := strings.Split(tag, ",")
+	t := Tag{Name: parts[0]}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			t.OmitEmpty = true
+		case "keyasint":
+			t.KeyAsInt = true
+		case "toarray":
+			t.ToArray = true
+		}
+	}
+	return t
+}
+
+// Skip reports whether the field is left out.
+func (t Tag) Skip() bool {
+	return t.Name == "-"
+}
+
+// Key returns the key of the field named field: the name of the tag, or
+// DefaultKey(field) if there is none. With keyasint, the key is parsed as
+// an integer and returned in num as well as, normalized, in text; an
+// error wrapping ErrKeyAsInt and naming the key is returned if it is not
+// an integer.
+func (t Tag) Key(field string) (text string, num int64, err error) {
+	text = t.Name
+	if text == "" {
+		text = DefaultKey(field)
+	}
+	if !t.KeyAsInt {
+		return text, 0, nil
+	}
+	num, err = strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w, not %q", ErrKeyAsInt, text)
+	}
+	return strconv.FormatInt(num, 10), num, nil
+}
+
+// DefaultKey lower-cases the leading upper-case run of a field name, so
+// that "BoolValue" becomes "boolValue" and "URLPath" becomes "urlPath".
+func DefaultKey(name string) string {
+	runes := []rune(name)
+	i := 0
+	for i < len(runes) && unicode.IsUpper(runes[i]) {
+		i++
+	}
+	if i > 1 && i < len(runes) && unicode.IsLower(runes[i]) {
+		i--
+	}
+	if i == 0 {
+		i = 1
+	}
+	for j := 0; j < i && j < len(runes); j++ {
+		runes[j] = unicode.ToLower(runes[j])
+	}
+	return string(runes)
+}
@@ -0,0 +1,52 @@
+package fieldtag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, Tag{}, Parse(""))
+	assert.Equal(t, Tag{Name: "-"}, Parse("-"))
+	assert.True(t, Parse("-").Skip())
+	assert.Equal(t, Tag{Name: "1", KeyAsInt: true, OmitEmpty: true}, Parse("1,keyasint,omitempty,unknown"))
+	assert.Equal(t, Tag{ToArray: true}, Parse(",toarray"))
+}
+
+func TestKey(t *testing.T) {
+	text, _, err := Parse("").Key("URLPath")
+	require.NoError(t, err)
+	assert.Equal(t, "urlPath", text)
+	text, _, err = Parse("path,omitempty").Key("URLPath")
+	require.NoError(t, err)
+	assert.Equal(t, "path", text)
+
+	text, num, err := Parse("+07,keyasint").Key("F")
+	require.NoError(t, err)
+	assert.Equal(t, "7", text)
+	assert.Equal(t, int64(7), num)
+	text, num, err = Parse("-1,keyasint").Key("F")
+	require.NoError(t, err)
+	assert.Equal(t, "-1", text)
+	assert.Equal(t, int64(-1), num)
+
+	_, _, err = Parse("f,keyasint").Key("F")
+	assert.ErrorIs(t, err, ErrKeyAsInt)
+	assert.EqualError(t, err, `keyasint requires an integer key, not "f"`)
+	_, _, err = Parse(",keyasint").Key("F")
+	assert.ErrorIs(t, err, ErrKeyAsInt)
+}
+
+func TestDefaultKey(t *testing.T) {
+	for name, expected := range map[string]string{
+		"BoolValue": "boolValue",
+		"U8Value":   "u8Value",
+		"URLPath":   "urlPath",
+		"ID":        "id",
+		"X":         "x",
+	} {
+		assert.Equal(t, expected, DefaultKey(name))
+	}
+}
@@ -0,0 +1,63 @@
+// Package gentest holds types used to exercise the code generated by
+// tinygo-cbor-gen.
+package gentest
+
+//go:generate go run github.com/wasmcloud/tinygo-cbor/cmd/tinygo-cbor-gen -type=Everything,Nested,Point,Compact
+
+type Color uint8
+
+type Tags []string
+
+type Everything struct {
+	BoolValue   bool
+	U8Value     uint8
+	U16Value    uint16
+	U32Value    uint32
+	U64Value    uint64
+	UintValue   uint
+	S8Value     int8
+	S16Value    int16
+	S32Value    int32
+	S64Value    int64
+	IntValue    int
+	F32Value    float32
+	F64Value    float64
+	StringValue string
+	BytesValue  []byte
+	Digest      [4]byte
+	Color       Color
+	Tags        Tags
+	ArrayValue  []int64
+	Matrix      [][]float64
+	MapValue    map[string]int64
+	Nested      Nested
+	NestedPtr   *Nested
+	NestedList  []Nested
+	NestedMap   map[string]*Nested
+	Optional    *string
+	Renamed     string `cbor:"other"`
+	Omitted     string `cbor:"omitted,omitempty"`
+	Ignored     string `cbor:"-"`
+	Point       Point
+	unexported  int
+}
+
+type Nested struct {
+	Foo   string
+	Other string
+	Array []int64
+}
+
+// Point is encoded positionally, as [x, y].
+type Point struct {
+	_ struct{} `cbor:",toarray"`
+	X int32
+	Y int32
+}
+
+// Compact uses integer keys.
+type Compact struct {
+	Name  string `cbor:"1,keyasint"`
+	Count int64  `cbor:"-2,keyasint,omitempty"`
+	Label string `cbor:"label"`
+}
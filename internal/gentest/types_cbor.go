@@ -0,0 +1,635 @@
+// Code generated by tinygo-cbor-gen. DO NOT EDIT.
+
+package gentest
+
+import cbor "github.com/wasmcloud/tinygo-cbor"
+
+// Encode writes Everything to encoder.
+func (o *Everything) Encode(encoder cbor.Writer) error {
+	if o == nil {
+		encoder.WriteNil()
+		return encoder.CheckError()
+	}
+	numFields := uint32(28)
+	if o.Omitted != "" {
+		numFields++
+	}
+	encoder.WriteMapSize(numFields)
+	encoder.WriteString("boolValue")
+	encoder.WriteBool(o.BoolValue)
+	encoder.WriteString("u8Value")
+	encoder.WriteUint8(o.U8Value)
+	encoder.WriteString("u16Value")
+	encoder.WriteUint16(o.U16Value)
+	encoder.WriteString("u32Value")
+	encoder.WriteUint32(o.U32Value)
+	encoder.WriteString("u64Value")
+	encoder.WriteUint64(o.U64Value)
+	encoder.WriteString("uintValue")
+	encoder.WriteUint64(uint64(o.UintValue))
+	encoder.WriteString("s8Value")
+	encoder.WriteInt8(o.S8Value)
+	encoder.WriteString("s16Value")
+	encoder.WriteInt16(o.S16Value)
+	encoder.WriteString("s32Value")
+	encoder.WriteInt32(o.S32Value)
+	encoder.WriteString("s64Value")
+	encoder.WriteInt64(o.S64Value)
+	encoder.WriteString("intValue")
+	encoder.WriteInt64(int64(o.IntValue))
+	encoder.WriteString("f32Value")
+	encoder.WriteFloat32(o.F32Value)
+	encoder.WriteString("f64Value")
+	encoder.WriteFloat64(o.F64Value)
+	encoder.WriteString("stringValue")
+	encoder.WriteString(o.StringValue)
+	encoder.WriteString("bytesValue")
+	if o.BytesValue == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteByteArray(o.BytesValue)
+	}
+	encoder.WriteString("digest")
+	encoder.WriteByteArray(o.Digest[:])
+	encoder.WriteString("color")
+	encoder.WriteUint8(uint8(o.Color))
+	encoder.WriteString("tags")
+	if o.Tags == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteArraySize(uint32(len(o.Tags)))
+		for i0 := range o.Tags {
+			encoder.WriteString(o.Tags[i0])
+		}
+	}
+	encoder.WriteString("arrayValue")
+	if o.ArrayValue == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteArraySize(uint32(len(o.ArrayValue)))
+		for i0 := range o.ArrayValue {
+			encoder.WriteInt64(o.ArrayValue[i0])
+		}
+	}
+	encoder.WriteString("matrix")
+	if o.Matrix == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteArraySize(uint32(len(o.Matrix)))
+		for i0 := range o.Matrix {
+			if o.Matrix[i0] == nil {
+				encoder.WriteNil()
+			} else {
+				encoder.WriteArraySize(uint32(len(o.Matrix[i0])))
+				for i1 := range o.Matrix[i0] {
+					encoder.WriteFloat64(o.Matrix[i0][i1])
+				}
+			}
+		}
+	}
+	encoder.WriteString("mapValue")
+	if o.MapValue == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteMapSize(uint32(len(o.MapValue)))
+		for k0, v0 := range o.MapValue {
+			encoder.WriteString(k0)
+			encoder.WriteInt64(v0)
+		}
+	}
+	encoder.WriteString("nested")
+	if err := o.Nested.Encode(encoder); err != nil {
+		return err
+	}
+	encoder.WriteString("nestedPtr")
+	if o.NestedPtr == nil {
+		encoder.WriteNil()
+	} else {
+		if err := o.NestedPtr.Encode(encoder); err != nil {
+			return err
+		}
+	}
+	encoder.WriteString("nestedList")
+	if o.NestedList == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteArraySize(uint32(len(o.NestedList)))
+		for i0 := range o.NestedList {
+			if err := o.NestedList[i0].Encode(encoder); err != nil {
+				return err
+			}
+		}
+	}
+	encoder.WriteString("nestedMap")
+	if o.NestedMap == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteMapSize(uint32(len(o.NestedMap)))
+		for k0, v0 := range o.NestedMap {
+			encoder.WriteString(k0)
+			if v0 == nil {
+				encoder.WriteNil()
+			} else {
+				if err := v0.Encode(encoder); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	encoder.WriteString("optional")
+	if o.Optional == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteString(*o.Optional)
+	}
+	encoder.WriteString("other")
+	encoder.WriteString(o.Renamed)
+	if o.Omitted != "" {
+		encoder.WriteString("omitted")
+		encoder.WriteString(o.Omitted)
+	}
+	encoder.WriteString("point")
+	if err := o.Point.Encode(encoder); err != nil {
+		return err
+	}
+	return encoder.CheckError()
+}
+
+// Decode reads Everything from decoder.
+func (o *Everything) Decode(decoder *cbor.Decoder) error {
+	numFields, indef, err := decoder.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if indef {
+		return cbor.NewReadError("Everything: indefinite length maps not supported")
+	}
+	for ; numFields > 0; numFields-- {
+		field, err := decoder.ReadString()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case "boolValue":
+			if o.BoolValue, err = decoder.ReadBool(); err != nil {
+				return err
+			}
+		case "u8Value":
+			if o.U8Value, err = decoder.ReadUint8(); err != nil {
+				return err
+			}
+		case "u16Value":
+			if o.U16Value, err = decoder.ReadUint16(); err != nil {
+				return err
+			}
+		case "u32Value":
+			if o.U32Value, err = decoder.ReadUint32(); err != nil {
+				return err
+			}
+		case "u64Value":
+			if o.U64Value, err = decoder.ReadUint64(); err != nil {
+				return err
+			}
+		case "uintValue":
+			if v, err := decoder.ReadUint64(); err != nil {
+				return err
+			} else if uint64(uint(v)) != v {
+				return cbor.ErrRange
+			} else {
+				o.UintValue = uint(v)
+			}
+		case "s8Value":
+			if o.S8Value, err = decoder.ReadInt8(); err != nil {
+				return err
+			}
+		case "s16Value":
+			if o.S16Value, err = decoder.ReadInt16(); err != nil {
+				return err
+			}
+		case "s32Value":
+			if o.S32Value, err = decoder.ReadInt32(); err != nil {
+				return err
+			}
+		case "s64Value":
+			if o.S64Value, err = decoder.ReadInt64(); err != nil {
+				return err
+			}
+		case "intValue":
+			if v, err := decoder.ReadInt64(); err != nil {
+				return err
+			} else if int64(int(v)) != v {
+				return cbor.ErrRange
+			} else {
+				o.IntValue = int(v)
+			}
+		case "f32Value":
+			if o.F32Value, err = decoder.ReadFloat32(); err != nil {
+				return err
+			}
+		case "f64Value":
+			if o.F64Value, err = decoder.ReadFloat64(); err != nil {
+				return err
+			}
+		case "stringValue":
+			if o.StringValue, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case "bytesValue":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.BytesValue = nil
+			} else {
+				if o.BytesValue, err = decoder.ReadByteArrayCopy(); err != nil {
+					return err
+				}
+			}
+		case "digest":
+			if v, err := decoder.ReadByteArray(); err != nil {
+				return err
+			} else if len(v) != len(o.Digest) {
+				return cbor.NewReadError("byte array length mismatch")
+			} else {
+				copy(o.Digest[:], v)
+			}
+		case "color":
+			if v, err := decoder.ReadUint8(); err != nil {
+				return err
+			} else {
+				o.Color = Color(v)
+			}
+		case "tags":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.Tags = nil
+			} else {
+				size, indef, err := decoder.ReadArraySize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length arrays not supported")
+				}
+				o.Tags = make(Tags, size)
+				for i0 := range o.Tags {
+					if o.Tags[i0], err = decoder.ReadString(); err != nil {
+						return err
+					}
+				}
+			}
+		case "arrayValue":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.ArrayValue = nil
+			} else {
+				size, indef, err := decoder.ReadArraySize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length arrays not supported")
+				}
+				o.ArrayValue = make([]int64, size)
+				for i0 := range o.ArrayValue {
+					if o.ArrayValue[i0], err = decoder.ReadInt64(); err != nil {
+						return err
+					}
+				}
+			}
+		case "matrix":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.Matrix = nil
+			} else {
+				size, indef, err := decoder.ReadArraySize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length arrays not supported")
+				}
+				o.Matrix = make([][]float64, size)
+				for i0 := range o.Matrix {
+					if isNil, err := decoder.IsNextNil(); err != nil {
+						return err
+					} else if isNil {
+						o.Matrix[i0] = nil
+					} else {
+						size, indef, err := decoder.ReadArraySize()
+						if err != nil {
+							return err
+						}
+						if indef {
+							return cbor.NewReadError("indefinite length arrays not supported")
+						}
+						o.Matrix[i0] = make([]float64, size)
+						for i1 := range o.Matrix[i0] {
+							if o.Matrix[i0][i1], err = decoder.ReadFloat64(); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		case "mapValue":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.MapValue = nil
+			} else {
+				size, indef, err := decoder.ReadMapSize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length maps not supported")
+				}
+				o.MapValue = make(map[string]int64, size)
+				for i0 := uint32(0); i0 < size; i0++ {
+					var k0 string
+					if k0, err = decoder.ReadString(); err != nil {
+						return err
+					}
+					var v0 int64
+					if v0, err = decoder.ReadInt64(); err != nil {
+						return err
+					}
+					o.MapValue[k0] = v0
+				}
+			}
+		case "nested":
+			if err := o.Nested.Decode(decoder); err != nil {
+				return err
+			}
+		case "nestedPtr":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.NestedPtr = nil
+			} else {
+				o.NestedPtr = new(Nested)
+				if err := o.NestedPtr.Decode(decoder); err != nil {
+					return err
+				}
+			}
+		case "nestedList":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.NestedList = nil
+			} else {
+				size, indef, err := decoder.ReadArraySize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length arrays not supported")
+				}
+				o.NestedList = make([]Nested, size)
+				for i0 := range o.NestedList {
+					if err := o.NestedList[i0].Decode(decoder); err != nil {
+						return err
+					}
+				}
+			}
+		case "nestedMap":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.NestedMap = nil
+			} else {
+				size, indef, err := decoder.ReadMapSize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length maps not supported")
+				}
+				o.NestedMap = make(map[string]*Nested, size)
+				for i0 := uint32(0); i0 < size; i0++ {
+					var k0 string
+					if k0, err = decoder.ReadString(); err != nil {
+						return err
+					}
+					var v0 *Nested
+					if isNil, err := decoder.IsNextNil(); err != nil {
+						return err
+					} else if isNil {
+						v0 = nil
+					} else {
+						v0 = new(Nested)
+						if err := v0.Decode(decoder); err != nil {
+							return err
+						}
+					}
+					o.NestedMap[k0] = v0
+				}
+			}
+		case "optional":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.Optional = nil
+			} else {
+				o.Optional = new(string)
+				if *o.Optional, err = decoder.ReadString(); err != nil {
+					return err
+				}
+			}
+		case "other":
+			if o.Renamed, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case "omitted":
+			if o.Omitted, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case "point":
+			if err := o.Point.Decode(decoder); err != nil {
+				return err
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Encode writes Nested to encoder.
+func (o *Nested) Encode(encoder cbor.Writer) error {
+	if o == nil {
+		encoder.WriteNil()
+		return encoder.CheckError()
+	}
+	encoder.WriteMapSize(3)
+	encoder.WriteString("foo")
+	encoder.WriteString(o.Foo)
+	encoder.WriteString("other")
+	encoder.WriteString(o.Other)
+	encoder.WriteString("array")
+	if o.Array == nil {
+		encoder.WriteNil()
+	} else {
+		encoder.WriteArraySize(uint32(len(o.Array)))
+		for i0 := range o.Array {
+			encoder.WriteInt64(o.Array[i0])
+		}
+	}
+	return encoder.CheckError()
+}
+
+// Decode reads Nested from decoder.
+func (o *Nested) Decode(decoder *cbor.Decoder) error {
+	numFields, indef, err := decoder.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if indef {
+		return cbor.NewReadError("Nested: indefinite length maps not supported")
+	}
+	for ; numFields > 0; numFields-- {
+		field, err := decoder.ReadString()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case "foo":
+			if o.Foo, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case "other":
+			if o.Other, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case "array":
+			if isNil, err := decoder.IsNextNil(); err != nil {
+				return err
+			} else if isNil {
+				o.Array = nil
+			} else {
+				size, indef, err := decoder.ReadArraySize()
+				if err != nil {
+					return err
+				}
+				if indef {
+					return cbor.NewReadError("indefinite length arrays not supported")
+				}
+				o.Array = make([]int64, size)
+				for i0 := range o.Array {
+					if o.Array[i0], err = decoder.ReadInt64(); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Encode writes Point to encoder.
+func (o *Point) Encode(encoder cbor.Writer) error {
+	if o == nil {
+		encoder.WriteNil()
+		return encoder.CheckError()
+	}
+	encoder.WriteArraySize(2)
+	encoder.WriteInt32(o.X)
+	encoder.WriteInt32(o.Y)
+	return encoder.CheckError()
+}
+
+// Decode reads Point from decoder.
+func (o *Point) Decode(decoder *cbor.Decoder) error {
+	fields, err := decoder.ReadArrayFields()
+	if err != nil {
+		return err
+	}
+	if ok, err := fields.Next(); err != nil {
+		return err
+	} else if ok {
+		if o.X, err = decoder.ReadInt32(); err != nil {
+			return err
+		}
+	}
+	if ok, err := fields.Next(); err != nil {
+		return err
+	} else if ok {
+		if o.Y, err = decoder.ReadInt32(); err != nil {
+			return err
+		}
+	}
+	return fields.Finish()
+}
+
+var cborgenCompactFields = cbor.NewFieldTable(
+	cbor.IntKey(1),
+	cbor.IntKey(-2),
+	cbor.TextKey("label"),
+)
+
+// Encode writes Compact to encoder.
+func (o *Compact) Encode(encoder cbor.Writer) error {
+	if o == nil {
+		encoder.WriteNil()
+		return encoder.CheckError()
+	}
+	numFields := uint32(2)
+	if o.Count != 0 {
+		numFields++
+	}
+	encoder.WriteMapSize(numFields)
+	encoder.WriteInt64(1)
+	encoder.WriteString(o.Name)
+	if o.Count != 0 {
+		encoder.WriteInt64(-2)
+		encoder.WriteInt64(o.Count)
+	}
+	encoder.WriteString("label")
+	encoder.WriteString(o.Label)
+	return encoder.CheckError()
+}
+
+// Decode reads Compact from decoder.
+func (o *Compact) Decode(decoder *cbor.Decoder) error {
+	numFields, indef, err := decoder.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if indef {
+		return cbor.NewReadError("Compact: indefinite length maps not supported")
+	}
+	for ; numFields > 0; numFields-- {
+		field, err := cborgenCompactFields.ReadKey(decoder)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 0: // 1
+			if o.Name, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		case 1: // -2
+			if o.Count, err = decoder.ReadInt64(); err != nil {
+				return err
+			}
+		case 2: // "label"
+			if o.Label, err = decoder.ReadString(); err != nil {
+				return err
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
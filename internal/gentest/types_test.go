@@ -0,0 +1,167 @@
+package gentest
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+func encode(t *testing.T, codec cbor.Codec) []byte {
+	data, err := cbor.ToBytes(codec)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	optional := "optional"
+	expected := Everything{
+		BoolValue:   true,
+		U8Value:     1,
+		U16Value:    300,
+		U32Value:    70000,
+		U64Value:    1 << 40,
+		UintValue:   42,
+		S8Value:     -1,
+		S16Value:    -300,
+		S32Value:    -70000,
+		S64Value:    -(1 << 40),
+		IntValue:    -42,
+		F32Value:    1.5,
+		F64Value:    -2.25,
+		StringValue: "test",
+		BytesValue:  []byte("bytes"),
+		Digest:      [4]byte{1, 2, 3, 4},
+		Color:       7,
+		Tags:        Tags{"a", "b"},
+		ArrayValue:  []int64{1, 2, 3},
+		Matrix:      [][]float64{{1, 2}, nil, {}},
+		MapValue:    map[string]int64{"key": 1234},
+		Nested:      Nested{Foo: "foo", Array: []int64{1}},
+		NestedPtr:   &Nested{Other: "other"},
+		NestedList:  []Nested{{Foo: "a"}, {Foo: "b"}},
+		NestedMap:   map[string]*Nested{"x": {Foo: "x"}, "nil": nil},
+		Optional:    &optional,
+		Renamed:     "renamed",
+		Ignored:     "ignored",
+		Point:       Point{X: 1, Y: -1},
+	}
+
+	data := encode(t, &expected)
+	var actual Everything
+	decoder := cbor.NewDecoder(data)
+	require.NoError(t, actual.Decode(&decoder))
+	expected.Ignored = ""
+	assert.Equal(t, expected, actual)
+
+	// the renamed key is used and empty fields are omitted
+	decoder = cbor.NewDecoder(data)
+	size, _, err := decoder.ReadMapSize()
+	require.NoError(t, err)
+	keys := map[string]bool{}
+	for ; size > 0; size-- {
+		key, err := decoder.ReadString()
+		require.NoError(t, err)
+		keys[key] = true
+		require.NoError(t, decoder.Skip())
+	}
+	assert.True(t, keys["other"])
+	assert.False(t, keys["omitted"])
+	assert.False(t, keys["ignored"])
+
+	assert.Equal(t, []byte{0x82, 0x01, 0x20}, encode(t, &Point{X: 1, Y: -1}))
+}
+
+func TestSkipUnknownFields(t *testing.T) {
+	var sizer cbor.Sizer
+	writeNested := func(w cbor.Writer) {
+		w.WriteMapSize(3)
+		w.WriteString("unknown")
+		w.WriteMapSize(1)
+		w.WriteString("deep")
+		w.WriteArraySize(2)
+		w.WriteBool(true)
+		w.WriteNil()
+		w.WriteString("foo")
+		w.WriteString("bar")
+		w.WriteString("other")
+		w.WriteFloat64(1.5)
+	}
+	writeNested(&sizer)
+	buffer := make([]byte, sizer.Len())
+	encoder := cbor.NewEncoder(buffer)
+	writeNested(&encoder)
+	require.NoError(t, encoder.CheckError())
+
+	var actual Nested
+	decoder := cbor.NewDecoder(buffer)
+	// "other" holds a float where a string is expected
+	assert.Error(t, actual.Decode(&decoder))
+	assert.Equal(t, "bar", actual.Foo)
+
+	// {"unknown": [[_ 1], (_ "x")], "foo": "bar"}
+	actual = Nested{}
+	data := []byte{0xa2, 0x67, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x82, 0x9f, 0x01, 0xff, 0x7f, 0x61, 'x', 0xff,
+		0x63, 'f', 'o', 'o', 0x63, 'b', 'a', 'r'}
+	decoder = cbor.NewDecoder(data)
+	require.NoError(t, actual.Decode(&decoder))
+	assert.Equal(t, Nested{Foo: "bar"}, actual)
+	assert.True(t, decoder.Done())
+}
+
+func TestIntKeys(t *testing.T) {
+	expected := Compact{Name: "name", Label: "label"}
+	data := encode(t, &expected)
+	assert.Equal(t, []byte{0xa2, 0x01, 0x64, 'n', 'a', 'm', 'e', 0x65, 'l', 'a', 'b', 'e', 'l', 0x65, 'l', 'a', 'b', 'e', 'l'}, data)
+
+	expected.Count = 3
+	data = encode(t, &expected)
+	var actual Compact
+	decoder := cbor.NewDecoder(data)
+	require.NoError(t, actual.Decode(&decoder))
+	assert.Equal(t, expected, actual)
+}
+
+func TestIntRange(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		// {"intValue": 2^32}
+		{"int", []byte{0xa1, 0x68, 'i', 'n', 't', 'V', 'a', 'l', 'u', 'e', 0x1b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		// {"intValue": -2^32 - 1}
+		{"negative int", []byte{0xa1, 0x68, 'i', 'n', 't', 'V', 'a', 'l', 'u', 'e', 0x3b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		// {"uintValue": 2^32}
+		{"uint", []byte{0xa1, 0x69, 'u', 'i', 'n', 't', 'V', 'a', 'l', 'u', 'e', 0x1b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual Everything
+			decoder := cbor.NewDecoder(tc.data)
+			err := actual.Decode(&decoder)
+			if strconv.IntSize == 32 {
+				assert.ErrorIs(t, err, cbor.ErrRange)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestArrayVersioning(t *testing.T) {
+	for _, tc := range []struct {
+		data     []byte
+		expected Point
+	}{
+		{[]byte{0x81, 0x05}, Point{X: 5}},
+		{[]byte{0x83, 0x05, 0x06, 0x63, 'n', 'e', 'w'}, Point{X: 5, Y: 6}},
+		{[]byte{0x83, 0x05, 0x06, 0x9f, 0x01, 0xff}, Point{X: 5, Y: 6}},
+	} {
+		var actual Point
+		decoder := cbor.NewDecoder(tc.data)
+		require.NoError(t, actual.Decode(&decoder))
+		assert.Equal(t, tc.expected, actual)
+		assert.Equal(t, uint32(len(tc.data)), decoder.Pos())
+	}
+}
@@ -0,0 +1,551 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NonFiniteMode selects how ToJSON writes NaN and infinities, which JSON
+// cannot represent.
+type NonFiniteMode uint8
+
+const (
+	NonFiniteNull   NonFiniteMode = iota // write null, as RFC 8949 §6.1 suggests
+	NonFiniteString                      // write the strings "NaN", "Infinity" and "-Infinity"
+	NonFiniteError                       // fail the conversion
+)
+
+// ToJSONOptions configures ToJSON. The zero value follows RFC 8949 §6.1.
+type ToJSONOptions struct {
+	NonFinite NonFiniteMode
+}
+
+// ErrNonFinite is returned by ToJSON for NaN or infinite floats when the
+// NonFinite option is NonFiniteError.
+var ErrNonFinite = ReadError{"non-finite float cannot be converted to JSON"}
+
+// byte string encodings of RFC 8949 §6.1, selected by tags 21 to 23
+type jsonByteEncoding uint8
+
+const (
+	jsonBase64URL jsonByteEncoding = iota
+	jsonBase64
+	jsonBase16
+)
+
+// ToJSON converts the CBOR data item in buf to JSON, following RFC 8949
+// §6.1:
+//
+//   - byte strings become base64url strings without padding, or base64 or
+//     base16 strings inside tags 22 and 23
+//   - bignums (tags 2 and 3) become base64url strings, prefixed with "~"
+//     for negative bignums; other tags are dropped, keeping their content
+//   - map keys that are not text strings are converted to JSON and the
+//     result is used as the key string
+//   - undefined and simple values other than false, true and null become
+//     null
+//
+// The item is streamed to w as it is decoded.
+func ToJSON(buf []byte, w io.Writer, opts ToJSONOptions) error {
+	d := NewDecoder(buf)
+	bw := bufio.NewWriter(w)
+	j := jsonWriter{d: &d, w: bw, opts: opts}
+	if err := j.item(jsonBase64URL); err != nil {
+		return err
+	}
+	if !d.Done() {
+		return ErrTrailingData
+	}
+	return bw.Flush()
+}
+
+type jsonWriter struct {
+	d       *Decoder
+	w       *bufio.Writer
+	opts    ToJSONOptions
+	scratch []byte
+	depth   nesting
+}
+
+// item converts the next item. enc is the encoding for byte strings in
+// force from an enclosing tag.
+func (j *jsonWriter) item(enc jsonByteEncoding) error {
+	head, err := j.d.PeekType()
+	if err != nil {
+		return err
+	}
+	switch head.Major {
+	case TypeMajorUnsigned:
+		if err := j.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+			return err
+		}
+		_, err = j.w.WriteString(strconv.FormatUint(head.Arg, 10))
+		return err
+	case TypeMajorSigned:
+		if err := j.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+			return err
+		}
+		if head.Arg == math.MaxUint64 {
+			_, err = j.w.WriteString("-18446744073709551616")
+			return err
+		}
+		_, err = j.w.WriteString("-" + strconv.FormatUint(head.Arg+1, 10))
+		return err
+	case TypeMajorBytes:
+		b, err := j.d.readChunked(TypeMajorBytes)
+		if err != nil {
+			return err
+		}
+		return j.bytes(b, enc, "")
+	case TypeMajorText:
+		s, err := j.d.readChunked(TypeMajorText)
+		if err != nil {
+			return err
+		}
+		return j.str(s)
+	case TypeMajorArray, TypeMajorMap, TypeMajorTagged:
+		if err := j.depth.enter(); err != nil {
+			return err
+		}
+		switch head.Major {
+		case TypeMajorArray:
+			err = j.array(enc)
+		case TypeMajorMap:
+			err = j.object(enc)
+		default:
+			err = j.tagged(enc)
+		}
+		j.depth.leave()
+		return err
+	}
+	switch head.Simple {
+	case SimpleFloat16, SimpleFloat32, SimpleFloat64:
+		f, err := j.d.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		return j.float(f, head.Simple)
+	case SimpleBreak:
+		return ReadError{"unexpected break"}
+	}
+	if err := j.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return err
+	}
+	switch {
+	case head.Arg == TypeBoolFalse&0x1f:
+		_, err = j.w.WriteString("false")
+	case head.Arg == TypeBoolTrue&0x1f:
+		_, err = j.w.WriteString("true")
+	default:
+		_, err = j.w.WriteString("null")
+	}
+	return err
+}
+
+func (j *jsonWriter) array(enc jsonByteEncoding) error {
+	size, indef, err := j.d.ReadArraySize()
+	if err != nil {
+		return err
+	}
+	if err := j.w.WriteByte('['); err != nil {
+		return err
+	}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if end, err := j.d.atBreak(); err != nil {
+				return err
+			} else if end {
+				break
+			}
+		}
+		if i > 0 {
+			if err := j.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if err := j.item(enc); err != nil {
+			return err
+		}
+	}
+	return j.w.WriteByte(']')
+}
+
+func (j *jsonWriter) object(enc jsonByteEncoding) error {
+	size, indef, err := j.d.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if err := j.w.WriteByte('{'); err != nil {
+		return err
+	}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if end, err := j.d.atBreak(); err != nil {
+				return err
+			} else if end {
+				break
+			}
+		}
+		if i > 0 {
+			if err := j.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if err := j.key(enc); err != nil {
+			return err
+		}
+		if err := j.w.WriteByte(':'); err != nil {
+			return err
+		}
+		if err := j.item(enc); err != nil {
+			return err
+		}
+	}
+	return j.w.WriteByte('}')
+}
+
+// key writes a map key. Keys that do not convert to a JSON string are
+// converted into a scratch buffer and written as a string.
+func (j *jsonWriter) key(enc jsonByteEncoding) error {
+	major, _, err := j.d.peekMajor()
+	if err != nil {
+		return err
+	}
+	if major == TypeMajorText || major == TypeMajorBytes {
+		return j.item(enc)
+	}
+	var scratch bytes.Buffer
+	inner := jsonWriter{d: j.d, w: bufio.NewWriter(&scratch), opts: j.opts, depth: j.depth}
+	if err := inner.item(enc); err != nil {
+		return err
+	}
+	if err := inner.w.Flush(); err != nil {
+		return err
+	}
+	if scratch.Len() > 0 && scratch.Bytes()[0] == '"' {
+		_, err = j.w.Write(scratch.Bytes())
+		return err
+	}
+	return j.str(scratch.Bytes())
+}
+
+func (j *jsonWriter) tagged(enc jsonByteEncoding) error {
+	tag, err := j.d.ReadTag()
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case 21:
+		return j.item(jsonBase64URL)
+	case 22:
+		return j.item(jsonBase64)
+	case 23:
+		return j.item(jsonBase16)
+	case 2, 3:
+		major, _, err := j.d.peekMajor()
+		if err != nil {
+			return err
+		}
+		if major != TypeMajorBytes {
+			break
+		}
+		b, err := j.d.readChunked(TypeMajorBytes)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if tag == 3 {
+			prefix = "~"
+		}
+		return j.bytes(b, jsonBase64URL, prefix)
+	}
+	return j.item(enc)
+}
+
+func (j *jsonWriter) bytes(b []byte, enc jsonByteEncoding, prefix string) error {
+	var s string
+	switch enc {
+	case jsonBase64:
+		s = base64.StdEncoding.EncodeToString(b)
+	case jsonBase16:
+		s = hex.EncodeToString(b)
+	default:
+		s = base64.RawURLEncoding.EncodeToString(b)
+	}
+	_, err := j.w.WriteString(`"` + prefix + s + `"`)
+	return err
+}
+
+func (j *jsonWriter) float(f float64, kind SimpleKind) error {
+	var err error
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		switch j.opts.NonFinite {
+		case NonFiniteString:
+			s := `"NaN"`
+			if math.IsInf(f, 1) {
+				s = `"Infinity"`
+			} else if math.IsInf(f, -1) {
+				s = `"-Infinity"`
+			}
+			_, err = j.w.WriteString(s)
+		case NonFiniteError:
+			err = ErrNonFinite
+		default:
+			_, err = j.w.WriteString("null")
+		}
+	case kind == SimpleFloat64:
+		_, err = j.w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	default:
+		// shortest form that reads back as the same single or half
+		// precision value
+		_, err = j.w.WriteString(strconv.FormatFloat(f, 'g', -1, 32))
+	}
+	return err
+}
+
+// str writes s as a JSON string.
+func (j *jsonWriter) str(s []byte) error {
+	j.scratch = appendQuoted(j.scratch[:0], s)
+	_, err := j.w.Write(j.scratch)
+	return err
+}
+
+// appendQuoted appends s to dst as a JSON string. Invalid UTF-8 is replaced
+// by U+FFFD.
+func appendQuoted(dst, s []byte) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	for len(s) > 0 {
+		c := s[0]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			s = s[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(s)
+		var enc [utf8.UTFMax]byte
+		n := utf8.EncodeRune(enc[:], r)
+		dst = append(dst, enc[:n]...)
+		s = s[size:]
+	}
+	return append(dst, '"')
+}
+
+// readChunked reads a byte or text string of the given major type. An
+// indefinite length string is returned as the concatenation of its chunks;
+// a definite length one aliases the input buffer.
+func (d *Decoder) readChunked(major uint8) ([]byte, error) {
+	head, err := d.PeekType()
+	if err != nil {
+		return nil, err
+	}
+	if head.Major != major {
+		return nil, ReadError{"expected string"}
+	}
+	if err := d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return nil, err
+	}
+	if !head.Indefinite {
+		if head.Arg >= 0xffffffff {
+			return nil, ReadError{"string too long"}
+		}
+		return d.reader.GetBytes(uint32(head.Arg))
+	}
+	var out []byte
+	for {
+		if end, err := d.atBreak(); err != nil {
+			return nil, err
+		} else if end {
+			return out, nil
+		}
+		head, err := d.PeekType()
+		if err != nil {
+			return nil, err
+		}
+		if head.Major != major || head.Indefinite {
+			return nil, ReadError{"invalid chunk in indefinite length string"}
+		}
+		chunk, err := d.readChunked(major)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+}
+
+// FromJSONOptions configures FromJSON.
+type FromJSONOptions struct {
+	// BigNums encodes integers that fit neither an int64 nor a uint64 as
+	// bignums (tags 2 and 3). Otherwise they are encoded as floats, losing
+	// precision.
+	BigNums bool
+}
+
+// jsonToken is a JSON value, or the start of an array or object, together
+// with its number of items.
+type jsonToken struct {
+	token json.Token
+	count uint32
+}
+
+// JSONValue is a JSON text parsed by ParseJSON. It can be written several
+// times, typically to a Sizer and then to an Encoder.
+type JSONValue struct {
+	tokens []jsonToken
+	opts   FromJSONOptions
+}
+
+// ParseJSON reads a single JSON value from r.
+func ParseJSON(r io.Reader, opts FromJSONOptions) (JSONValue, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var tokens []jsonToken
+	// indices of the open arrays and objects
+	var open []int
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return JSONValue{}, err
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == ']' || delim == '}') {
+			open = open[:len(open)-1]
+		} else {
+			if len(open) > 0 {
+				tokens[open[len(open)-1]].count++
+			}
+			if ok {
+				open = append(open, len(tokens))
+			}
+			tokens = append(tokens, jsonToken{token: token})
+		}
+		if len(open) == 0 {
+			break
+		}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return JSONValue{}, ErrTrailingData
+	}
+	return JSONValue{tokens: tokens, opts: opts}, nil
+}
+
+// Write writes the value as CBOR. Integers use the smallest integer
+// encoding and other numbers the smallest float encoding that keeps their
+// value.
+func (v JSONValue) Write(w Writer) error {
+	for _, t := range v.tokens {
+		switch token := t.token.(type) {
+		case json.Delim:
+			if token == '[' {
+				w.WriteArraySize(t.count)
+			} else {
+				w.WriteMapSize(t.count / 2)
+			}
+		case string:
+			w.WriteString(token)
+		case bool:
+			w.WriteBool(token)
+		case nil:
+			w.WriteNil()
+		case json.Number:
+			if err := v.writeNumber(w, token); err != nil {
+				return err
+			}
+		}
+	}
+	return w.CheckError()
+}
+
+func (v JSONValue) writeNumber(w Writer, n json.Number) error {
+	s := string(n)
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			w.WriteInt64(i)
+			return nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			w.WriteUint64(u)
+			return nil
+		}
+		if v.opts.BigNums {
+			var b big.Int
+			if _, ok := b.SetString(s, 10); ok {
+				writeBigNum(w, &b)
+				return nil
+			}
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	w.WriteFloat(f)
+	return nil
+}
+
+// writeBigNum writes n as an unsigned (tag 2) or negative (tag 3) bignum.
+func writeBigNum(w Writer, n *big.Int) {
+	if n.Sign() < 0 {
+		// -1 - n
+		var m big.Int
+		m.Neg(n)
+		m.Sub(&m, big.NewInt(1))
+		w.WriteTag(3)
+		w.WriteByteArray(m.Bytes())
+		return
+	}
+	w.WriteTag(2)
+	w.WriteByteArray(n.Bytes())
+}
+
+// FromJSON converts a single JSON value read from r to CBOR, written to w.
+// The whole value is tokenized before it is written, as CBOR needs the
+// length of arrays and maps up front. To size the output exactly, use
+// ParseJSON and write the value to a Sizer first, or use FromJSONBytes.
+func FromJSON(r io.Reader, w Writer, opts FromJSONOptions) error {
+	v, err := ParseJSON(r, opts)
+	if err != nil {
+		return err
+	}
+	return v.Write(w)
+}
+
+// FromJSONBytes converts a JSON value to CBOR in an exactly sized buffer.
+func FromJSONBytes(data []byte, opts FromJSONOptions) ([]byte, error) {
+	v, err := ParseJSON(bytes.NewReader(data), opts)
+	if err != nil {
+		return nil, err
+	}
+	var sizer Sizer
+	if err := v.Write(&sizer); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, sizer.Len())
+	encoder := NewEncoder(buffer)
+	if err := v.Write(&encoder); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
@@ -0,0 +1,134 @@
+package cbor
+
+// ErrNotFound is returned by Lookup when a path element does not match.
+var ErrNotFound = ReadError{"path not found"}
+
+// PathElem is a step of a Lookup path: a map key or an array index.
+type PathElem struct {
+	key     FieldKey
+	index   uint32
+	isIndex bool
+}
+
+// PathKey returns a path element selecting the value of a text map key.
+func PathKey(key string) PathElem {
+	return PathElem{key: TextKey(key)}
+}
+
+// PathIntKey returns a path element selecting the value of an integer map
+// key.
+func PathIntKey(key int64) PathElem {
+	return PathElem{key: IntKey(key)}
+}
+
+// PathIndex returns a path element selecting an array item.
+func PathIndex(index uint32) PathElem {
+	return PathElem{index: index, isIndex: true}
+}
+
+// Lookup returns the encoded bytes of the item of buf found by following
+// path, without decoding anything else. Siblings along the way are jumped
+// over with Skip and tags in front of maps and arrays are ignored. The
+// result aliases buf.
+//
+//	contentType, err := cbor.Lookup(msg, cbor.PathKey("headers"), cbor.PathKey("content-type"))
+func Lookup(buf []byte, path ...PathElem) ([]byte, error) {
+	d := NewDecoder(buf)
+	if err := d.Lookup(path...); err != nil {
+		return nil, err
+	}
+	start := d.reader.byteOffset
+	if err := d.Skip(); err != nil {
+		return nil, err
+	}
+	return buf[start:d.reader.byteOffset], nil
+}
+
+// Lookup follows path from the next item and leaves the Decoder positioned
+// on the item found, ready to read it. Items after it are not meant to be
+// read: the Decoder is left inside the enclosing maps and arrays.
+func (d *Decoder) Lookup(path ...PathElem) error {
+	for _, elem := range path {
+		if err := d.skipTags(); err != nil {
+			return err
+		}
+		var err error
+		if elem.isIndex {
+			err = d.findIndex(elem.index)
+		} else {
+			err = d.findKey(elem.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) skipTags() error {
+	for {
+		head, err := d.PeekType()
+		if err != nil {
+			return err
+		}
+		if head.Major != TypeMajorTagged {
+			return nil
+		}
+		if err := d.reader.Discard(uint32(head.HeadLen)); err != nil {
+			return err
+		}
+	}
+}
+
+// position on the value of key in the map that follows
+func (d *Decoder) findKey(key FieldKey) error {
+	size, indef, err := d.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	keys := FieldTable{keys: []FieldKey{key}}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if end, err := d.atBreak(); err != nil {
+				return err
+			} else if end {
+				break
+			}
+		}
+		field, err := keys.ReadKey(d)
+		if err != nil {
+			return err
+		}
+		if field == 0 {
+			return nil
+		}
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
+	return ErrNotFound
+}
+
+// position on item index of the array that follows
+func (d *Decoder) findIndex(index uint32) error {
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if end, err := d.atBreak(); err != nil {
+				return err
+			} else if end {
+				break
+			}
+		}
+		if i == index {
+			return nil
+		}
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
+	return ErrNotFound
+}
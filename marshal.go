@@ -0,0 +1,764 @@
+//go:build !tinygo
+// +build !tinygo
+
+package cbor
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/wasmcloud/tinygo-cbor/internal/fieldtag"
+)
+
+// Marshal and Unmarshal use reflection, which TinyGo only partially
+// supports, so they are only built with the standard Go toolchain. Code that
+// must also run as a TinyGo component should use generated Codecs.
+
+// UnsupportedTypeError is returned by Marshal and Unmarshal for values of
+// types that cannot be represented.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "cbor: unsupported type: " + e.Type.String()
+}
+
+// StructTagError is returned by Marshal and Unmarshal for a struct field
+// whose `cbor` tag is invalid, such as a keyasint field without an integer
+// key.
+type StructTagError struct {
+	Type    reflect.Type
+	Field   string
+	Message string
+}
+
+func (e *StructTagError) Error() string {
+	return "cbor: " + e.Type.String() + "." + e.Field + ": " + e.Message
+}
+
+// Tag is a tagged data item, as produced by Unmarshal into an interface{}.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// Simple is a simple value other than false, true, null and undefined, as
+// produced by Unmarshal into an interface{}.
+type Simple uint8
+
+var (
+	encoderType    = reflect.TypeOf((*Encodable)(nil)).Elem()
+	decoderType    = reflect.TypeOf((*Decodable)(nil)).Elem()
+	typedArrayType = reflect.TypeOf(TypedArray{})
+	tagType        = reflect.TypeOf(Tag{})
+	simpleType     = reflect.TypeOf(Simple(0))
+)
+
+// Marshal returns the CBOR encoding of v.
+//
+// Structs are encoded as maps following the conventions of
+// tinygo-cbor-gen: exported fields are keyed by their name with the leading
+// upper-case run lowered, unless a `cbor:"key"` tag says otherwise, and the
+// omitempty, keyasint and toarray options are honored. Types implementing
+// Encodable encode themselves. Nil pointers, slices and maps are encoded as
+// null.
+func Marshal(v interface{}) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	var sizer Sizer
+	if err := encodeReflect(&sizer, value); err != nil {
+		return nil, err
+	}
+	if err := sizer.CheckError(); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, sizer.Len())
+	encoder := NewEncoder(buffer)
+	if err := encodeReflect(&encoder, value); err != nil {
+		return nil, err
+	}
+	if err := encoder.CheckError(); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func encodeReflect(w Writer, v reflect.Value) error {
+	if !v.IsValid() {
+		w.WriteNil()
+		return nil
+	}
+	t := v.Type()
+	switch t {
+	case typedArrayType:
+		w.WriteTypedArray(v.Interface().(TypedArray))
+		return nil
+	case simpleType:
+		w.WriteSimple(uint8(v.Uint()))
+		return nil
+	}
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface {
+		if t.Implements(encoderType) {
+			return v.Interface().(Encodable).Encode(w)
+		}
+		if reflect.PtrTo(t).Implements(encoderType) {
+			if !v.CanAddr() {
+				p := reflect.New(t)
+				p.Elem().Set(v)
+				v = p.Elem()
+			}
+			return v.Addr().Interface().(Encodable).Encode(w)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		w.WriteBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.WriteInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.WriteUint64(v.Uint())
+	case reflect.Float32:
+		w.WriteFloat32(float32(v.Float()))
+	case reflect.Float64:
+		w.WriteFloat64(v.Float())
+	case reflect.String:
+		w.WriteString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.WriteNil()
+			return nil
+		}
+		return encodeReflect(w, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.WriteNil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			w.WriteByteArray(v.Bytes())
+			return nil
+		}
+		return encodeReflectArray(w, v)
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			w.WriteByteArray(b)
+			return nil
+		}
+		return encodeReflectArray(w, v)
+	case reflect.Map:
+		if v.IsNil() {
+			w.WriteNil()
+			return nil
+		}
+		return encodeReflectMap(w, v)
+	case reflect.Struct:
+		if t == tagType {
+			tag := v.Interface().(Tag)
+			w.WriteTag(tag.Number)
+			return encodeReflect(w, reflect.ValueOf(tag.Content))
+		}
+		return encodeReflectStruct(w, v)
+	default:
+		return &UnsupportedTypeError{Type: t}
+	}
+	return nil
+}
+
+func encodeReflectArray(w Writer, v reflect.Value) error {
+	w.WriteArraySize(uint32(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := encodeReflect(w, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeReflectMap(w Writer, v reflect.Value) error {
+	keys := v.MapKeys()
+	// sorted, so that the encoding is the same on every run
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+	w.WriteMapSize(uint32(len(keys)))
+	for _, key := range keys {
+		if err := encodeReflect(w, key); err != nil {
+			return err
+		}
+		if err := encodeReflect(w, v.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lessKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	if a.Kind() != b.Kind() {
+		return a.Kind() < b.Kind()
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return false
+}
+
+func encodeReflectStruct(w Writer, v reflect.Value) error {
+	info, err := structInfoOf(v.Type())
+	if err != nil {
+		return err
+	}
+	if info.toArray {
+		w.WriteArraySize(uint32(len(info.fields)))
+		for _, f := range info.fields {
+			if err := encodeReflect(w, v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var count uint32
+	for _, f := range info.fields {
+		if !f.omitEmpty || !isEmptyValue(v.Field(f.index)) {
+			count++
+		}
+	}
+	w.WriteMapSize(count)
+	for i, f := range info.fields {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		info.table.WriteKey(w, i)
+		if err := encodeReflect(w, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+type structField struct {
+	index     int
+	omitEmpty bool
+}
+
+type structInfo struct {
+	fields  []structField
+	table   FieldTable
+	toArray bool
+}
+
+var structInfoCache sync.Map // map[reflect.Type]*structInfo
+
+func structInfoOf(t reflect.Type) (*structInfo, error) {
+	if info, ok := structInfoCache.Load(t); ok {
+		return info.(*structInfo), nil
+	}
+	info := &structInfo{}
+	var keys []FieldKey
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := fieldtag.Parse(sf.Tag.Get("cbor"))
+		if sf.Name == "_" {
+			if tag.ToArray {
+				info.toArray = true
+			}
+			continue
+		}
+		if tag.Skip() || sf.PkgPath != "" {
+			continue
+		}
+		text, num, err := tag.Key(sf.Name)
+		if err != nil {
+			return nil, &StructTagError{Type: t, Field: sf.Name, Message: err.Error()}
+		}
+		fieldKey := TextKey(text)
+		if tag.KeyAsInt {
+			fieldKey = IntKey(num)
+		}
+		info.fields = append(info.fields, structField{index: i, omitEmpty: tag.OmitEmpty})
+		keys = append(keys, fieldKey)
+	}
+	info.table = NewFieldTable(keys...)
+	actual, _ := structInfoCache.LoadOrStore(t, info)
+	return actual.(*structInfo), nil
+}
+
+// Unmarshal decodes the CBOR item in data into the value pointed to by v,
+// following the same conventions as Marshal. Tags are ignored unless v
+// holds a Tag, a TypedArray or an interface{}, in which case items decode
+// to bool, uint64, int64, float64, string, []byte, []interface{},
+// map[interface{}]interface{}, Tag, Simple or nil. Bytes after the item
+// result in ErrTrailingData, and arrays, maps and tags nested deeper than
+// DefaultMaxDepth in ErrTooDeep.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ReadError{"cbor: Unmarshal requires a non-nil pointer"}
+	}
+	decoder := NewDecoder(data)
+	if err := decodeReflect(&decoder, rv.Elem(), 0); err != nil {
+		return err
+	}
+	if !decoder.Done() {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+func decodeReflect(d *Decoder, v reflect.Value, depth nesting) error {
+	t := v.Type()
+	switch t {
+	case typedArrayType:
+		a, err := d.ReadTypedArray()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(a))
+		return nil
+	case simpleType:
+		n, err := d.ReadSimple()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+		return nil
+	}
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() != 0 {
+			if v.IsNil() {
+				return &UnsupportedTypeError{Type: t}
+			}
+			// decode into the value already held
+			elem := reflect.New(v.Elem().Type())
+			elem.Elem().Set(v.Elem())
+			if err := decodeReflect(d, elem.Elem(), depth); err != nil {
+				return err
+			}
+			v.Set(elem.Elem())
+			return nil
+		}
+		item, err := decodeAny(d, depth)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(item))
+		}
+		return nil
+	}
+	if t == tagType {
+		item, err := decodeAny(d, depth)
+		if err != nil {
+			return err
+		}
+		tag, ok := item.(Tag)
+		if !ok {
+			return ReadError{"cbor: expected tag"}
+		}
+		v.Set(reflect.ValueOf(tag))
+		return nil
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(decoderType) {
+		return v.Addr().Interface().(Decodable).Decode(d)
+	}
+
+	// tags are transparent to concrete types
+	for {
+		major, _, err := d.peekMajor()
+		if err != nil {
+			return err
+		}
+		if major != TypeMajorTagged {
+			break
+		}
+		if _, err := d.ReadTag(); err != nil {
+			return err
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		major, prefix, err := d.peekMajor()
+		if err != nil {
+			return err
+		}
+		if (major == TypeMajorUnsigned || major == TypeMajorSigned) && InfoOf(prefix) == 27 {
+			// reject values beyond the int64 range rather than wrapping
+			if _, err := d.reader.GetUint8(); err != nil {
+				return err
+			}
+			n, err := d.reader.GetUint64()
+			if err != nil {
+				return err
+			}
+			if n > 1<<63-1 {
+				return ReadError{"cbor: integer overflows " + t.String()}
+			}
+			if major == TypeMajorSigned {
+				return setInt(v, -1-int64(n))
+			}
+			return setInt(v, int64(n))
+		}
+		n, err := d.ReadInt64()
+		if err != nil {
+			return err
+		}
+		return setInt(v, n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := d.ReadUint64()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return ReadError{"cbor: integer overflows " + t.String()}
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := d.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := d.ReadString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Ptr:
+		if isNil, err := d.IsNextNil(); err != nil {
+			return err
+		} else if isNil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeReflect(d, v.Elem(), depth)
+	case reflect.Slice:
+		if isNil, err := d.IsNextNil(); err != nil {
+			return err
+		} else if isNil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := d.ReadByteArrayCopy()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		return decodeReflectSlice(d, v, depth)
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := d.ReadByteArray()
+			if err != nil {
+				return err
+			}
+			if len(b) != v.Len() {
+				return ReadError{"cbor: byte array length mismatch for " + t.String()}
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		if err := depth.enter(); err != nil {
+			return err
+		}
+		size, indef, err := d.ReadArraySize()
+		if err != nil {
+			return err
+		}
+		if indef || int(size) != v.Len() {
+			return ReadError{"cbor: array length mismatch for " + t.String()}
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := decodeReflect(d, v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if isNil, err := d.IsNextNil(); err != nil {
+			return err
+		} else if isNil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return decodeReflectMap(d, v, depth)
+	case reflect.Struct:
+		return decodeReflectStruct(d, v, depth)
+	default:
+		return &UnsupportedTypeError{Type: t}
+	}
+	return nil
+}
+
+func setInt(v reflect.Value, n int64) error {
+	if v.OverflowInt(n) {
+		return ReadError{"cbor: integer overflows " + v.Type().String()}
+	}
+	v.SetInt(n)
+	return nil
+}
+
+func decodeReflectSlice(d *Decoder, v reflect.Value, depth nesting) error {
+	if err := depth.enter(); err != nil {
+		return err
+	}
+	size, indef, err := d.ReadArraySize()
+	if err != nil {
+		return err
+	}
+	t := v.Type()
+	if !indef {
+		if size > d.Remaining() {
+			// every item takes at least a byte
+			return ErrRange
+		}
+		v.Set(reflect.MakeSlice(t, int(size), int(size)))
+		for i := 0; i < int(size); i++ {
+			if err := decodeReflect(d, v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	v.Set(reflect.MakeSlice(t, 0, 0))
+	for {
+		if done, err := d.atBreak(); err != nil || done {
+			return err
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := decodeReflect(d, elem, depth); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+	}
+}
+
+func decodeReflectMap(d *Decoder, v reflect.Value, depth nesting) error {
+	if err := depth.enter(); err != nil {
+		return err
+	}
+	size, indef, err := d.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	if !indef && size > d.Remaining() {
+		return ErrRange
+	}
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, int(size)))
+	}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if done, err := d.atBreak(); err != nil || done {
+				return err
+			}
+		}
+		key := reflect.New(t.Key()).Elem()
+		if err := decodeReflect(d, key, depth); err != nil {
+			return err
+		}
+		if !key.Type().Comparable() || (key.Kind() == reflect.Interface && !key.IsNil() && !key.Elem().Type().Comparable()) {
+			return ReadError{"cbor: map key is not comparable"}
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := decodeReflect(d, elem, depth); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+func decodeReflectStruct(d *Decoder, v reflect.Value, depth nesting) error {
+	if err := depth.enter(); err != nil {
+		return err
+	}
+	info, err := structInfoOf(v.Type())
+	if err != nil {
+		return err
+	}
+	if info.toArray {
+		fields, err := d.ReadArrayFields()
+		if err != nil {
+			return err
+		}
+		for _, f := range info.fields {
+			if ok, err := fields.Next(); err != nil {
+				return err
+			} else if !ok {
+				break
+			}
+			if err := decodeReflect(d, v.Field(f.index), depth); err != nil {
+				return err
+			}
+		}
+		return fields.Finish()
+	}
+	size, indef, err := d.ReadMapSize()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); indef || i < size; i++ {
+		if indef {
+			if done, err := d.atBreak(); err != nil || done {
+				return err
+			}
+		}
+		field, err := info.table.ReadKey(d)
+		if err != nil {
+			return err
+		}
+		if field < 0 {
+			err = d.Skip()
+		} else {
+			err = decodeReflect(d, v.Field(info.fields[field].index), depth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAny decodes the next item into its generic Go representation.
+func decodeAny(d *Decoder, depth nesting) (interface{}, error) {
+	major, prefix, err := d.peekMajor()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case TypeMajorUnsigned:
+		return d.ReadUint64()
+	case TypeMajorSigned:
+		if InfoOf(prefix) == 27 {
+			if _, err := d.reader.GetUint8(); err != nil {
+				return nil, err
+			}
+			n, err := d.reader.GetUint64()
+			if err != nil {
+				return nil, err
+			}
+			if n > 1<<63-1 {
+				return nil, ReadError{"cbor: negative integer overflows int64"}
+			}
+			return -1 - int64(n), nil
+		}
+		return d.ReadInt64()
+	case TypeMajorBytes:
+		return d.ReadByteArrayCopy()
+	case TypeMajorText:
+		return d.ReadString()
+	case TypeMajorArray:
+		if err := depth.enter(); err != nil {
+			return nil, err
+		}
+		size, indef, err := d.ReadArraySize()
+		if err != nil {
+			return nil, err
+		}
+		if !indef && size > d.Remaining() {
+			return nil, ErrRange
+		}
+		items := make([]interface{}, 0, size)
+		for i := uint32(0); indef || i < size; i++ {
+			if indef {
+				if done, err := d.atBreak(); err != nil {
+					return nil, err
+				} else if done {
+					break
+				}
+			}
+			item, err := decodeAny(d, depth)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case TypeMajorMap:
+		var m map[interface{}]interface{}
+		v := reflect.ValueOf(&m).Elem()
+		if err := decodeReflectMap(d, v, depth); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case TypeMajorTagged:
+		if err := depth.enter(); err != nil {
+			return nil, err
+		}
+		number, err := d.ReadTag()
+		if err != nil {
+			return nil, err
+		}
+		content, err := decodeAny(d, depth)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: number, Content: content}, nil
+	default:
+		switch prefix {
+		case TypeBoolFalse, TypeBoolTrue:
+			return d.ReadBool()
+		case TypeNull, TypeUndefined:
+			return nil, d.reader.Discard(1)
+		case TypeF16, TypeF32, TypeF64:
+			return d.ReadFloat64()
+		}
+		n, err := d.ReadSimple()
+		if err != nil {
+			return nil, err
+		}
+		return Simple(n), nil
+	}
+}
@@ -0,0 +1,177 @@
+//go:build !tinygo
+// +build !tinygo
+
+package cbor_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbor "github.com/wasmcloud/tinygo-cbor"
+)
+
+type marshalPoint struct {
+	_ struct{} `cbor:",toarray"`
+	X int32
+	Y int32
+}
+
+type marshalAll struct {
+	BoolValue   bool
+	U8Value     uint8
+	S64Value    int64
+	F32Value    float32
+	StringValue string
+	BytesValue  []byte
+	Digest      [2]byte
+	ArrayValue  []int64
+	MapValue    map[string]int64
+	Nested      *marshalPoint
+	Points      []marshalPoint
+	Renamed     string `cbor:"other"`
+	Omitted     string `cbor:",omitempty"`
+	Ignored     string `cbor:"-"`
+	Compact     int    `cbor:"1,keyasint"`
+	Any         interface{}
+	Required    *Required
+	unexported  int
+}
+
+// sizingFails writes an invalid simple value while being sized only.
+type sizingFails struct{}
+
+func (sizingFails) Encode(w cbor.Writer) error {
+	if _, ok := w.(*cbor.Sizer); ok {
+		w.WriteSimple(24)
+	} else {
+		w.WriteNil()
+	}
+	return nil
+}
+
+func TestMarshalSizerError(t *testing.T) {
+	_, err := cbor.Marshal(sizingFails{})
+	assert.ErrorIs(t, err, cbor.ErrInvalidSimple)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	expected := marshalAll{
+		BoolValue:   true,
+		U8Value:     math.MaxUint8,
+		S64Value:    math.MinInt64,
+		F32Value:    1.5,
+		StringValue: "test",
+		BytesValue:  []byte("bytes"),
+		Digest:      [2]byte{1, 2},
+		ArrayValue:  []int64{1, 2, 3},
+		MapValue:    map[string]int64{"b": 2, "a": 1},
+		Nested:      &marshalPoint{X: 1, Y: -1},
+		Points:      []marshalPoint{{X: 2}},
+		Renamed:     "renamed",
+		Compact:     7,
+		Any:         []interface{}{uint64(1), int64(-1), "x", map[interface{}]interface{}{"k": true}},
+		Required:    &Required{StringValue: "required", BytesValue: []byte("b"), ArrayValue: []int64{}, MapValue: map[string]int64{}},
+	}
+	data, err := cbor.Marshal(&expected)
+	require.NoError(t, err)
+
+	var actual marshalAll
+	require.NoError(t, cbor.Unmarshal(data, &actual))
+	assert.Equal(t, expected, actual)
+
+	var generic map[interface{}]interface{}
+	require.NoError(t, cbor.Unmarshal(data, &generic))
+	assert.Equal(t, "renamed", generic["other"])
+	assert.Equal(t, uint64(7), generic[uint64(1)])
+	assert.Equal(t, []interface{}{uint64(1), int64(-1)}, generic["nested"])
+	assert.NotContains(t, generic, "omitted")
+	assert.NotContains(t, generic, "ignored")
+}
+
+func TestMarshalMatchesWriter(t *testing.T) {
+	data, err := cbor.Marshal(map[string]interface{}{
+		"b": []int{1, -1},
+		"a": nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xa2, 0x61, 'a', 0xf6, 0x61, 'b', 0x82, 0x01, 0x20}, data)
+}
+
+func TestUnmarshalUnknownFields(t *testing.T) {
+	var actual struct {
+		B int `cbor:"b"`
+	}
+	// {"a": [[_ 1], 1], "b": 1}
+	require.NoError(t, cbor.Unmarshal([]byte{0xa2, 0x61, 'a', 0x82, 0x9f, 0x01, 0xff, 0x01, 0x61, 'b', 0x01}, &actual))
+	assert.Equal(t, 1, actual.B)
+	// {_ "a": (_ "x"), "b": 2}
+	require.NoError(t, cbor.Unmarshal([]byte{0xbf, 0x61, 'a', 0x7f, 0x61, 'x', 0xff, 0x61, 'b', 0x02, 0xff}, &actual))
+	assert.Equal(t, 2, actual.B)
+}
+
+func TestUnmarshalDepth(t *testing.T) {
+	nested := func(depth int, head byte) []byte {
+		data := bytes.Repeat([]byte{head}, depth)
+		return append(data, 0x01)
+	}
+	var item interface{}
+	require.NoError(t, cbor.Unmarshal(nested(cbor.DefaultMaxDepth, 0x81), &item))
+	for _, head := range []byte{0x81, 0xc1} {
+		assert.ErrorIs(t, cbor.Unmarshal(nested(cbor.DefaultMaxDepth+1, head), &item), cbor.ErrTooDeep)
+		assert.ErrorIs(t, cbor.Unmarshal(nested(5000000, head), &item), cbor.ErrTooDeep)
+	}
+
+	type list struct {
+		Next *list `cbor:"n"`
+	}
+	var l list
+	deep := bytes.Repeat([]byte{0xa1, 0x61, 'n'}, cbor.DefaultMaxDepth)
+	require.NoError(t, cbor.Unmarshal(append(deep, 0xf6), &l))
+	deep = append(deep, 0xa1, 0x61, 'n', 0xf6)
+	assert.ErrorIs(t, cbor.Unmarshal(deep, &l), cbor.ErrTooDeep)
+	var slices [][][]int
+	require.NoError(t, cbor.Unmarshal(nested(3, 0x81), &slices))
+	assert.Equal(t, [][][]int{{{1}}}, slices)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var small int8
+	assert.Error(t, cbor.Unmarshal([]byte{0x19, 0x01, 0x00}, &small))
+	var s string
+	assert.Error(t, cbor.Unmarshal([]byte{0x61, 'a', 0x00}, &s), "trailing data")
+	assert.Error(t, cbor.Unmarshal([]byte{0x61, 'a'}, s), "not a pointer")
+	_, err := cbor.Marshal(make(chan int))
+	assert.Error(t, err)
+
+	type badKey struct {
+		F int `cbor:"f,keyasint"`
+	}
+	_, err = cbor.Marshal(badKey{})
+	var tagErr *cbor.StructTagError
+	require.ErrorAs(t, err, &tagErr)
+	assert.Equal(t, "F", tagErr.Field)
+	assert.EqualError(t, cbor.Unmarshal([]byte{0xa0}, &badKey{}), "cbor: cbor_test.badKey.F: keyasint requires an integer key, not \"f\"")
+
+	// declared lengths beyond the input fail before anything is allocated
+	for _, tc := range []struct {
+		data   []byte
+		target interface{}
+	}{
+		{[]byte{0x9b, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xfe}, new(interface{})},
+		{[]byte{0xbb, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xfe}, new(interface{})},
+		{[]byte{0x9a, 0xff, 0xff, 0xff, 0xfe, 0x01}, new([]int)},
+		{[]byte{0xba, 0xff, 0xff, 0xff, 0xfe, 0x01}, new(map[int]int)},
+	} {
+		assert.ErrorIs(t, cbor.Unmarshal(tc.data, tc.target), cbor.ErrRange, "%x", tc.data)
+	}
+
+	// tags are transparent to concrete types
+	require.NoError(t, cbor.Unmarshal([]byte{0xd9, 0xd9, 0xf7, 0x61, 'a'}, &s))
+	assert.Equal(t, "a", s)
+	var tag interface{}
+	require.NoError(t, cbor.Unmarshal([]byte{0xc1, 0x01}, &tag))
+	assert.Equal(t, cbor.Tag{Number: 1, Content: uint64(1)}, tag)
+}
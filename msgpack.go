@@ -0,0 +1,646 @@
+package cbor
+
+import (
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// TagMsgPackExt wraps a MessagePack extension type that has no CBOR
+// equivalent. Its content is an array of the extension type, as an
+// integer, and the extension data, as a byte string. The number is not
+// registered with IANA; it is only meant to carry extension types through
+// FromMsgPack and back through ToMsgPack.
+const TagMsgPackExt = 0x6d736770 // "msgp"
+
+// extension type of the MessagePack timestamp
+const msgpackTimestamp = -1
+
+// FromMsgPack transcodes the MessagePack object in data to CBOR, written to
+// w. Every MessagePack format is supported:
+//
+//   - integers, floats, strings, binary, arrays and maps map to the
+//     corresponding CBOR items, floats keeping their precision; strings
+//     must be valid UTF-8, as CBOR text strings are
+//   - timestamps (extension type -1) without a nanosecond part map to
+//     epoch-based date/time (tag 1) with an integer
+//   - other extension types, and timestamps with nanoseconds, map to
+//     TagMsgPackExt
+func FromMsgPack(data []byte, w Writer) error {
+	r := NewDataReader(data)
+	if err := fromMsgPack(&r, w, 0); err != nil {
+		return err
+	}
+	if r.Remaining() != 0 {
+		return ErrTrailingData
+	}
+	return w.CheckError()
+}
+
+// FromMsgPackBytes transcodes a MessagePack object to CBOR in an exactly
+// sized buffer.
+func FromMsgPackBytes(data []byte) ([]byte, error) {
+	var sizer Sizer
+	if err := FromMsgPack(data, &sizer); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, sizer.Len())
+	encoder := NewEncoder(buffer)
+	if err := FromMsgPack(data, &encoder); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func fromMsgPack(r *DataReader, w Writer, depth nesting) error {
+	b, err := r.GetUint8()
+	if err != nil {
+		return err
+	}
+	switch {
+	case b <= 0x7f:
+		w.WriteUint8(b)
+		return nil
+	case b >= 0xe0:
+		w.WriteInt8(int8(b))
+		return nil
+	case b <= 0x8f:
+		return fromMsgPackMap(r, w, uint32(b&0x0f), depth)
+	case b <= 0x9f:
+		return fromMsgPackArray(r, w, uint32(b&0x0f), depth)
+	case b <= 0xbf:
+		return fromMsgPackString(r, w, uint32(b&0x1f))
+	}
+	switch b {
+	case 0xc0:
+		w.WriteNil()
+	case 0xc2:
+		w.WriteBool(false)
+	case 0xc3:
+		w.WriteBool(true)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := msgpackLength(r, b-0xc4)
+		if err != nil {
+			return err
+		}
+		data, err := r.GetBytes(n)
+		if err != nil {
+			return err
+		}
+		w.WriteByteArray(data)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := msgpackLength(r, b-0xc7)
+		if err != nil {
+			return err
+		}
+		return fromMsgPackExt(r, w, n)
+	case 0xca:
+		f, err := r.GetFloat32()
+		if err != nil {
+			return err
+		}
+		w.WriteFloat32(f)
+	case 0xcb:
+		f, err := r.GetFloat64()
+		if err != nil {
+			return err
+		}
+		w.WriteFloat64(f)
+	case 0xcc:
+		n, err := r.GetUint8()
+		if err != nil {
+			return err
+		}
+		w.WriteUint8(n)
+	case 0xcd:
+		n, err := r.GetUint16()
+		if err != nil {
+			return err
+		}
+		w.WriteUint16(n)
+	case 0xce:
+		n, err := r.GetUint32()
+		if err != nil {
+			return err
+		}
+		w.WriteUint32(n)
+	case 0xcf:
+		n, err := r.GetUint64()
+		if err != nil {
+			return err
+		}
+		w.WriteUint64(n)
+	case 0xd0:
+		n, err := r.GetInt8()
+		if err != nil {
+			return err
+		}
+		w.WriteInt8(n)
+	case 0xd1:
+		n, err := r.GetInt16()
+		if err != nil {
+			return err
+		}
+		w.WriteInt16(n)
+	case 0xd2:
+		n, err := r.GetInt32()
+		if err != nil {
+			return err
+		}
+		w.WriteInt32(n)
+	case 0xd3:
+		n, err := r.GetInt64()
+		if err != nil {
+			return err
+		}
+		w.WriteInt64(n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return fromMsgPackExt(r, w, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := msgpackLength(r, b-0xd9)
+		if err != nil {
+			return err
+		}
+		return fromMsgPackString(r, w, n)
+	case 0xdc, 0xdd:
+		n, err := msgpackLength(r, b-0xdc+1)
+		if err != nil {
+			return err
+		}
+		return fromMsgPackArray(r, w, n, depth)
+	case 0xde, 0xdf:
+		n, err := msgpackLength(r, b-0xde+1)
+		if err != nil {
+			return err
+		}
+		return fromMsgPackMap(r, w, n, depth)
+	default:
+		return ReadError{"invalid MessagePack format 0x" + strconv.FormatUint(uint64(b), 16)}
+	}
+	return nil
+}
+
+// msgpackLength reads a length of 1, 2 or 4 bytes, for size 0, 1 or 2.
+func msgpackLength(r *DataReader, size uint8) (uint32, error) {
+	switch size {
+	case 0:
+		n, err := r.GetUint8()
+		return uint32(n), err
+	case 1:
+		n, err := r.GetUint16()
+		return uint32(n), err
+	default:
+		return r.GetUint32()
+	}
+}
+
+func fromMsgPackString(r *DataReader, w Writer, n uint32) error {
+	data, err := r.GetBytes(n)
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(data) {
+		return ReadError{"invalid UTF-8 in MessagePack string"}
+	}
+	w.WriteString(UnsafeString(data))
+	return nil
+}
+
+func fromMsgPackArray(r *DataReader, w Writer, n uint32, depth nesting) error {
+	if err := depth.enter(); err != nil {
+		return err
+	}
+	w.WriteArraySize(n)
+	for i := uint32(0); i < n; i++ {
+		if err := fromMsgPack(r, w, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fromMsgPackMap(r *DataReader, w Writer, n uint32, depth nesting) error {
+	if err := depth.enter(); err != nil {
+		return err
+	}
+	w.WriteMapSize(n)
+	for i := uint32(0); i < n; i++ {
+		if err := fromMsgPack(r, w, depth); err != nil {
+			return err
+		}
+		if err := fromMsgPack(r, w, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fromMsgPackExt(r *DataReader, w Writer, n uint32) error {
+	typ, err := r.GetInt8()
+	if err != nil {
+		return err
+	}
+	data, err := r.GetBytes(n)
+	if err != nil {
+		return err
+	}
+	if typ == msgpackTimestamp {
+		dr := NewDataReader(data)
+		switch n {
+		case 4:
+			sec, _ := dr.GetUint32()
+			w.WriteTag(1)
+			w.WriteUint32(sec)
+			return nil
+		case 8:
+			v, _ := dr.GetUint64()
+			if v>>34 == 0 {
+				w.WriteTag(1)
+				w.WriteUint64(v)
+				return nil
+			}
+		case 12:
+			nsec, _ := dr.GetUint32()
+			sec, _ := dr.GetInt64()
+			if nsec == 0 {
+				w.WriteTag(1)
+				w.WriteInt64(sec)
+				return nil
+			}
+		}
+	}
+	w.WriteTag(TagMsgPackExt)
+	w.WriteArraySize(2)
+	w.WriteInt8(typ)
+	w.WriteByteArray(data)
+	return nil
+}
+
+// ToMsgPack transcodes the CBOR data item in buf to MessagePack. It is the
+// reverse of FromMsgPack:
+//
+//   - TagMsgPackExt becomes the extension type it wraps
+//   - epoch-based date/time (tag 1) becomes a timestamp, with nanoseconds
+//     for floats
+//   - other tags are dropped, keeping their content
+//   - half precision floats become single precision floats
+//   - undefined and simple values other than false, true and null become
+//     nil
+//
+// Negative integers below the int64 range cannot be represented and fail
+// the conversion.
+func ToMsgPack(buf []byte) ([]byte, error) {
+	d := NewDecoder(buf)
+	m := msgpackWriter{d: &d, out: make([]byte, 0, len(buf))}
+	if err := m.item(); err != nil {
+		return nil, err
+	}
+	if !d.Done() {
+		return nil, ErrTrailingData
+	}
+	return m.out, nil
+}
+
+type msgpackWriter struct {
+	d     *Decoder
+	out   []byte
+	depth nesting
+	// the lengths of the indefinite length arrays and maps ahead, in the
+	// order of their heads
+	counts []uint64
+}
+
+func (m *msgpackWriter) item() error {
+	head, err := m.d.PeekType()
+	if err != nil {
+		return err
+	}
+	switch head.Major {
+	case TypeMajorUnsigned:
+		m.uint(head.Arg)
+		return m.d.reader.Discard(uint32(head.HeadLen))
+	case TypeMajorSigned:
+		if head.Arg > math.MaxInt64 {
+			return ReadError{"negative integer out of MessagePack range"}
+		}
+		m.int(-1 - int64(head.Arg))
+		return m.d.reader.Discard(uint32(head.HeadLen))
+	case TypeMajorBytes:
+		data, err := m.d.readChunked(TypeMajorBytes)
+		if err != nil {
+			return err
+		}
+		m.head(uint32(len(data)), 0, 0, 0xc4, 0xc5, 0xc6)
+		m.out = append(m.out, data...)
+		return nil
+	case TypeMajorText:
+		data, err := m.d.readChunked(TypeMajorText)
+		if err != nil {
+			return err
+		}
+		m.head(uint32(len(data)), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		m.out = append(m.out, data...)
+		return nil
+	case TypeMajorArray, TypeMajorMap, TypeMajorTagged:
+		if err := m.depth.enter(); err != nil {
+			return err
+		}
+		if head.Major == TypeMajorTagged {
+			err = m.tagged()
+		} else {
+			err = m.container(head)
+		}
+		m.depth.leave()
+		return err
+	}
+	switch head.Simple {
+	case SimpleFloat16, SimpleFloat32:
+		f, err := m.d.ReadFloat32()
+		if err != nil {
+			return err
+		}
+		m.out = append(m.out, 0xca)
+		m.be(uint64(math.Float32bits(f)), 4)
+		return nil
+	case SimpleFloat64:
+		f, err := m.d.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		m.out = append(m.out, 0xcb)
+		m.be(math.Float64bits(f), 8)
+		return nil
+	case SimpleBreak:
+		return ReadError{"unexpected break"}
+	}
+	switch head.Arg {
+	case TypeBoolFalse & 0x1f:
+		m.out = append(m.out, 0xc2)
+	case TypeBoolTrue & 0x1f:
+		m.out = append(m.out, 0xc3)
+	default:
+		m.out = append(m.out, 0xc0)
+	}
+	return m.d.reader.Discard(uint32(head.HeadLen))
+}
+
+func (m *msgpackWriter) container(head ItemType) error {
+	n := head.Arg
+	if head.Indefinite {
+		if len(m.counts) == 0 {
+			// count this container and those nested in it, on a copy
+			// of the decoder, in a single pass
+			probe := *m.d
+			var err error
+			if m.counts, err = probe.countIndefinite(); err != nil {
+				return err
+			}
+		}
+		n, m.counts = m.counts[0], m.counts[1:]
+	}
+	if n >= 0xffffffff {
+		return ReadError{"container too large"}
+	}
+	if err := m.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return err
+	}
+	items := n
+	if head.Major == TypeMajorMap {
+		m.head(uint32(n), 0x80, 15, 0, 0xde, 0xdf)
+		items *= 2
+	} else {
+		m.head(uint32(n), 0x90, 15, 0, 0xdc, 0xdd)
+	}
+	for i := uint64(0); i < items; i++ {
+		if err := m.item(); err != nil {
+			return err
+		}
+	}
+	if head.Indefinite {
+		return m.d.reader.Discard(1)
+	}
+	return nil
+}
+
+// countFrame is an array, map or tag being walked by countIndefinite.
+type countFrame struct {
+	left       uint64
+	indefinite bool
+	isMap      bool
+	slot       int // index in the counts, for indefinite lengths
+}
+
+// countIndefinite walks the indefinite length array or map that follows
+// and returns its length and those of the indefinite length arrays and
+// maps nested in it, in the order of their heads. Map lengths are counted
+// in entries.
+func (d *Decoder) countIndefinite() ([]uint64, error) {
+	var counts []uint64
+	frames := []countFrame{{left: 1}}
+	for len(frames) > 0 {
+		top := &frames[len(frames)-1]
+		if !top.indefinite && top.left == 0 {
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		head, err := d.PeekType()
+		if err != nil {
+			return nil, err
+		}
+		if head.Simple == SimpleBreak {
+			if !top.indefinite {
+				return nil, ReadError{"unexpected break"}
+			}
+			if top.isMap {
+				counts[top.slot] /= 2
+			}
+			if err := d.reader.Discard(1); err != nil {
+				return nil, err
+			}
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		if top.indefinite {
+			counts[top.slot]++
+		} else {
+			top.left--
+		}
+		switch head.Major {
+		case TypeMajorArray, TypeMajorMap, TypeMajorTagged:
+		default:
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := d.reader.Discard(uint32(head.HeadLen)); err != nil {
+			return nil, err
+		}
+		if !head.Indefinite && head.Major != TypeMajorTagged && head.Arg > uint64(d.reader.Remaining()) {
+			return nil, ErrRange
+		}
+		frame := countFrame{left: head.Arg, isMap: head.Major == TypeMajorMap}
+		switch {
+		case head.Major == TypeMajorTagged:
+			frame.left = 1
+		case head.Indefinite:
+			frame.indefinite = true
+			frame.slot = len(counts)
+			counts = append(counts, 0)
+		case frame.isMap:
+			frame.left *= 2
+		}
+		frames = append(frames, frame)
+	}
+	return counts, nil
+}
+
+func (m *msgpackWriter) tagged() error {
+	tag, err := m.d.ReadTag()
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case TagMsgPackExt:
+		size, indef, err := m.d.ReadArraySize()
+		if err != nil {
+			return err
+		}
+		if size != 2 || indef {
+			return ReadError{"expected MessagePack extension array"}
+		}
+		typ, err := m.d.ReadInt8()
+		if err != nil {
+			return err
+		}
+		data, err := m.d.ReadBytesNoCopy()
+		if err != nil {
+			return err
+		}
+		m.ext(typ, data)
+		return nil
+	case 1:
+		head, err := m.d.PeekType()
+		if err != nil {
+			return err
+		}
+		switch {
+		case head.Major == TypeMajorUnsigned && head.Arg <= math.MaxInt64:
+			m.timestamp(int64(head.Arg), 0)
+			return m.d.reader.Discard(uint32(head.HeadLen))
+		case head.Major == TypeMajorSigned && head.Arg <= math.MaxInt64:
+			m.timestamp(-1-int64(head.Arg), 0)
+			return m.d.reader.Discard(uint32(head.HeadLen))
+		case head.IsFloat():
+			f, err := m.d.ReadFloat64()
+			if err != nil {
+				return err
+			}
+			sec := math.Floor(f)
+			if math.IsNaN(f) || math.IsInf(f, 0) || sec < math.MinInt64 || sec >= math.MaxInt64 {
+				return ReadError{"date/time out of MessagePack timestamp range"}
+			}
+			nsec := math.Round((f - sec) * 1e9)
+			if nsec >= 1e9 {
+				sec++
+				nsec = 0
+			}
+			m.timestamp(int64(sec), uint32(nsec))
+			return nil
+		}
+	}
+	return m.item()
+}
+
+func (m *msgpackWriter) timestamp(sec int64, nsec uint32) {
+	var data [12]byte
+	w := NewDataReader(data[:])
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		_ = w.SetUint32(uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		_ = w.SetUint64(uint64(nsec)<<34 | uint64(sec))
+	default:
+		_ = w.SetUint32(nsec)
+		_ = w.SetInt64(sec)
+	}
+	m.ext(msgpackTimestamp, data[:w.byteOffset])
+}
+
+func (m *msgpackWriter) ext(typ int8, data []byte) {
+	switch len(data) {
+	case 1, 2, 4, 8, 16:
+		fix := uint8(0xd4)
+		for n := len(data); n > 1; n >>= 1 {
+			fix++
+		}
+		m.out = append(m.out, fix)
+	default:
+		m.head(uint32(len(data)), 0, 0, 0xc7, 0xc8, 0xc9)
+	}
+	m.out = append(m.out, uint8(typ))
+	m.out = append(m.out, data...)
+}
+
+func (m *msgpackWriter) uint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		m.out = append(m.out, uint8(n))
+	case n <= 0xff:
+		m.out = append(m.out, 0xcc, uint8(n))
+	case n <= 0xffff:
+		m.out = append(m.out, 0xcd)
+		m.be(n, 2)
+	case n <= 0xffffffff:
+		m.out = append(m.out, 0xce)
+		m.be(n, 4)
+	default:
+		m.out = append(m.out, 0xcf)
+		m.be(n, 8)
+	}
+}
+
+func (m *msgpackWriter) int(n int64) {
+	switch {
+	case n >= 0:
+		m.uint(uint64(n))
+	case n >= -32:
+		m.out = append(m.out, uint8(n))
+	case n >= math.MinInt8:
+		m.out = append(m.out, 0xd0, uint8(n))
+	case n >= math.MinInt16:
+		m.out = append(m.out, 0xd1)
+		m.be(uint64(n), 2)
+	case n >= math.MinInt32:
+		m.out = append(m.out, 0xd2)
+		m.be(uint64(n), 4)
+	default:
+		m.out = append(m.out, 0xd3)
+		m.be(uint64(n), 8)
+	}
+}
+
+// head writes a length in the smallest format: fix|n if n <= fixMax, then
+// the 8, 16 and 32 bit formats. A zero format byte means that the type has
+// no such format.
+func (m *msgpackWriter) head(n uint32, fix uint8, fixMax uint32, f8, f16, f32 uint8) {
+	switch {
+	case fix != 0 && n <= fixMax:
+		m.out = append(m.out, fix|uint8(n))
+	case f8 != 0 && n <= 0xff:
+		m.out = append(m.out, f8, uint8(n))
+	case n <= 0xffff:
+		m.out = append(m.out, f16)
+		m.be(uint64(n), 2)
+	default:
+		m.out = append(m.out, f32)
+		m.be(uint64(n), 4)
+	}
+}
+
+// be appends the low size bytes of v in big endian order.
+func (m *msgpackWriter) be(v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		m.out = append(m.out, uint8(v>>(8*i)))
+	}
+}
@@ -0,0 +1,80 @@
+package cbor
+
+// EncoderOption configures an Encoder or a Sizer. Pass the same options to
+// both so that the size computed by the Sizer matches the encoded output.
+type EncoderOption func(*encoderOptions)
+
+type encoderOptions struct {
+	selfDescribe  bool
+	deterministic bool
+}
+
+func newEncoderOptions(opts []EncoderOption) encoderOptions {
+	var o encoderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// SelfDescribe prefixes the output with the self-described CBOR tag
+// (55799), which encodes as the magic bytes 0xd9d9f7.
+func SelfDescribe() EncoderOption {
+	return func(o *encoderOptions) {
+		o.selfDescribe = true
+	}
+}
+
+// Deterministic makes WriteFloat32 and WriteFloat64 use the shortest
+// precision that keeps the value, like WriteFloat. Integers and lengths are
+// always written in their shortest form, so the output then follows the
+// core deterministic encoding of RFC 8949 §4.2.1 as long as maps are
+// written with their keys sorted by their encoding. Canonical re-encodes
+// data that does not.
+func Deterministic() EncoderOption {
+	return func(o *encoderOptions) {
+		o.deterministic = true
+	}
+}
+
+// DecoderOption configures a Decoder.
+type DecoderOption func(*decoderOptions)
+
+type decoderOptions struct {
+	stripSelfDescribe bool
+}
+
+func newDecoderOptions(opts []DecoderOption) decoderOptions {
+	var o decoderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// StripSelfDescribe makes the Decoder skip the self-described CBOR prefix
+// (0xd9d9f7) if the buffer starts with it. Buffers without the prefix are
+// decoded unchanged.
+func StripSelfDescribe() DecoderOption {
+	return func(o *decoderOptions) {
+		o.stripSelfDescribe = true
+	}
+}
+
+// IsSelfDescribed reports whether buf starts with the self-described CBOR
+// prefix 0xd9d9f7.
+func IsSelfDescribed(buf []byte) bool {
+	return len(buf) >= len(selfDescribedPrefix) &&
+		buf[0] == selfDescribedPrefix[0] &&
+		buf[1] == selfDescribedPrefix[1] &&
+		buf[2] == selfDescribedPrefix[2]
+}
+
+// StripSelfDescribed returns buf without its self-described CBOR prefix.
+// If buf does not start with the prefix it is returned unchanged.
+func StripSelfDescribed(buf []byte) []byte {
+	if IsSelfDescribed(buf) {
+		return buf[len(selfDescribedPrefix):]
+	}
+	return buf
+}
@@ -0,0 +1,193 @@
+package cbor
+
+// SetAt returns a copy of buf in which the item at path is replaced by the
+// item written by value. If the last element of path is a map key that is
+// not present, the entry is appended to the map; if it is the index one
+// past the end of an array, the item is appended to the array. Only the
+// head of the enclosing map or array is rewritten, and only when its
+// length changes: everything else is copied byte for byte. value is called
+// twice, once to size the item and once to encode it, so it must write the
+// same item both times.
+//
+//	patched, err := cbor.SetAt(msg, []cbor.PathElem{cbor.PathKey("headers"), cbor.PathKey("trace-id")},
+//		func(w cbor.Writer) { w.WriteString(traceID) })
+func SetAt(buf []byte, path []PathElem, value func(w Writer)) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, ReadError{"empty patch path"}
+	}
+	s, err := locate(buf, path)
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	if s.found {
+		s.start = s.valueStart
+		s.write = value
+	} else {
+		s.start = s.end
+		s.size++
+		s.resize = true
+		if last.isIndex {
+			if last.index != s.size-1 {
+				return nil, ErrNotFound
+			}
+			s.write = value
+		} else {
+			s.write = func(w Writer) {
+				last.key.Write(w)
+				value(w)
+			}
+		}
+	}
+	return s.apply(buf)
+}
+
+// DeleteAt returns a copy of buf without the map entry or array item at
+// path. Like SetAt, it only rewrites the head of the enclosing map or
+// array.
+func DeleteAt(buf []byte, path ...PathElem) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, ReadError{"empty patch path"}
+	}
+	s, err := locate(buf, path)
+	if err != nil {
+		return nil, err
+	}
+	if !s.found {
+		return nil, ErrNotFound
+	}
+	s.size--
+	s.resize = true
+	return s.apply(buf)
+}
+
+// splice describes an edit of a single map or array: the output is
+// buf[:headStart], the head (rewritten if resize is set), buf[headEnd:start],
+// the items written by write and buf[end:].
+type splice struct {
+	headStart, headEnd uint32
+	isMap              bool
+	indef              bool
+	size               uint32
+	resize             bool
+	start, end         uint32
+	write              func(w Writer)
+
+	// set by locate: whether the last path element exists, the offsets of
+	// its whole entry and of its value
+	found      bool
+	valueStart uint32
+}
+
+// locate finds the container of the last element of path. On return, if
+// the element is found, start and end delimit its entry (key and value for
+// a map) and valueStart its value. Otherwise start and end are both the
+// offset at which a new entry is inserted.
+func locate(buf []byte, path []PathElem) (splice, error) {
+	d := NewDecoder(buf)
+	if err := d.Lookup(path[:len(path)-1]...); err != nil {
+		return splice{}, err
+	}
+	if err := d.skipTags(); err != nil {
+		return splice{}, err
+	}
+	last := path[len(path)-1]
+	s := splice{headStart: d.reader.byteOffset, isMap: !last.isIndex}
+	var err error
+	if s.isMap {
+		s.size, s.indef, err = d.ReadMapSize()
+	} else {
+		s.size, s.indef, err = d.ReadArraySize()
+	}
+	if err != nil {
+		return splice{}, err
+	}
+	s.headEnd = d.reader.byteOffset
+	keys := FieldTable{keys: []FieldKey{last.key}}
+	for i := uint32(0); s.indef || i < s.size; i++ {
+		s.start = d.reader.byteOffset
+		if s.indef {
+			if end, err := d.atBreak(); err != nil {
+				return splice{}, err
+			} else if end {
+				// counted so that resizing an indefinite container is a no-op
+				s.size = i
+				break
+			}
+		}
+		match := false
+		if s.isMap {
+			field, err := keys.ReadKey(&d)
+			if err != nil {
+				return splice{}, err
+			}
+			match = field == 0
+		} else {
+			match = i == last.index
+		}
+		s.valueStart = d.reader.byteOffset
+		if err := d.Skip(); err != nil {
+			return splice{}, err
+		}
+		if match {
+			s.found = true
+			s.end = d.reader.byteOffset
+			return s, nil
+		}
+	}
+	if !s.indef {
+		s.start = d.reader.byteOffset
+	}
+	s.end = s.start
+	return s, nil
+}
+
+func (s *splice) writeHead(w Writer, buf []byte) {
+	switch {
+	case s.indef || !s.resize:
+		w.(rawWriter).writeRaw(buf[s.headStart:s.headEnd])
+	case s.isMap:
+		w.WriteMapSize(s.size)
+	default:
+		w.WriteArraySize(s.size)
+	}
+}
+
+func (s *splice) apply(buf []byte) ([]byte, error) {
+	var sizer Sizer
+	s.writeHead(&sizer, buf)
+	if s.write != nil {
+		s.write(&sizer)
+	}
+	if err := sizer.CheckError(); err != nil {
+		return nil, err
+	}
+	length := uint32(len(buf)) - (s.headEnd - s.headStart) - (s.end - s.start) + sizer.Len()
+	out := make([]byte, length)
+	encoder := NewEncoder(out)
+	encoder.writeRaw(buf[:s.headStart])
+	s.writeHead(&encoder, buf)
+	encoder.writeRaw(buf[s.headEnd:s.start])
+	if s.write != nil {
+		s.write(&encoder)
+	}
+	encoder.writeRaw(buf[s.end:])
+	if err := encoder.CheckError(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// rawWriter is implemented by Encoder and Sizer to copy encoded bytes
+// through unchanged.
+type rawWriter interface {
+	writeRaw(b []byte)
+}
+
+func (e *Encoder) writeRaw(b []byte) {
+	_ = e.reader.SetBytes(b)
+}
+
+func (s *Sizer) writeRaw(b []byte) {
+	s.length += uint32(len(b))
+}
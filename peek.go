@@ -0,0 +1,123 @@
+package cbor
+
+import "encoding/binary"
+
+// SimpleKind distinguishes the items of major type 7.
+type SimpleKind uint8
+
+const (
+	SimpleNone    SimpleKind = iota // not major type 7
+	SimpleValue                     // simple value, including false, true, null and undefined
+	SimpleFloat16                   // half-precision float
+	SimpleFloat32                   // single-precision float
+	SimpleFloat64                   // double-precision float
+	SimpleBreak                     // break stop code of an indefinite length item
+)
+
+// ItemType describes the head of the next data item, as returned by
+// Decoder.PeekType.
+type ItemType struct {
+	// Major is the major type, TypeMajorUnsigned to TypeMajorSimple.
+	Major uint8
+	// Simple tells floats, simple values and breaks apart in major type 7.
+	Simple SimpleKind
+	// Arg is the argument of the head: the value of an integer (-1-Arg for
+	// negative integers), the length of a string, array or map, a tag
+	// number, a simple value or the bits of a float.
+	Arg uint64
+	// Indefinite is set for strings, arrays and maps of indefinite length.
+	Indefinite bool
+	// HeadLen is the number of bytes of the head, including the argument.
+	HeadLen uint8
+}
+
+// IsNull reports whether the item is null.
+func (t ItemType) IsNull() bool {
+	return t.Simple == SimpleValue && t.Arg == TypeNull&0x1f
+}
+
+// IsUndefined reports whether the item is undefined.
+func (t ItemType) IsUndefined() bool {
+	return t.Simple == SimpleValue && t.Arg == TypeUndefined&0x1f
+}
+
+// IsBool reports whether the item is false or true.
+func (t ItemType) IsBool() bool {
+	return t.Simple == SimpleValue && (t.Arg == TypeBoolFalse&0x1f || t.Arg == TypeBoolTrue&0x1f)
+}
+
+// IsFloat reports whether the item is a float of any precision.
+func (t ItemType) IsFloat() bool {
+	return t.Simple >= SimpleFloat16 && t.Simple <= SimpleFloat64
+}
+
+// IsInteger reports whether the item is an unsigned or negative integer.
+func (t ItemType) IsInteger() bool {
+	return t.Major == TypeMajorUnsigned || t.Major == TypeMajorSigned
+}
+
+// PeekType returns the type of the next item without consuming it.
+func (d *Decoder) PeekType() (ItemType, error) {
+	if _, err := d.reader.PeekUint8(); err != nil {
+		return ItemType{}, err
+	}
+	return parseHead(d.reader.buffer[d.reader.byteOffset:])
+}
+
+// parseHead decodes the head at the start of buf.
+func parseHead(buf []byte) (ItemType, error) {
+	if len(buf) == 0 {
+		return ItemType{}, ErrRange
+	}
+	initial := buf[0]
+	t := ItemType{Major: TypeOf(initial), HeadLen: 1}
+	info := InfoOf(initial)
+	switch {
+	case info < 24:
+		t.Arg = uint64(info)
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(buf) < 1+n {
+			return ItemType{}, ErrRange
+		}
+		switch n {
+		case 1:
+			t.Arg = uint64(buf[1])
+		case 2:
+			t.Arg = uint64(binary.BigEndian.Uint16(buf[1:]))
+		case 4:
+			t.Arg = uint64(binary.BigEndian.Uint32(buf[1:]))
+		default:
+			t.Arg = binary.BigEndian.Uint64(buf[1:])
+		}
+		t.HeadLen += uint8(n)
+	case info == 31:
+		switch t.Major {
+		case TypeMajorBytes, TypeMajorText, TypeMajorArray, TypeMajorMap:
+			t.Indefinite = true
+		case TypeMajorSimple:
+			t.Simple = SimpleBreak
+			return t, nil
+		default:
+			return ItemType{}, ReadError{"indefinite length not allowed for major type"}
+		}
+	default:
+		return ItemType{}, ReadError{"reserved additional information"}
+	}
+	if t.Major == TypeMajorSimple {
+		switch info {
+		case 25:
+			t.Simple = SimpleFloat16
+		case 26:
+			t.Simple = SimpleFloat32
+		case 27:
+			t.Simple = SimpleFloat64
+		default:
+			if info == 24 && t.Arg < 32 {
+				return ItemType{}, ErrInvalidSimple
+			}
+			t.Simple = SimpleValue
+		}
+	}
+	return t, nil
+}
@@ -2,15 +2,38 @@ package cbor
 
 type Sizer struct {
 	length uint32
+	opts   encoderOptions
+	// first error that an Encoder would record for the same writes
+	err error
 }
 
-func NewSizer() Sizer {
-	return Sizer{}
+func NewSizer(opts ...EncoderOption) Sizer {
+	s := Sizer{
+		opts: newEncoderOptions(opts),
+	}
+	s.Reset()
+	return s
+}
+
+// Reset sets the length back to zero, or to the length of the prefix if
+// the Sizer was created with SelfDescribe.
+func (s *Sizer) Reset() {
+	s.length = 0
+	s.err = nil
+	if s.opts.selfDescribe {
+		s.length = uint32(len(selfDescribedPrefix))
+	}
 }
 
 // check whether any errors have occurred
 func (s *Sizer) CheckError() error {
-	return nil
+	return s.err
+}
+
+func (s *Sizer) updateError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
 }
 
 func (s *Sizer) Len() uint32 {
@@ -21,8 +44,22 @@ func (s *Sizer) WriteNil() {
 	s.length++
 }
 
+func (s *Sizer) WriteUndefined() {
+	s.length++
+}
+
+func (s *Sizer) WriteSimple(value uint8) {
+	if value < 24 {
+		s.length++
+	} else if value < 32 {
+		s.updateError(ErrInvalidSimple)
+	} else {
+		s.length += 2
+	}
+}
+
 func (s *Sizer) writeTypeLength(t uint8, x uint64) {
-	if x < TypeU8ShortMax {
+	if x <= TypeU8ShortMax {
 		s.length++
 	} else if x <= 0xff {
 		s.length += 2
@@ -68,7 +105,7 @@ func (s *Sizer) WriteInt32(value int32) {
 	s.WriteInt64(int64(value))
 }
 func (s *Sizer) WriteInt64(value int64) {
-	if value > 0 {
+	if value >= 0 {
 		s.WriteUint64(uint64(value))
 	} else {
 		n := uint64(-1 - value)
@@ -110,8 +147,46 @@ func (s *Sizer) WriteUint64(value uint64) {
 }
 
 func (s *Sizer) WriteFloat32(value float32) {
+	if s.opts.deterministic {
+		s.WriteFloat(float64(value))
+		return
+	}
 	s.length += 5
 }
 func (s *Sizer) WriteFloat64(value float64) {
+	if s.opts.deterministic {
+		s.WriteFloat(value)
+		return
+	}
 	s.length += 9
 }
+func (s *Sizer) WriteFloat(value float64) {
+	switch prefix, _ := shortestFloat(value); prefix {
+	case TypeF16:
+		s.length += 3
+	case TypeF32:
+		s.length += 5
+	default:
+		s.length += 9
+	}
+}
+
+func (s *Sizer) WriteTag(tag uint64) {
+	s.writeTypeLength(TypeMajorTagged, tag)
+}
+
+func (s *Sizer) WriteEmbedded(fn func(Writer)) {
+	inner := Sizer{opts: encoderOptions{deterministic: s.opts.deterministic}}
+	fn(&inner)
+	if inner.err != nil {
+		s.updateError(inner.err)
+	}
+	s.WriteTag(TagEmbeddedCBOR)
+	s.writeTypeLength(TypeMajorBytes, uint64(inner.Len()))
+	s.length += inner.Len()
+}
+
+func (s *Sizer) WriteTypedArray(value TypedArray) {
+	s.WriteTag(value.Tag)
+	s.WriteByteArray(value.Data)
+}
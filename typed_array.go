@@ -0,0 +1,420 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"math"
+	"unsafe"
+)
+
+// TypedArray is an RFC 8746 typed array: a byte string holding packed
+// numeric elements, tagged with their element type and byte order.
+//
+// Arrays returned by Decoder.ReadTypedArray alias the decoded buffer, and
+// so may the slices returned by the element accessors: when the byte order
+// matches the host and the data is suitably aligned, they are zero-copy
+// views of Data. Otherwise the elements are converted into a new slice.
+//
+// Half-precision elements (tags 80 and 84) are read as float32 by
+// Float16s. Quadruple-precision elements (tags 83 and 87) have no Go
+// type: such arrays can be read and written as Data, but their elements
+// are not converted and accessors return ErrFloat128.
+type TypedArray struct {
+	Tag  uint64
+	Data []byte
+}
+
+// ErrFloat128 is returned when converting the elements of a float128
+// typed array, which this package does not support.
+var ErrFloat128 = ReadError{"float128 typed arrays are not supported"}
+
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+func isTypedArrayTag(tag uint64) bool {
+	return tag >= TagTypedArrayMin && tag <= TagTypedArrayMax && tag != 76
+}
+
+// IsFloat reports whether the elements are floating point numbers.
+func (a TypedArray) IsFloat() bool {
+	return a.Tag&0x10 != 0
+}
+
+// IsSigned reports whether the elements are signed integers.
+func (a TypedArray) IsSigned() bool {
+	return !a.IsFloat() && a.Tag&0x08 != 0
+}
+
+// IsLittleEndian reports whether multi-byte elements are little endian.
+// The uint8 clamped array (tag 68) also reports true.
+func (a TypedArray) IsLittleEndian() bool {
+	return a.Tag&0x04 != 0
+}
+
+// ElemSize returns the size in bytes of a single element.
+func (a TypedArray) ElemSize() int {
+	if a.IsFloat() {
+		return 2 << (a.Tag & 0x03)
+	}
+	return 1 << (a.Tag & 0x03)
+}
+
+// Len returns the number of elements.
+func (a TypedArray) Len() int {
+	return len(a.Data) / a.ElemSize()
+}
+
+func (a TypedArray) byteOrder() binary.ByteOrder {
+	if a.IsLittleEndian() {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// check that the array holds elements of the given width and kind, and
+// whether the data can be reinterpreted in place
+func (a TypedArray) check(size int, float bool, signed bool) (bool, error) {
+	if isTypedArrayTag(a.Tag) && a.IsFloat() && a.ElemSize() == 16 {
+		return false, ErrFloat128
+	}
+	if !isTypedArrayTag(a.Tag) || a.ElemSize() != size || a.IsFloat() != float || a.IsSigned() != signed {
+		return false, ReadError{"typed array element type mismatch"}
+	}
+	if len(a.Data)%size != 0 {
+		return false, ReadError{"typed array length is not a multiple of its element size"}
+	}
+	if len(a.Data) == 0 {
+		return false, nil
+	}
+	native := size == 1 || a.IsLittleEndian() == nativeLittleEndian
+	aligned := uintptr(unsafe.Pointer(&a.Data[0]))%uintptr(size) == 0
+	return native && aligned, nil
+}
+
+func typedArrayTag(base uint64, littleEndian bool) uint64 {
+	if littleEndian {
+		return base | 0x04
+	}
+	return base
+}
+
+// bytes of the elements of a slice, without copying
+func sliceBytes(p unsafe.Pointer, n int, size int) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice((*byte)(p), n*size)
+}
+
+// Uint8Array returns a typed array (tag 64) viewing v.
+func Uint8Array(v []uint8) TypedArray {
+	return TypedArray{Tag: TagUint8Array, Data: v}
+}
+
+// Int8Array returns a typed array (tag 72) viewing v.
+func Int8Array(v []int8) TypedArray {
+	var p unsafe.Pointer
+	if len(v) > 0 {
+		p = unsafe.Pointer(&v[0])
+	}
+	return TypedArray{Tag: TagInt8Array, Data: sliceBytes(p, len(v), 1)}
+}
+
+// Uint16Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Uint16Array(v []uint16, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagUint16BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 2)
+		return a
+	}
+	a.Data = make([]byte, len(v)*2)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint16(a.Data[i*2:], x)
+	}
+	return a
+}
+
+// Int16Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Int16Array(v []int16, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagInt16BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 2)
+		return a
+	}
+	a.Data = make([]byte, len(v)*2)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint16(a.Data[i*2:], uint16(x))
+	}
+	return a
+}
+
+// Uint32Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Uint32Array(v []uint32, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagUint32BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 4)
+		return a
+	}
+	a.Data = make([]byte, len(v)*4)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint32(a.Data[i*4:], x)
+	}
+	return a
+}
+
+// Int32Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Int32Array(v []int32, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagInt32BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 4)
+		return a
+	}
+	a.Data = make([]byte, len(v)*4)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint32(a.Data[i*4:], uint32(x))
+	}
+	return a
+}
+
+// Uint64Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Uint64Array(v []uint64, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagUint64BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 8)
+		return a
+	}
+	a.Data = make([]byte, len(v)*8)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint64(a.Data[i*8:], x)
+	}
+	return a
+}
+
+// Int64Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Int64Array(v []int64, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagInt64BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 8)
+		return a
+	}
+	a.Data = make([]byte, len(v)*8)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint64(a.Data[i*8:], uint64(x))
+	}
+	return a
+}
+
+// Float32Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Float32Array(v []float32, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagFloat32BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 4)
+		return a
+	}
+	a.Data = make([]byte, len(v)*4)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint32(a.Data[i*4:], math.Float32bits(x))
+	}
+	return a
+}
+
+// Float64Array returns a typed array holding v in the given byte order. The
+// array views v directly when the byte order matches the host.
+func Float64Array(v []float64, littleEndian bool) TypedArray {
+	a := TypedArray{Tag: typedArrayTag(TagFloat64BEArray, littleEndian)}
+	if littleEndian == nativeLittleEndian && len(v) > 0 {
+		a.Data = sliceBytes(unsafe.Pointer(&v[0]), len(v), 8)
+		return a
+	}
+	a.Data = make([]byte, len(v)*8)
+	order := a.byteOrder()
+	for i, x := range v {
+		order.PutUint64(a.Data[i*8:], math.Float64bits(x))
+	}
+	return a
+}
+
+// Uint8s returns the elements of a uint8 or uint8 clamped array.
+func (a TypedArray) Uint8s() ([]uint8, error) {
+	if _, err := a.check(1, false, false); err != nil {
+		return nil, err
+	}
+	return a.Data, nil
+}
+
+// Int8s returns the elements of an int8 array.
+func (a TypedArray) Int8s() ([]int8, error) {
+	if _, err := a.check(1, false, true); err != nil {
+		return nil, err
+	}
+	if len(a.Data) == 0 {
+		return []int8{}, nil
+	}
+	return unsafe.Slice((*int8)(unsafe.Pointer(&a.Data[0])), len(a.Data)), nil
+}
+
+// Uint16s returns the elements of a uint16 array.
+func (a TypedArray) Uint16s() ([]uint16, error) {
+	view, err := a.check(2, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*uint16)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]uint16, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = order.Uint16(a.Data[i*2:])
+	}
+	return result, nil
+}
+
+// Int16s returns the elements of an int16 array.
+func (a TypedArray) Int16s() ([]int16, error) {
+	view, err := a.check(2, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*int16)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]int16, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = int16(order.Uint16(a.Data[i*2:]))
+	}
+	return result, nil
+}
+
+// Uint32s returns the elements of a uint32 array.
+func (a TypedArray) Uint32s() ([]uint32, error) {
+	view, err := a.check(4, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]uint32, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = order.Uint32(a.Data[i*4:])
+	}
+	return result, nil
+}
+
+// Int32s returns the elements of an int32 array.
+func (a TypedArray) Int32s() ([]int32, error) {
+	view, err := a.check(4, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*int32)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]int32, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = int32(order.Uint32(a.Data[i*4:]))
+	}
+	return result, nil
+}
+
+// Uint64s returns the elements of a uint64 array.
+func (a TypedArray) Uint64s() ([]uint64, error) {
+	view, err := a.check(8, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*uint64)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]uint64, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = order.Uint64(a.Data[i*8:])
+	}
+	return result, nil
+}
+
+// Int64s returns the elements of an int64 array.
+func (a TypedArray) Int64s() ([]int64, error) {
+	view, err := a.check(8, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*int64)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]int64, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = int64(order.Uint64(a.Data[i*8:]))
+	}
+	return result, nil
+}
+
+// Float16s returns the elements of a float16 array, widened to float32,
+// which holds every half-precision value exactly. The result is always a
+// new slice.
+func (a TypedArray) Float16s() ([]float32, error) {
+	if _, err := a.check(2, true, false); err != nil {
+		return nil, err
+	}
+	result := make([]float32, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = float16ToFloat32(order.Uint16(a.Data[i*2:]))
+	}
+	return result, nil
+}
+
+// Float32s returns the elements of a float32 array.
+func (a TypedArray) Float32s() ([]float32, error) {
+	view, err := a.check(4, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]float32, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = math.Float32frombits(order.Uint32(a.Data[i*4:]))
+	}
+	return result, nil
+}
+
+// Float64s returns the elements of a float64 array.
+func (a TypedArray) Float64s() ([]float64, error) {
+	view, err := a.check(8, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if view {
+		return unsafe.Slice((*float64)(unsafe.Pointer(&a.Data[0])), a.Len()), nil
+	}
+	result := make([]float64, a.Len())
+	order := a.byteOrder()
+	for i := range result {
+		result[i] = math.Float64frombits(order.Uint64(a.Data[i*8:]))
+	}
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package cbor
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// DefaultMaxDepth is the deepest nesting of arrays, maps and tags that
+// Validate accepts when Limits.MaxDepth is zero. Unmarshal, Diag,
+// Annotate, ToJSON, Canonical, ToMsgPack and FromMsgPack always stop at it,
+// as they recurse into nested items and would otherwise exhaust the stack
+// on hostile data.
+const DefaultMaxDepth = 1000
+
+// ErrTooDeep is returned by the converters for data nested deeper than
+// DefaultMaxDepth.
+var ErrTooDeep = ReadError{"nesting too deep"}
+
+// nesting is the depth of the arrays, maps and tags that a recursive
+// converter is inside of.
+type nesting int
+
+// enter adds a level, failing with ErrTooDeep beyond DefaultMaxDepth.
+func (n *nesting) enter() error {
+	if *n >= DefaultMaxDepth {
+		return ErrTooDeep
+	}
+	*n++
+	return nil
+}
+
+func (n *nesting) leave() {
+	*n--
+}
+
+// Limits bounds the data accepted by Validate. A zero MaxLength or
+// MaxItems means no limit; a zero MaxDepth means DefaultMaxDepth.
+type Limits struct {
+	// MaxDepth is the deepest nesting of arrays, maps and tags.
+	MaxDepth int
+	// MaxLength is the largest length of a string, in bytes, and of an
+	// array or a map, in items or entries.
+	MaxLength uint64
+	// MaxItems is the largest total number of data items.
+	MaxItems uint64
+}
+
+// Validate checks that buf holds exactly one well-formed data item within
+// limits. Beyond well-formedness, text strings must be valid UTF-8. The
+// error reports the offset of the offending item.
+func Validate(buf []byte, limits Limits) error {
+	d := NewDecoder(buf)
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	v := validator{d: &d, limits: limits}
+	if err := v.item(0); err != nil {
+		return err
+	}
+	if !d.Done() {
+		return v.errorAt(ErrTrailingData.message, d.reader.byteOffset)
+	}
+	return nil
+}
+
+type validator struct {
+	d      *Decoder
+	limits Limits
+	items  uint64
+}
+
+func (v *validator) errorAt(message string, offset uint32) error {
+	return ReadError{message + " at offset " + strconv.FormatUint(uint64(offset), 10)}
+}
+
+func (v *validator) item(depth int) error {
+	start := v.d.reader.byteOffset
+	head, err := v.d.PeekType()
+	if err != nil {
+		return v.errorAt(err.Error(), start)
+	}
+	if err := v.d.reader.Discard(uint32(head.HeadLen)); err != nil {
+		return v.errorAt(err.Error(), start)
+	}
+	v.items++
+	if v.limits.MaxItems > 0 && v.items > v.limits.MaxItems {
+		return v.errorAt("too many items", start)
+	}
+	if v.limits.MaxLength > 0 && !head.Indefinite && head.Major >= TypeMajorBytes && head.Major <= TypeMajorMap &&
+		head.Arg > v.limits.MaxLength {
+		return v.errorAt("length "+strconv.FormatUint(head.Arg, 10)+" over limit", start)
+	}
+	switch head.Major {
+	case TypeMajorBytes, TypeMajorText:
+		if head.Indefinite {
+			return v.chunks(head.Major)
+		}
+		if head.Arg > uint64(v.d.reader.Remaining()) {
+			return v.errorAt("string longer than the data", start)
+		}
+		content, _ := v.d.reader.GetBytes(uint32(head.Arg))
+		if head.Major == TypeMajorText && !utf8.Valid(content) {
+			return v.errorAt("invalid UTF-8 in text string", start)
+		}
+	case TypeMajorArray, TypeMajorMap:
+		if depth >= v.limits.MaxDepth {
+			return v.errorAt(ErrTooDeep.message, start)
+		}
+		n := head.Arg
+		if head.Major == TypeMajorMap {
+			n *= 2
+		}
+		for i := uint64(0); head.Indefinite || i < n; i++ {
+			if head.Indefinite {
+				offset := v.d.reader.byteOffset
+				if end, err := v.d.atBreak(); err != nil {
+					return v.errorAt(err.Error(), offset)
+				} else if end {
+					if head.Major == TypeMajorMap && i%2 == 1 {
+						return v.errorAt("map key without a value", offset)
+					}
+					break
+				}
+			}
+			if err := v.item(depth + 1); err != nil {
+				return err
+			}
+		}
+	case TypeMajorTagged:
+		if depth >= v.limits.MaxDepth {
+			return v.errorAt(ErrTooDeep.message, start)
+		}
+		return v.item(depth + 1)
+	default:
+		if head.Simple == SimpleBreak {
+			return v.errorAt("unexpected break", start)
+		}
+	}
+	return nil
+}
+
+// chunks checks the chunks of an indefinite length string.
+func (v *validator) chunks(major uint8) error {
+	for {
+		offset := v.d.reader.byteOffset
+		if end, err := v.d.atBreak(); err != nil {
+			return v.errorAt(err.Error(), offset)
+		} else if end {
+			return nil
+		}
+		head, err := v.d.PeekType()
+		if err != nil {
+			return v.errorAt(err.Error(), offset)
+		}
+		if head.Major != major || head.Indefinite {
+			return v.errorAt("invalid chunk in indefinite length string", offset)
+		}
+		if err := v.item(0); err != nil {
+			return err
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package cbor
 
-// Writer is the interface for writing data using the MessagePack format.
+// Writer is the interface for writing data using the CBOR format. It is
+// implemented by Encoder, which writes to a buffer, and Sizer, which counts
+// the bytes an Encoder would need.
 type Writer interface {
 	WriteNil()
+	WriteUndefined()
+	WriteSimple(value uint8)
 	WriteBool(value bool)
 	WriteInt8(value int8)
 	WriteInt16(value int16)
@@ -14,9 +18,13 @@ type Writer interface {
 	WriteUint64(value uint64)
 	WriteFloat32(value float32)
 	WriteFloat64(value float64)
+	WriteFloat(value float64)
 	WriteString(value string)
 	WriteByteArray(value []byte)
 	WriteArraySize(length uint32)
 	WriteMapSize(length uint32)
+	WriteTag(tag uint64)
+	WriteEmbedded(fn func(Writer))
+	WriteTypedArray(value TypedArray)
 	CheckError() error
 }